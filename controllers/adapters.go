@@ -0,0 +1,264 @@
+package controllers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sam-book-sample/logging"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/pkg/errors"
+)
+
+func decodeBody(body string, isBase64Encoded bool) (string, error) {
+	if !isBase64Encoded {
+		return body, nil
+	}
+
+	b, err := base64.StdEncoding.DecodeString(body)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	return string(b), nil
+}
+
+// API Gateway REST API (ペイロード v1)
+
+func NewRequestFromAPIGatewayProxy(ctx context.Context, e events.APIGatewayProxyRequest) (Request, error) {
+	body, err := decodeBody(e.Body, e.IsBase64Encoded)
+	if err != nil {
+		return Request{}, errors.WithStack(err)
+	}
+
+	req := Request{
+		Method:                e.HTTPMethod,
+		Route:                 e.Resource,
+		Path:                  e.Path,
+		Headers:               e.Headers,
+		QueryStringParameters: e.QueryStringParameters,
+		PathParameters:        e.PathParameters,
+		Body:                  body,
+		RequestID:             e.RequestContext.RequestID,
+	}
+
+	return req.WithContext(ctx), nil
+}
+
+func (r Response) ToAPIGatewayProxy() events.APIGatewayProxyResponse {
+	return events.APIGatewayProxyResponse{
+		StatusCode: r.StatusCode,
+		Headers:    r.Headers,
+		Body:       r.Body,
+	}
+}
+
+func APIGatewayProxyHandler(h Handler) func(context.Context, events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	return func(ctx context.Context, e events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		req, err := NewRequestFromAPIGatewayProxy(ctx, e)
+		if err != nil {
+			return responseForBrokenRequest(ctx, e.Headers, err).ToAPIGatewayProxy(), nil
+		}
+		return h(req).ToAPIGatewayProxy(), nil
+	}
+}
+
+// API Gateway HTTP API (ペイロード v2)
+
+// APIGatewayV2HTTPRequest は HTTP API のペイロード v2。ロックしている aws-lambda-go には
+// この形式の型がないので、使う項目だけを定義する
+type APIGatewayV2HTTPRequest struct {
+	Version               string                         `json:"version"`
+	RouteKey              string                         `json:"routeKey"`
+	RawPath               string                         `json:"rawPath"`
+	RawQueryString        string                         `json:"rawQueryString"`
+	Headers               map[string]string              `json:"headers"`
+	QueryStringParameters map[string]string              `json:"queryStringParameters,omitempty"`
+	PathParameters        map[string]string              `json:"pathParameters,omitempty"`
+	RequestContext        APIGatewayV2HTTPRequestContext `json:"requestContext"`
+	Body                  string                         `json:"body,omitempty"`
+	IsBase64Encoded       bool                           `json:"isBase64Encoded"`
+}
+
+type APIGatewayV2HTTPRequestContext struct {
+	RequestID string                             `json:"requestId"`
+	HTTP      APIGatewayV2HTTPRequestContextHTTP `json:"http"`
+}
+
+type APIGatewayV2HTTPRequestContextHTTP struct {
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	Protocol  string `json:"protocol"`
+	SourceIP  string `json:"sourceIp"`
+	UserAgent string `json:"userAgent"`
+}
+
+type APIGatewayV2HTTPResponse struct {
+	StatusCode      int               `json:"statusCode"`
+	Headers         map[string]string `json:"headers"`
+	Body            string            `json:"body"`
+	IsBase64Encoded bool              `json:"isBase64Encoded,omitempty"`
+}
+
+func NewRequestFromAPIGatewayV2HTTP(ctx context.Context, e APIGatewayV2HTTPRequest) (Request, error) {
+	body, err := decodeBody(e.Body, e.IsBase64Encoded)
+	if err != nil {
+		return Request{}, errors.WithStack(err)
+	}
+
+	// RouteKey は "GET /v1/users/{user_id}" の形式
+	route := e.RouteKey
+	if i := strings.Index(route, " "); i >= 0 {
+		route = route[i+1:]
+	}
+
+	req := Request{
+		Method:                e.RequestContext.HTTP.Method,
+		Route:                 route,
+		Path:                  e.RawPath,
+		Headers:               e.Headers,
+		QueryStringParameters: e.QueryStringParameters,
+		PathParameters:        e.PathParameters,
+		Body:                  body,
+		RequestID:             e.RequestContext.RequestID,
+	}
+
+	return req.WithContext(ctx), nil
+}
+
+func (r Response) ToAPIGatewayV2HTTP() APIGatewayV2HTTPResponse {
+	return APIGatewayV2HTTPResponse{
+		StatusCode: r.StatusCode,
+		Headers:    r.Headers,
+		Body:       r.Body,
+	}
+}
+
+func APIGatewayV2HTTPHandler(h Handler) func(context.Context, APIGatewayV2HTTPRequest) (APIGatewayV2HTTPResponse, error) {
+	return func(ctx context.Context, e APIGatewayV2HTTPRequest) (APIGatewayV2HTTPResponse, error) {
+		req, err := NewRequestFromAPIGatewayV2HTTP(ctx, e)
+		if err != nil {
+			return responseForBrokenRequest(ctx, e.Headers, err).ToAPIGatewayV2HTTP(), nil
+		}
+		return h(req).ToAPIGatewayV2HTTP(), nil
+	}
+}
+
+// ALB ターゲットグループ
+
+// NewRequestFromALBTargetGroup は ALB がパスパラメータを解決しないため route と照合して取り出す
+func NewRequestFromALBTargetGroup(ctx context.Context, route string, e events.ALBTargetGroupRequest) (Request, bool, error) {
+	params, ok := matchRoute(route, e.Path)
+	if !ok {
+		return Request{}, false, nil
+	}
+
+	body, err := decodeBody(e.Body, e.IsBase64Encoded)
+	if err != nil {
+		return Request{}, true, errors.WithStack(err)
+	}
+
+	// ALB はクエリ文字列をデコードせずに渡してくる
+	query := map[string]string{}
+	for k, v := range e.QueryStringParameters {
+		dk, err := url.QueryUnescape(k)
+		if err != nil {
+			return Request{}, true, errors.WithStack(err)
+		}
+		dv, err := url.QueryUnescape(v)
+		if err != nil {
+			return Request{}, true, errors.WithStack(err)
+		}
+		query[dk] = dv
+	}
+
+	req := Request{
+		Method:                e.HTTPMethod,
+		Route:                 route,
+		Path:                  e.Path,
+		Headers:               e.Headers,
+		QueryStringParameters: query,
+		PathParameters:        params,
+		Body:                  body,
+		RequestID:             e.Headers["x-amzn-trace-id"],
+	}
+
+	return req.WithContext(ctx), true, nil
+}
+
+func (r Response) ToALBTargetGroup() events.ALBTargetGroupResponse {
+	return events.ALBTargetGroupResponse{
+		StatusCode:        r.StatusCode,
+		StatusDescription: fmt.Sprintf("%d %s", r.StatusCode, http.StatusText(r.StatusCode)),
+		Headers:           r.Headers,
+		Body:              r.Body,
+	}
+}
+
+func ALBTargetGroupHandler(route string, h Handler) func(context.Context, events.ALBTargetGroupRequest) (events.ALBTargetGroupResponse, error) {
+	return func(ctx context.Context, e events.ALBTargetGroupRequest) (events.ALBTargetGroupResponse, error) {
+		req, ok, err := NewRequestFromALBTargetGroup(ctx, route, e)
+		if err != nil {
+			return responseForBrokenRequest(ctx, e.Headers, err).ToALBTargetGroup(), nil
+		}
+		if !ok {
+			return RenderError(Request{Headers: e.Headers}, ErrNotFound).ToALBTargetGroup(), nil
+		}
+		return h(req).ToALBTargetGroup(), nil
+	}
+}
+
+// LambdaHandler は受け取ったイベントの形式を判別し、対応するアダプタで h を呼び出す
+func LambdaHandler(route string, h Handler) func(context.Context, json.RawMessage) (interface{}, error) {
+	proxy := APIGatewayProxyHandler(h)
+	v2 := APIGatewayV2HTTPHandler(h)
+	alb := ALBTargetGroupHandler(route, h)
+
+	return func(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+		var probe struct {
+			Version        string `json:"version"`
+			RequestContext struct {
+				ELB *events.ELBContext `json:"elb"`
+			} `json:"requestContext"`
+		}
+		err := json.Unmarshal(payload, &probe)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		switch {
+		case probe.Version == "2.0":
+			var e APIGatewayV2HTTPRequest
+			err = json.Unmarshal(payload, &e)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			return v2(ctx, e)
+		case probe.RequestContext.ELB != nil:
+			var e events.ALBTargetGroupRequest
+			err = json.Unmarshal(payload, &e)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			return alb(ctx, e)
+		default:
+			var e events.APIGatewayProxyRequest
+			err = json.Unmarshal(payload, &e)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			return proxy(ctx, e)
+		}
+	}
+}
+
+func responseForBrokenRequest(ctx context.Context, headers map[string]string, err error) Response {
+	logging.FromContext(ctx).WithError(err).Warn("failed to decode request")
+	return RenderError(Request{Headers: headers}, NewValidationError(map[string]error{
+		"body": ErrBody,
+	}))
+}
@@ -0,0 +1,196 @@
+package controllers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+)
+
+type testAdapter struct {
+	Name   string
+	Invoke func(h Handler, route string, req Request) Response
+}
+
+// testAdapters はコントローラのテストを各イベント形式で実行するためのもの
+var testAdapters = []testAdapter{
+	{
+		Name: "APIGatewayProxy",
+		Invoke: func(h Handler, route string, req Request) Response {
+			res, _ := APIGatewayProxyHandler(h)(context.Background(), events.APIGatewayProxyRequest{
+				Resource:              route,
+				Path:                  expandRoute(route, req.PathParameters),
+				HTTPMethod:            req.Method,
+				Headers:               req.Headers,
+				QueryStringParameters: req.QueryStringParameters,
+				PathParameters:        req.PathParameters,
+				Body:                  req.Body,
+			})
+			return Response{StatusCode: res.StatusCode, Headers: res.Headers, Body: res.Body}
+		},
+	},
+	{
+		Name: "APIGatewayV2HTTP",
+		Invoke: func(h Handler, route string, req Request) Response {
+			headers := map[string]string{}
+			for k, v := range req.Headers {
+				headers[strings.ToLower(k)] = v
+			}
+			res, _ := APIGatewayV2HTTPHandler(h)(context.Background(), APIGatewayV2HTTPRequest{
+				Version:               "2.0",
+				RouteKey:              req.Method + " " + route,
+				RawPath:               expandRoute(route, req.PathParameters),
+				Headers:               headers,
+				QueryStringParameters: req.QueryStringParameters,
+				PathParameters:        req.PathParameters,
+				Body:                  req.Body,
+				RequestContext: APIGatewayV2HTTPRequestContext{
+					HTTP: APIGatewayV2HTTPRequestContextHTTP{
+						Method: req.Method,
+					},
+				},
+			})
+			return Response{StatusCode: res.StatusCode, Headers: res.Headers, Body: res.Body}
+		},
+	},
+	{
+		Name: "ALBTargetGroup",
+		Invoke: func(h Handler, route string, req Request) Response {
+			headers := map[string]string{}
+			for k, v := range req.Headers {
+				headers[strings.ToLower(k)] = v
+			}
+			query := map[string]string{}
+			for k, v := range req.QueryStringParameters {
+				query[url.QueryEscape(k)] = url.QueryEscape(v)
+			}
+			res, _ := ALBTargetGroupHandler(route, h)(context.Background(), events.ALBTargetGroupRequest{
+				HTTPMethod:            req.Method,
+				Path:                  expandRoute(route, req.PathParameters),
+				Headers:               headers,
+				QueryStringParameters: query,
+				Body:                  base64.StdEncoding.EncodeToString([]byte(req.Body)),
+				IsBase64Encoded:       true,
+			})
+			return Response{StatusCode: res.StatusCode, Headers: res.Headers, Body: res.Body}
+		},
+	},
+}
+
+func forEachAdapter(t *testing.T, f func(t *testing.T, a testAdapter)) {
+	t.Helper()
+	for _, a := range testAdapters {
+		a := a
+		t.Run(a.Name, func(t *testing.T) {
+			f(t, a)
+		})
+	}
+}
+
+// withDefaultAdapter は f を 1 つのイベント形式だけで実行する。形式ごとの違いは users と microposts のテストで確かめる
+func withDefaultAdapter(t *testing.T, f func(t *testing.T, a testAdapter)) {
+	t.Helper()
+	f(t, testAdapters[0])
+}
+
+func expandRoute(route string, params map[string]string) string {
+	parts := splitPath(route)
+	for i, part := range parts {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			parts[i] = params[strings.Trim(part, "{}")]
+		}
+	}
+	return "/" + strings.Join(parts, "/")
+}
+
+func echoHandler(request Request) Response {
+	return Response200(map[string]interface{}{
+		"route":  request.Route,
+		"params": request.PathParameters,
+		"query":  request.QueryStringParameters,
+		"body":   request.Body,
+	})
+}
+
+func TestAdapters(t *testing.T) {
+	forEachAdapter(t, func(t *testing.T, a testAdapter) {
+		res := a.Invoke(echoHandler, RouteMicropost, Request{
+			Method: "PUT",
+			PathParameters: map[string]string{
+				"user_id":      "1",
+				"micropost_id": "2",
+			},
+			QueryStringParameters: map[string]string{
+				"q": "テスト &=",
+			},
+			Body: `{"content":"テスト"}`,
+		})
+
+		assert.Equal(t, 200, res.StatusCode)
+
+		var body map[string]interface{}
+		err := json.Unmarshal([]byte(res.Body), &body)
+		assert.NoError(t, err)
+		assert.Equal(t, RouteMicropost, body["route"])
+		assert.Equal(t, map[string]interface{}{"user_id": "1", "micropost_id": "2"}, body["params"])
+		assert.Equal(t, map[string]interface{}{"q": "テスト &="}, body["query"])
+		assert.Equal(t, `{"content":"テスト"}`, body["body"])
+	})
+}
+
+func TestALBTargetGroupHandler_404(t *testing.T) {
+	res, err := ALBTargetGroupHandler(RouteUser, echoHandler)(context.Background(), events.ALBTargetGroupRequest{
+		HTTPMethod: "GET",
+		Path:       "/v1/users/1/unknown",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 404, res.StatusCode)
+	assert.Equal(t, "404 Not Found", res.StatusDescription)
+}
+
+func TestLambdaHandler(t *testing.T) {
+	cases := []struct {
+		Name    string
+		Payload string
+	}{
+		{
+			Name:    "APIGatewayProxy",
+			Payload: `{"resource":"/v1/users/{user_id}","path":"/v1/users/1","httpMethod":"GET","pathParameters":{"user_id":"1"}}`,
+		},
+		{
+			Name:    "APIGatewayV2HTTP",
+			Payload: `{"version":"2.0","routeKey":"GET /v1/users/{user_id}","rawPath":"/v1/users/1","pathParameters":{"user_id":"1"},"requestContext":{"http":{"method":"GET"}}}`,
+		},
+		{
+			Name:    "ALBTargetGroup",
+			Payload: `{"httpMethod":"GET","path":"/v1/users/1","requestContext":{"elb":{"targetGroupArn":"arn"}}}`,
+		},
+	}
+
+	for _, c := range cases {
+		res, err := LambdaHandler(RouteUser, echoHandler)(context.Background(), json.RawMessage(c.Payload))
+		assert.NoError(t, err, c.Name)
+
+		b, err := json.Marshal(res)
+		assert.NoError(t, err, c.Name)
+
+		var out struct {
+			StatusCode int    `json:"statusCode"`
+			Body       string `json:"body"`
+		}
+		err = json.Unmarshal(b, &out)
+		assert.NoError(t, err, c.Name)
+		assert.Equal(t, 200, out.StatusCode, c.Name)
+
+		var body map[string]interface{}
+		err = json.Unmarshal([]byte(out.Body), &body)
+		assert.NoError(t, err, c.Name)
+		assert.Equal(t, RouteUser, body["route"], c.Name)
+		assert.Equal(t, map[string]interface{}{"user_id": "1"}, body["params"], c.Name)
+	}
+}
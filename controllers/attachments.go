@@ -0,0 +1,128 @@
+package controllers
+
+import (
+	"sam-book-sample/logging"
+	"sam-book-sample/models"
+	"sam-book-sample/utils"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/validator.v2"
+)
+
+var (
+	ErrContentType     = validator.TextErr{Err: errors.New("unsupported content type")}
+	ErrAttachmentSize  = validator.TextErr{Err: errors.New("invalid attachment size")}
+	ErrAttachmentCount = validator.TextErr{Err: errors.New("too many attachments")}
+	ErrAttachment      = validator.TextErr{Err: errors.New("attachment not uploaded")}
+)
+
+var ValidateAttachmentsPathSettings = []*ValidatorSetting{
+	{ArgName: "user_id", ValidateTags: "required,uint"},
+}
+
+// RequestPostAttachment の size はアップロードするファイルのバイト数。アップロードしたファイルがこの大きさでなければ添付できない
+type RequestPostAttachment struct {
+	ContentType string `json:"content_type" validate:"required"`
+	Size        int64  `json:"size" validate:"required"`
+}
+
+// ResponsePostAttachment の upload_url にファイルを PUT する。Content-Type は content_type と同じにする
+type ResponsePostAttachment struct {
+	Message   string `json:"message"`
+	ID        uint64 `json:"id"`
+	UploadURL string `json:"upload_url"`
+}
+
+type ResponseAttachment struct {
+	ID          uint64 `json:"id"`
+	ContentType string `json:"content_type"`
+	URL         string `json:"url"`
+}
+
+// validateAttachment は種類と大きさを検証する。required で弾けない値だけを見る
+func validateAttachment(req *RequestPostAttachment) *map[string]error {
+	errs := map[string]error{}
+
+	if req.ContentType != "" && !models.IsAttachmentContentType(req.ContentType) {
+		errs["content_type"] = &ParamError{Err: ErrContentType, Tag: "types", Param: strings.Join(models.AttachmentContentTypes, ", ")}
+	}
+	if req.Size < 0 || req.Size > models.MaxAttachmentSize {
+		errs["size"] = &ParamError{Err: ErrAttachmentSize, Tag: "max", Param: strconv.Itoa(models.MaxAttachmentSize)}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return &errs
+}
+
+// validateAttachmentIDs は attachment_ids の数を検証する
+func validateAttachmentIDs(ids []uint64) *map[string]error {
+	if len(ids) <= models.MaxAttachmentsPerMicropost {
+		return nil
+	}
+
+	return &map[string]error{
+		"attachment_ids": &ParamError{Err: ErrAttachmentCount, Tag: "max", Param: strconv.Itoa(models.MaxAttachmentsPerMicropost)},
+	}
+}
+
+// newResponseAttachments は添付ファイルを読むための URL を付ける。URL を作れなければ空のまま返す
+func newResponseAttachments(attachments []models.MicropostAttachment) []*ResponseAttachment {
+	if len(attachments) == 0 {
+		return nil
+	}
+
+	res := make([]*ResponseAttachment, len(attachments))
+	for i := range attachments {
+		a := &attachments[i]
+		url, err := a.DownloadURL()
+		if err != nil {
+			logging.Default().WithError(err).Warn("failed to presign attachment")
+		}
+		res[i] = &ResponseAttachment{
+			ID:          a.ID,
+			ContentType: a.ContentType,
+			URL:         url,
+		}
+	}
+
+	return res
+}
+
+func PostAttachment(request Request) Response {
+	var req RequestPostAttachment
+	validErr := MergeErrors(
+		ValidateParams(request.PathParameters, ValidateAttachmentsPathSettings),
+		DecodeBody(request.Body, &req),
+	)
+	if validErr == nil {
+		validErr = validateAttachment(&req)
+	}
+	if validErr != nil {
+		return RenderError(request, NewValidationError(*validErr))
+	}
+
+	userID, err := utils.ParseUint(request.PathParameters["user_id"])
+	if err != nil {
+		return RenderError(request, err)
+	}
+
+	_, err = models.GetUserByID(userID, "ID")
+	if err != nil {
+		return RenderError(request, err)
+	}
+
+	attachment, url, err := models.CreateAttachment(userID, req.ContentType, req.Size)
+	if err != nil {
+		return RenderError(request, err)
+	}
+
+	return Response201Created(&ResponsePostAttachment{
+		Message:   "OK",
+		ID:        attachment.ID,
+		UploadURL: url,
+	})
+}
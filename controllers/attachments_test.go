@@ -0,0 +1,155 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sam-book-sample/db"
+	"sam-book-sample/mocks"
+	"sam-book-sample/models"
+	"sam-book-sample/storage"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func postAttachment(a testAdapter, userID uint64, body string) Response {
+	return a.Invoke(PostAttachment, RouteAttachments, Request{
+		Method: "POST",
+		Body:   body,
+		PathParameters: map[string]string{
+			"user_id": fmt.Sprintf("%d", userID),
+		},
+	})
+}
+
+// upload は署名付き URL にファイルを PUT する
+func upload(t *testing.T, url, contentType string, data []byte) {
+	t.Helper()
+
+	req, err := http.NewRequest("PUT", url, bytes.NewReader(data))
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", contentType)
+
+	res, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, 200, res.StatusCode)
+}
+
+func TestPostAttachment(t *testing.T) {
+	withDefaultAdapter(t, func(t *testing.T, a testAdapter) {
+		mocks.SetupDB(t)
+		defer db.DropTable()
+		mocks.SetupBucket(t)
+		defer storage.DropBucket()
+
+		u := mocks.User().Multi(1, mocks.E)[0].(*models.User)
+		data := []byte("GIF89a")
+
+		res := postAttachment(a, u.ID, fmt.Sprintf(`{"content_type":"image/gif","size":%d}`, len(data)))
+		assert.Equal(t, 201, res.StatusCode)
+
+		var created ResponsePostAttachment
+		assert.NoError(t, json.Unmarshal([]byte(res.Body), &created))
+		assert.NotZero(t, created.ID)
+
+		// アップロードする前は添付できない
+		res = a.Invoke(PostMicroposts, RouteMicroposts, Request{
+			Method:         "POST",
+			Body:           fmt.Sprintf(`{"content":"photo","attachment_ids":[%d]}`, created.ID),
+			PathParameters: map[string]string{"user_id": fmt.Sprintf("%d", u.ID)},
+		})
+		assert.Equal(t, 400, res.StatusCode)
+		assert.Contains(t, res.Body, `"attachment_ids"`)
+
+		upload(t, created.UploadURL, "image/gif", data)
+
+		res = a.Invoke(PostMicroposts, RouteMicroposts, Request{
+			Method:         "POST",
+			Body:           fmt.Sprintf(`{"content":"photo","attachment_ids":[%d]}`, created.ID),
+			PathParameters: map[string]string{"user_id": fmt.Sprintf("%d", u.ID)},
+		})
+		assert.Equal(t, 201, res.StatusCode)
+
+		var post Response201Body
+		assert.NoError(t, json.Unmarshal([]byte(res.Body), &post))
+
+		res = a.Invoke(GetMicropost, RouteMicropost, Request{
+			Method: "GET",
+			PathParameters: map[string]string{
+				"user_id":      fmt.Sprintf("%d", u.ID),
+				"micropost_id": fmt.Sprintf("%d", post.ID),
+			},
+		})
+		assert.Equal(t, 200, res.StatusCode)
+
+		var got ResponseMicropost
+		assert.NoError(t, json.Unmarshal([]byte(res.Body), &got))
+		if assert.Len(t, got.Attachments, 1) {
+			assert.Equal(t, created.ID, got.Attachments[0].ID)
+			assert.Equal(t, "image/gif", got.Attachments[0].ContentType)
+			assert.NotEmpty(t, got.Attachments[0].URL)
+
+			// 添付した後にアップロード先を置き換えても、付けたファイルは変わらない
+			upload(t, created.UploadURL, "image/gif", []byte("GIF87a"))
+
+			dl, err := http.Get(got.Attachments[0].URL)
+			assert.NoError(t, err)
+			defer dl.Body.Close()
+			body, err := ioutil.ReadAll(dl.Body)
+			assert.NoError(t, err)
+			assert.Equal(t, data, body)
+		}
+	})
+}
+
+func TestPostAttachment_invalid(t *testing.T) {
+	withDefaultAdapter(t, func(t *testing.T, a testAdapter) {
+		mocks.SetupDB(t)
+		defer db.DropTable()
+		mocks.SetupBucket(t)
+		defer storage.DropBucket()
+
+		userMocks := mocks.User().Multi(2, mocks.E)
+		u1 := userMocks[0].(*models.User)
+		u2 := userMocks[1].(*models.User)
+
+		for _, body := range []string{
+			`{"size":10}`,
+			`{"content_type":"text/html","size":10}`,
+			fmt.Sprintf(`{"content_type":"image/png","size":%d}`, models.MaxAttachmentSize+1),
+		} {
+			res := postAttachment(a, u1.ID, body)
+			assert.Equal(t, 400, res.StatusCode, body)
+		}
+
+		res := postAttachment(a, 99999, `{"content_type":"image/png","size":10}`)
+		assert.Equal(t, 404, res.StatusCode)
+
+		// 他のユーザーの添付ファイルは使えない
+		data := []byte("png")
+		res = postAttachment(a, u1.ID, fmt.Sprintf(`{"content_type":"image/png","size":%d}`, len(data)))
+		assert.Equal(t, 201, res.StatusCode)
+
+		var created ResponsePostAttachment
+		assert.NoError(t, json.Unmarshal([]byte(res.Body), &created))
+		upload(t, created.UploadURL, "image/png", data)
+
+		res = a.Invoke(PostMicroposts, RouteMicroposts, Request{
+			Method:         "POST",
+			Body:           fmt.Sprintf(`{"content":"photo","attachment_ids":[%d]}`, created.ID),
+			PathParameters: map[string]string{"user_id": fmt.Sprintf("%d", u2.ID)},
+		})
+		assert.Equal(t, 400, res.StatusCode)
+
+		res = a.Invoke(PostMicroposts, RouteMicroposts, Request{
+			Method:         "POST",
+			Body:           `{"content":"photo","attachment_ids":[1,2,3,4,5]}`,
+			PathParameters: map[string]string{"user_id": fmt.Sprintf("%d", u1.ID)},
+		})
+		assert.Equal(t, 400, res.StatusCode)
+	})
+}
@@ -0,0 +1,227 @@
+package controllers
+
+import (
+	"fmt"
+	"sam-book-sample/i18n"
+	"sam-book-sample/models"
+	"sort"
+	"strings"
+)
+
+// problemTypeBase は problem+json の type の接頭辞
+const problemTypeBase = "/problems/"
+
+// HTTPError は controllers が返すエラー。RenderError が Problem を元にレスポンスを組み立てる
+type HTTPError interface {
+	error
+	Status() int
+	Problem(l *i18n.Localizer) *Problem
+}
+
+func newProblem(l *i18n.Localizer, status int, problemType, detailKey string, params i18n.Params) *Problem {
+	return &Problem{
+		Type:   problemTypeBase + problemType,
+		Title:  l.Message("problem."+problemType, nil),
+		Status: status,
+		Detail: l.Message(detailKey, params),
+	}
+}
+
+// ValidationError は項目ごとの検証エラー
+type ValidationError struct {
+	Fields map[string]error
+}
+
+func NewValidationError(fields map[string]error) *ValidationError {
+	return &ValidationError{Fields: fields}
+}
+
+func (e *ValidationError) Error() string {
+	keys := make([]string, 0, len(e.Fields))
+	for k := range e.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	messages := make([]string, len(keys))
+	for i, k := range keys {
+		messages[i] = fmt.Sprintf("%s: %s", k, e.Fields[k].Error())
+	}
+
+	return strings.Join(messages, ", ")
+}
+
+func (e *ValidationError) Status() int {
+	return 400
+}
+
+func (e *ValidationError) Problem(l *i18n.Localizer) *Problem {
+	p := newProblem(l, e.Status(), "validation-error", "response.bad_request", i18n.Params{"count": len(e.Fields)})
+	p.Errors = ConvertErrorsToFieldErrors(l, e.Fields)
+	return p
+}
+
+// NotFoundError は対象のリソースが存在しないことを表す
+type NotFoundError struct{}
+
+var ErrNotFound = &NotFoundError{}
+
+func (e *NotFoundError) Error() string {
+	return "not found"
+}
+
+func (e *NotFoundError) Status() int {
+	return 404
+}
+
+func (e *NotFoundError) Problem(l *i18n.Localizer) *Problem {
+	return newProblem(l, e.Status(), "not-found", "response.not_found", nil)
+}
+
+// ForbiddenError は管理用の API を権限のないリクエストから呼んだことを表す
+type ForbiddenError struct{}
+
+var ErrForbidden = &ForbiddenError{}
+
+func (e *ForbiddenError) Error() string {
+	return "forbidden"
+}
+
+func (e *ForbiddenError) Status() int {
+	return 403
+}
+
+func (e *ForbiddenError) Problem(l *i18n.Localizer) *Problem {
+	return newProblem(l, e.Status(), "forbidden", "response.forbidden", nil)
+}
+
+// EditWindowExpiredError は編集できる期間を過ぎた Micropost を編集しようとしたことを表す
+type EditWindowExpiredError struct{}
+
+var ErrEditWindowExpired = &EditWindowExpiredError{}
+
+func (e *EditWindowExpiredError) Error() string {
+	return "edit window expired"
+}
+
+func (e *EditWindowExpiredError) Status() int {
+	return 403
+}
+
+func (e *EditWindowExpiredError) Problem(l *i18n.Localizer) *Problem {
+	return newProblem(l, e.Status(), "edit-window-expired", "response.edit_window_expired", nil)
+}
+
+// ConflictError は同時更新などで書き込みが競合したことを表す
+type ConflictError struct{}
+
+var ErrConflict = &ConflictError{}
+
+func (e *ConflictError) Error() string {
+	return "conflict"
+}
+
+func (e *ConflictError) Status() int {
+	return 409
+}
+
+func (e *ConflictError) Problem(l *i18n.Localizer) *Problem {
+	return newProblem(l, e.Status(), "conflict", "response.conflict", nil)
+}
+
+// PreconditionFailedError は読み込んだ後に他の更新があり、前提のバージョンが変わったことを表す
+type PreconditionFailedError struct{}
+
+var ErrPreconditionFailed = &PreconditionFailedError{}
+
+func (e *PreconditionFailedError) Error() string {
+	return "precondition failed"
+}
+
+func (e *PreconditionFailedError) Status() int {
+	return 412
+}
+
+func (e *PreconditionFailedError) Problem(l *i18n.Localizer) *Problem {
+	return newProblem(l, e.Status(), "precondition-failed", "response.precondition_failed", nil)
+}
+
+// InternalError は HTTPError でないエラーを包む。原因はクライアントに返さない
+type InternalError struct {
+	Err error
+}
+
+func (e *InternalError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *InternalError) Cause() error {
+	return e.Err
+}
+
+func (e *InternalError) Status() int {
+	return 500
+}
+
+func (e *InternalError) Problem(l *i18n.Localizer) *Problem {
+	return newProblem(l, e.Status(), "internal-error", "response.server_error", nil)
+}
+
+// fromDomainError は models のエラーを HTTPError に対応づける
+func fromDomainError(err error) HTTPError {
+	switch err {
+	case models.ErrNotFound:
+		return ErrNotFound
+	case models.ErrConflict:
+		return ErrConflict
+	case models.ErrVersionMismatch:
+		return ErrPreconditionFailed
+	case models.ErrDuplicateEmail:
+		return NewValidationError(map[string]error{
+			"email": ErrUniq,
+		})
+	case models.ErrSelfFollow:
+		return NewValidationError(map[string]error{
+			"followee_id": ErrSelfFollow,
+		})
+	case models.ErrParentNotFound:
+		return NewValidationError(map[string]error{
+			"in_reply_to_id": ErrInReplyTo,
+		})
+	case models.ErrInvalidAttachment:
+		return NewValidationError(map[string]error{
+			"attachment_ids": ErrAttachment,
+		})
+	case models.ErrModerationRejected:
+		return NewValidationError(map[string]error{
+			"content": ErrModeration,
+		})
+	case models.ErrEditWindowExpired:
+		return ErrEditWindowExpired
+	case models.ErrAlreadyFollowing:
+		return ErrConflict
+	case models.ErrInvalidCursor:
+		return NewValidationError(map[string]error{
+			cursorParamName: ErrCursor,
+		})
+	}
+	return nil
+}
+
+// asHTTPError は errors.WithStack などで包まれたエラーからも HTTPError を取り出す
+func asHTTPError(err error) HTTPError {
+	for e := err; e != nil; {
+		if he, ok := e.(HTTPError); ok {
+			return he
+		}
+		if he := fromDomainError(e); he != nil {
+			return he
+		}
+		c, ok := e.(interface{ Cause() error })
+		if !ok {
+			break
+		}
+		e = c.Cause()
+	}
+	return &InternalError{Err: err}
+}
@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"sam-book-sample/models"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcceptsProblem(t *testing.T) {
+	cases := []struct {
+		Accept   string
+		Expected bool
+	}{
+		{Accept: "", Expected: false},
+		{Accept: "*/*", Expected: false},
+		{Accept: "application/json", Expected: false},
+		{Accept: "application/problem+json", Expected: true},
+		{Accept: "application/json, application/problem+json", Expected: true},
+		{Accept: "application/problem+json;q=0.5, application/json", Expected: false},
+		{Accept: "application/problem+json;q=0", Expected: false},
+		{Accept: "Application/Problem+JSON; charset=utf-8", Expected: true},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.Expected, acceptsProblem(c.Accept), c.Accept)
+	}
+}
+
+func TestRenderError(t *testing.T) {
+	request := Request{
+		Headers: map[string]string{
+			"Accept": "application/problem+json",
+		},
+	}
+	request = request.WithContext(context.WithValue(request.Context(), requestIDKey, "req-1"))
+
+	res := RenderError(request, NewValidationError(map[string]error{
+		"email": ErrEmail,
+	}))
+
+	assert.Equal(t, 400, res.StatusCode)
+	assert.Equal(t, "application/problem+json", res.Headers["Content-Type"])
+	assert.JSONEq(t, `{
+		"type": "/problems/validation-error",
+		"title": "入力値エラー",
+		"status": 400,
+		"detail": "入力値を確認してください。",
+		"instance": "req-1",
+		"errors": {
+			"email": [{"code": "email", "message": "メールアドレスの形式が不正です。"}]
+		}
+	}`, res.Body)
+
+	res = RenderError(request, errors.WithStack(ErrNotFound))
+
+	assert.Equal(t, 404, res.StatusCode)
+	assert.JSONEq(t, `{
+		"type": "/problems/not-found",
+		"title": "見つかりません",
+		"status": 404,
+		"detail": "結果が見つかりません。",
+		"instance": "req-1"
+	}`, res.Body)
+}
+
+func TestRenderError_legacy(t *testing.T) {
+	err := errors.New("boom")
+	res := RenderError(Request{RequestID: "req-1"}, err)
+
+	assert.Equal(t, 500, res.StatusCode)
+	assert.Equal(t, "application/json", res.Headers["Content-Type"])
+	assert.Equal(t, err, res.err)
+
+	var body map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(res.Body), &body))
+	assert.Equal(t, map[string]interface{}{
+		"message": "サーバエラーが発生しました。",
+	}, body)
+}
+
+func TestRenderError_domain(t *testing.T) {
+	cases := []struct {
+		Err      error
+		Status   int
+		Expected string
+	}{
+		{Err: models.ErrNotFound, Status: 404, Expected: `{"message": "結果が見つかりません。"}`},
+		{Err: models.ErrConflict, Status: 409, Expected: `{"message": "他の更新と競合しました。再度お試しください。"}`},
+		{
+			Err:      models.ErrVersionMismatch,
+			Status:   412,
+			Expected: `{"message": "他の更新により内容が変更されています。最新の内容を取得してから再度お試しください。"}`,
+		},
+		{
+			Err:    models.ErrDuplicateEmail,
+			Status: 400,
+			Expected: `{
+				"message": "入力値を確認してください。",
+				"errors": {"email": "すでに登録されているメールアドレスです。"},
+				"details": {"email": [{"code": "unique", "message": "すでに登録されているメールアドレスです。"}]}
+			}`,
+		},
+	}
+
+	for _, c := range cases {
+		res := RenderError(Request{}, errors.WithStack(c.Err))
+
+		assert.Equal(t, c.Status, res.StatusCode, c.Err.Error())
+		assert.JSONEq(t, c.Expected, res.Body, c.Err.Error())
+	}
+}
@@ -0,0 +1,48 @@
+package controllers
+
+import (
+	"sam-book-sample/models"
+	"sam-book-sample/utils"
+)
+
+// ResponseFeed はホームタイムラインの 1 ページ分。next_cursor を cursor= に渡すと続きを読める
+type ResponseFeed struct {
+	Microposts []*ResponseMicropost `json:"microposts"`
+	NextCursor string               `json:"next_cursor,omitempty"`
+}
+
+func GetFeed(request Request) Response {
+	page, pageErr := ParsePage(request.QueryStringParameters)
+	validErr := MergeErrors(
+		ValidateParams(request.PathParameters, ValidateUserPathSettings),
+		pageErr,
+	)
+	if validErr != nil {
+		return RenderError(request, NewValidationError(*validErr))
+	}
+
+	userID, err := utils.ParseUint(request.PathParameters["user_id"])
+	if err != nil {
+		return RenderError(request, err)
+	}
+
+	_, err = models.GetUserByID(userID, "ID")
+	if err != nil {
+		return RenderError(request, err)
+	}
+
+	microposts, next, err := models.GetFeed(userID, page)
+	if err != nil {
+		return RenderError(request, err)
+	}
+
+	resMicroposts := make([]*ResponseMicropost, len(microposts))
+	for i, m := range microposts {
+		resMicroposts[i] = newResponseMicropost(m)
+	}
+
+	return Response200(&ResponseFeed{
+		Microposts: resMicroposts,
+		NextCursor: next,
+	})
+}
@@ -0,0 +1,176 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sam-book-sample/db"
+	"sam-book-sample/mocks"
+	"sam-book-sample/models"
+	"testing"
+
+	"github.com/memememomo/dbmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func getFeed(t *testing.T, a testAdapter, userID uint64, params map[string]string) *ResponseFeed {
+	t.Helper()
+
+	res := a.Invoke(GetFeed, RouteFeed, Request{
+		Method: "GET",
+		PathParameters: map[string]string{
+			"user_id": fmt.Sprintf("%d", userID),
+		},
+		QueryStringParameters: params,
+	})
+	assert.Equal(t, 200, res.StatusCode)
+
+	var body ResponseFeed
+	err := json.Unmarshal([]byte(res.Body), &body)
+	assert.NoError(t, err)
+
+	return &body
+}
+
+func feedIDs(microposts []*ResponseMicropost) []uint64 {
+	ids := make([]uint64, len(microposts))
+	for i, m := range microposts {
+		ids[i] = m.ID
+	}
+	return ids
+}
+
+func TestGetFeed(t *testing.T) {
+	// 0 にするとフォローされたユーザーはすべてフォロワーの多いユーザーとして扱われ、読むときに集める
+	for _, threshold := range []string{"", "0"} {
+		t.Run("threshold="+threshold, func(t *testing.T) {
+			os.Setenv("FEED_CELEBRITY_THRESHOLD", threshold)
+			defer os.Unsetenv("FEED_CELEBRITY_THRESHOLD")
+
+			withDefaultAdapter(t, func(t *testing.T, a testAdapter) {
+				mocks.SetupDB(t)
+				defer db.DropTable()
+
+				userMocks := mocks.User().Multi(3, mocks.E)
+				u1 := userMocks[0].(*models.User)
+				u2 := userMocks[1].(*models.User)
+				u3 := userMocks[2].(*models.User)
+
+				assert.Equal(t, 201, follow(a, u1.ID, u2.ID).StatusCode)
+				assert.Equal(t, 201, follow(a, u1.ID, u3.ID).StatusCode)
+
+				authors := []uint64{u2.ID, u3.ID, u2.ID, u1.ID}
+				mocks.Micropost().Multi(uint64(len(authors)), func(i uint64, mapper dbmock.DBMapper) dbmock.DBMapper {
+					m := mapper.(*models.Micropost)
+					m.UserID = authors[i]
+					return m
+				})
+
+				// 自分の投稿は含まず、新しい順に並ぶ
+				feed := getFeed(t, a, u1.ID, map[string]string{"limit": "2"})
+				assert.Equal(t, []uint64{3, 2}, feedIDs(feed.Microposts))
+				assert.NotEmpty(t, feed.NextCursor)
+
+				feed = getFeed(t, a, u1.ID, map[string]string{"limit": "2", "cursor": feed.NextCursor})
+				assert.Equal(t, []uint64{1}, feedIDs(feed.Microposts))
+				assert.Empty(t, feed.NextCursor)
+
+				feed = getFeed(t, a, u2.ID, nil)
+				assert.Empty(t, feed.Microposts)
+			})
+		})
+	}
+}
+
+func TestGetFeed_maxItems(t *testing.T) {
+	os.Setenv("FEED_MAX_ITEMS", "2")
+	defer os.Unsetenv("FEED_MAX_ITEMS")
+
+	withDefaultAdapter(t, func(t *testing.T, a testAdapter) {
+		mocks.SetupDB(t)
+		defer db.DropTable()
+
+		userMocks := mocks.User().Multi(2, mocks.E)
+		u1 := userMocks[0].(*models.User)
+		u2 := userMocks[1].(*models.User)
+
+		assert.Equal(t, 201, follow(a, u1.ID, u2.ID).StatusCode)
+
+		mocks.Micropost().Multi(3, func(i uint64, mapper dbmock.DBMapper) dbmock.DBMapper {
+			m := mapper.(*models.Micropost)
+			m.UserID = u2.ID
+			return m
+		})
+
+		feed := getFeed(t, a, u1.ID, map[string]string{"limit": "1"})
+		assert.Equal(t, []uint64{3}, feedIDs(feed.Microposts))
+
+		feed = getFeed(t, a, u1.ID, map[string]string{"limit": "1", "cursor": feed.NextCursor})
+		assert.Equal(t, []uint64{2}, feedIDs(feed.Microposts))
+		assert.Empty(t, feed.NextCursor)
+
+		// 末尾まで読んだので、それより古い項目は消えている
+		table, err := db.Table()
+		assert.NoError(t, err)
+		var items []models.FeedItem
+		err = table.Get(db.PKName, fmt.Sprintf("Feed-%011d", u1.ID)).All(&items)
+		assert.NoError(t, err)
+		assert.Len(t, items, 2)
+	})
+}
+
+func TestGetFeed_streamFanOut(t *testing.T) {
+	// リクエストの中では配らず、StreamConsumer が配るのを待つ
+	os.Setenv("FEED_SYNC_FAN_OUT_LIMIT", "0")
+	defer os.Unsetenv("FEED_SYNC_FAN_OUT_LIMIT")
+
+	withDefaultAdapter(t, func(t *testing.T, a testAdapter) {
+		mocks.SetupDB(t)
+		defer db.DropTable()
+
+		userMocks := mocks.User().Multi(2, mocks.E)
+		u1 := userMocks[0].(*models.User)
+		u2 := userMocks[1].(*models.User)
+
+		assert.Equal(t, 201, follow(a, u1.ID, u2.ID).StatusCode)
+
+		m := &models.Micropost{UserID: u2.ID, Content: "content"}
+		assert.NoError(t, m.Create())
+
+		feed := getFeed(t, a, u1.ID, nil)
+		assert.Empty(t, feed.Microposts)
+
+		// 同じ記録を再試行で何度受け取っても 1 件だけ並ぶ
+		assert.NoError(t, models.FanOutCreatedMicropost(m))
+		assert.NoError(t, models.FanOutCreatedMicropost(m))
+
+		feed = getFeed(t, a, u1.ID, nil)
+		assert.Equal(t, []uint64{m.ID}, feedIDs(feed.Microposts))
+	})
+}
+
+func TestGetFeed_unfollow(t *testing.T) {
+	withDefaultAdapter(t, func(t *testing.T, a testAdapter) {
+		mocks.SetupDB(t)
+		defer db.DropTable()
+
+		userMocks := mocks.User().Multi(3, mocks.E)
+		u1 := userMocks[0].(*models.User)
+		u2 := userMocks[1].(*models.User)
+		u3 := userMocks[2].(*models.User)
+
+		assert.Equal(t, 201, follow(a, u1.ID, u2.ID).StatusCode)
+		assert.Equal(t, 201, follow(a, u1.ID, u3.ID).StatusCode)
+
+		m2 := &models.Micropost{UserID: u2.ID, Content: "from u2"}
+		assert.NoError(t, m2.Create())
+		m3 := &models.Micropost{UserID: u3.ID, Content: "from u3"}
+		assert.NoError(t, m3.Create())
+
+		// フォローをやめた相手の投稿はフィードから消える
+		assert.NoError(t, models.Unfollow(u1.ID, u2.ID))
+
+		feed := getFeed(t, a, u1.ID, nil)
+		assert.Equal(t, []uint64{m3.ID}, feedIDs(feed.Microposts))
+	})
+}
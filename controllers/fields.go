@@ -0,0 +1,140 @@
+package controllers
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/validator.v2"
+)
+
+const fieldsParamName = "fields"
+
+var ErrFields = validator.TextErr{Err: errors.New("unknown fields")}
+
+// FieldsSetting は fields= で選べる項目名と DynamoDB の属性名の対応
+type FieldsSetting map[string]string
+
+var UserFieldsSetting = FieldsSetting{
+	"id":        "ID",
+	"user_name": "Name",
+	"email":     "Email",
+}
+
+var MicropostFieldsSetting = FieldsSetting{
+	"id":             "ID",
+	"user_id":        "UserID",
+	"content":        "Content",
+	"in_reply_to_id": "InReplyToID",
+	"hashtags":       "Hashtags",
+	"mentions":       "Mentions",
+	"attachments":    "Attachments",
+	"like_count":     "LikeCount",
+	"reply_count":    "ReplyCount",
+	"edited_at":      "EditedAt",
+	"revision_count": "RevisionCount",
+	"liked":          "ID",
+}
+
+// Fields は fields= で選ばれた項目。nil ならすべての項目を返す
+type Fields []string
+
+// ParseFields は fields= を setting で検証する。指定がなければ nil を返す
+func ParseFields(params map[string]string, setting FieldsSetting) (Fields, *map[string]error) {
+	value, ok := params[fieldsParamName]
+	if !ok {
+		return nil, nil
+	}
+
+	var fields Fields
+	var unknown []string
+	seen := map[string]bool{}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		if _, ok := setting[name]; !ok {
+			unknown = append(unknown, name)
+			continue
+		}
+		fields = append(fields, name)
+	}
+
+	if len(unknown) > 0 {
+		return nil, &map[string]error{
+			fieldsParamName: &ParamError{Err: ErrFields, Tag: fieldsParamName, Param: strings.Join(unknown, ",")},
+		}
+	}
+	if len(fields) == 0 {
+		return nil, &map[string]error{
+			fieldsParamName: ErrRequired,
+		}
+	}
+
+	return fields, nil
+}
+
+// Attributes は ProjectionExpression に渡す属性名を返す。extra は選ばれていなくても読む属性名。
+// すべての項目を返すときは nil
+func (f Fields) Attributes(setting FieldsSetting, extra ...string) []string {
+	if f == nil {
+		return nil
+	}
+
+	seen := map[string]bool{}
+	var attrs []string
+	for _, name := range f {
+		seen[setting[name]] = true
+	}
+	for _, attr := range extra {
+		seen[attr] = true
+	}
+	for attr := range seen {
+		attrs = append(attrs, attr)
+	}
+	sort.Strings(attrs)
+
+	return attrs
+}
+
+// Select は v を JSON にしたときの項目のうち選ばれたものだけを残し、embedded の関連リソースを加える
+func (f Fields) Select(v interface{}, embedded map[string]interface{}) (interface{}, error) {
+	if f == nil && len(embedded) == 0 {
+		return v, nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var all map[string]json.RawMessage
+	err = json.Unmarshal(b, &all)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	selected := all
+	if f != nil {
+		selected = map[string]json.RawMessage{}
+		for _, name := range f {
+			if r, ok := all[name]; ok {
+				selected[name] = r
+			}
+		}
+	}
+
+	for name, e := range embedded {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		selected[name] = b
+	}
+
+	return selected, nil
+}
@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFields(t *testing.T) {
+	cases := []struct {
+		Params   map[string]string
+		Fields   Fields
+		Attrs    []string
+		Expected map[string]error
+	}{
+		{
+			Params: map[string]string{},
+		},
+		{
+			Params: map[string]string{"fields": "user_name, id,user_name"},
+			Fields: Fields{"user_name", "id"},
+			Attrs:  []string{"ID", "Name"},
+		},
+		{
+			Params: map[string]string{"fields": "id,password,token"},
+			Expected: map[string]error{
+				"fields": &ParamError{Err: ErrFields, Tag: "fields", Param: "password,token"},
+			},
+		},
+		{
+			Params: map[string]string{"fields": ","},
+			Expected: map[string]error{
+				"fields": ErrRequired,
+			},
+		},
+	}
+
+	for i, c := range cases {
+		msg := fmt.Sprintf("Case:%d", i+1)
+
+		fields, validErr := ParseFields(c.Params, UserFieldsSetting)
+
+		if c.Expected != nil {
+			if assert.NotNil(t, validErr, msg) {
+				assert.Equal(t, c.Expected, *validErr, msg)
+			}
+			continue
+		}
+		assert.Nil(t, validErr, msg)
+		assert.Equal(t, c.Fields, fields, msg)
+		assert.Equal(t, c.Attrs, fields.Attributes(UserFieldsSetting), msg)
+	}
+}
+
+func TestFields_Select(t *testing.T) {
+	res := &UserResponse{ID: 1, Name: "hoge", Email: "hoge@example.com"}
+
+	all, err := Fields(nil).Select(res, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, res, all)
+
+	selected, err := Fields{"id", "user_name"}.Select(res, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"id":1,"user_name":"hoge"}`, Response200(selected).Body)
+
+	embedded, err := Fields{"content"}.Select(&ResponseMicropost{ID: 2, UserID: 1, Content: "hello"}, map[string]interface{}{
+		"user": res,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"content":"hello","user":{"id":1,"user_name":"hoge","email":"hoge@example.com"}}`, Response200(embedded).Body)
+}
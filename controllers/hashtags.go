@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"sam-book-sample/models"
+	"sam-book-sample/utils"
+)
+
+var ValidateHashtagPathSettings = []*ValidatorSetting{
+	{ArgName: "tag", ValidateTags: "required,max=140"},
+}
+
+// ResponseMicropostPage は索引から読んだ Micropost の 1 ページ分で、新しい順に並ぶ。
+// next_cursor を cursor= に渡すと続きを読める
+type ResponseMicropostPage struct {
+	Microposts []*ResponseMicropost `json:"microposts"`
+	NextCursor string               `json:"next_cursor,omitempty"`
+}
+
+// renderMicropostPage は GetHashtagMicroposts と GetMentions の共通部分
+func renderMicropostPage(request Request, microposts []*models.Micropost, next string) Response {
+	res := make([]*ResponseMicropost, len(microposts))
+	for i, m := range microposts {
+		res[i] = newResponseMicropost(m)
+	}
+
+	err := setLiked(request.QueryStringParameters, res)
+	if err != nil {
+		return RenderError(request, err)
+	}
+
+	return Response200(&ResponseMicropostPage{
+		Microposts: res,
+		NextCursor: next,
+	})
+}
+
+func GetHashtagMicroposts(request Request) Response {
+	page, pageErr := ParsePage(request.QueryStringParameters)
+	validErr := MergeErrors(
+		ValidateParams(request.PathParameters, ValidateHashtagPathSettings),
+		ValidateParams(request.QueryStringParameters, ValidateViewerParamSettings),
+		pageErr,
+	)
+	if validErr != nil {
+		return RenderError(request, NewValidationError(*validErr))
+	}
+
+	microposts, next, err := models.ListMicropostsByHashtag(request.PathParameters["tag"], page)
+	if err != nil {
+		return RenderError(request, err)
+	}
+
+	return renderMicropostPage(request, microposts, next)
+}
+
+func GetMentions(request Request) Response {
+	page, pageErr := ParsePage(request.QueryStringParameters)
+	validErr := MergeErrors(
+		ValidateParams(request.PathParameters, ValidateUserPathSettings),
+		ValidateParams(request.QueryStringParameters, ValidateViewerParamSettings),
+		pageErr,
+	)
+	if validErr != nil {
+		return RenderError(request, NewValidationError(*validErr))
+	}
+
+	userID, err := utils.ParseUint(request.PathParameters["user_id"])
+	if err != nil {
+		return RenderError(request, err)
+	}
+
+	microposts, next, err := models.ListMentions(userID, page)
+	if err != nil {
+		return RenderError(request, err)
+	}
+
+	return renderMicropostPage(request, microposts, next)
+}
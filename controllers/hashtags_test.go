@@ -0,0 +1,120 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sam-book-sample/db"
+	"sam-book-sample/mocks"
+	"sam-book-sample/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func getMicropostPage(t *testing.T, a testAdapter, h Handler, route string, pathParams, params map[string]string) *ResponseMicropostPage {
+	t.Helper()
+
+	res := a.Invoke(h, route, Request{
+		Method:                "GET",
+		PathParameters:        pathParams,
+		QueryStringParameters: params,
+	})
+	assert.Equal(t, 200, res.StatusCode)
+
+	var body ResponseMicropostPage
+	err := json.Unmarshal([]byte(res.Body), &body)
+	assert.NoError(t, err)
+
+	return &body
+}
+
+func pageMicropostIDs(microposts []*ResponseMicropost) []uint64 {
+	ids := make([]uint64, len(microposts))
+	for i, m := range microposts {
+		ids[i] = m.ID
+	}
+	return ids
+}
+
+func TestGetHashtagMicroposts(t *testing.T) {
+	withDefaultAdapter(t, func(t *testing.T, a testAdapter) {
+		mocks.SetupDB(t)
+		defer db.DropTable()
+
+		userMock := mocks.User().Single(0, mocks.E).(*models.User)
+
+		m1 := &models.Micropost{UserID: userMock.ID, Content: "#Go を始めた"}
+		assert.NoError(t, m1.Create())
+		m2 := &models.Micropost{UserID: userMock.ID, Content: "今日も ＃ｇｏ #test"}
+		assert.NoError(t, m2.Create())
+
+		pathParams := map[string]string{"tag": "go"}
+		page := getMicropostPage(t, a, GetHashtagMicroposts, RouteHashtagMicroposts, pathParams, map[string]string{"limit": "1"})
+		assert.Equal(t, []uint64{m2.ID}, pageMicropostIDs(page.Microposts))
+		assert.Equal(t, []string{"go", "test"}, page.Microposts[0].Hashtags)
+		assert.NotEmpty(t, page.NextCursor)
+
+		page = getMicropostPage(t, a, GetHashtagMicroposts, RouteHashtagMicroposts, pathParams, map[string]string{"limit": "1", "cursor": page.NextCursor})
+		assert.Equal(t, []uint64{m1.ID}, pageMicropostIDs(page.Microposts))
+
+		// 本文を書き換えるとハッシュタグの索引も付け替える
+		content := "#rust に乗り換えた"
+		assert.NoError(t, models.PatchMicropost(userMock.ID, m1.ID, &models.MicropostPatch{Content: &content}))
+
+		page = getMicropostPage(t, a, GetHashtagMicroposts, RouteHashtagMicroposts, pathParams, nil)
+		assert.Equal(t, []uint64{m2.ID}, pageMicropostIDs(page.Microposts))
+
+		page = getMicropostPage(t, a, GetHashtagMicroposts, RouteHashtagMicroposts, map[string]string{"tag": "#Rust"}, nil)
+		assert.Equal(t, []uint64{m1.ID}, pageMicropostIDs(page.Microposts))
+	})
+}
+
+func TestGetMentions(t *testing.T) {
+	withDefaultAdapter(t, func(t *testing.T, a testAdapter) {
+		mocks.SetupDB(t)
+		defer db.DropTable()
+
+		userMocks := mocks.User().Multi(2, mocks.E)
+		u1 := userMocks[0].(*models.User)
+		u2 := userMocks[1].(*models.User)
+
+		m := &models.Micropost{UserID: u1.ID, Content: fmt.Sprintf("＠%s さん、こんにちは", u2.Name)}
+		assert.NoError(t, m.Create())
+
+		pathParams := map[string]string{"user_id": fmt.Sprintf("%d", u2.ID)}
+		page := getMicropostPage(t, a, GetMentions, RouteMentions, pathParams, nil)
+		assert.Equal(t, []uint64{m.ID}, pageMicropostIDs(page.Microposts))
+
+		// メンションは書き込んだときのユーザーに付くので、名前を変えても引ける。同じ名前になった別のユーザーには付かない
+		u2Name := u2.Name
+		newName := "renamed"
+		assert.NoError(t, models.PatchUser(u2.ID, &models.UserPatch{Name: &newName}))
+		assert.NoError(t, models.PatchUser(u1.ID, &models.UserPatch{Name: &u2Name}))
+
+		page = getMicropostPage(t, a, GetMentions, RouteMentions, pathParams, nil)
+		assert.Equal(t, []uint64{m.ID}, pageMicropostIDs(page.Microposts))
+		page = getMicropostPage(t, a, GetMentions, RouteMentions, map[string]string{"user_id": fmt.Sprintf("%d", u1.ID)}, nil)
+		assert.Empty(t, page.Microposts)
+
+		// 名前を変えた後のメンションは、その時点でその名前のユーザーに付く
+		renamed := &models.Micropost{UserID: u1.ID, Content: "@Renamed と ＠" + u2Name}
+		assert.NoError(t, renamed.Create())
+		assert.ElementsMatch(t, []uint64{u2.ID, u1.ID}, renamed.MentionIDs)
+
+		// 知らない名前へのメンションは索引に入れない
+		unknown := &models.Micropost{UserID: u1.ID, Content: "@nobody さん"}
+		assert.NoError(t, unknown.Create())
+		assert.Empty(t, unknown.MentionIDs)
+
+		// 削除すると索引からも消える
+		assert.NoError(t, models.DeleteMicropost(m.ID))
+		page = getMicropostPage(t, a, GetMentions, RouteMentions, pathParams, nil)
+		assert.Empty(t, page.Microposts)
+
+		res := a.Invoke(GetMentions, RouteMentions, Request{
+			Method:         "GET",
+			PathParameters: map[string]string{"user_id": "100"},
+		})
+		assert.Equal(t, 404, res.StatusCode)
+	})
+}
@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/validator.v2"
+)
+
+const (
+	includeParamName = "include"
+	// include=microposts で埋め込む Micropost の件数
+	includedMicropostsLimit = 5
+)
+
+var ErrInclude = validator.TextErr{Err: errors.New("unknown include")}
+
+// IncludeSetting は include= で埋め込める関連リソースと、それを読むのに必要な DynamoDB の属性名の対応
+type IncludeSetting map[string]string
+
+var UserIncludeSetting = IncludeSetting{
+	"microposts": "ID",
+}
+
+var MicropostIncludeSetting = IncludeSetting{
+	"user":   "UserID",
+	"likers": "ID",
+}
+
+// Includes は include= で選ばれた関連リソース
+type Includes map[string]bool
+
+// ParseIncludes は include= を setting で検証する。指定がなければ空の Includes を返す
+func ParseIncludes(params map[string]string, setting IncludeSetting) (Includes, *map[string]error) {
+	includes := Includes{}
+
+	value, ok := params[includeParamName]
+	if !ok {
+		return includes, nil
+	}
+
+	var unknown []string
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || includes[name] {
+			continue
+		}
+
+		if _, ok := setting[name]; !ok {
+			unknown = append(unknown, name)
+			continue
+		}
+		includes[name] = true
+	}
+
+	if len(unknown) > 0 {
+		return nil, &map[string]error{
+			includeParamName: &ParamError{Err: ErrInclude, Tag: includeParamName, Param: strings.Join(unknown, ",")},
+		}
+	}
+
+	return includes, nil
+}
+
+// Attributes は関連リソースを読むために fields= に関係なく必要な属性名を返す
+func (i Includes) Attributes(setting IncludeSetting) []string {
+	var attrs []string
+	for name := range i {
+		attrs = append(attrs, setting[name])
+	}
+	return attrs
+}
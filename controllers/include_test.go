@@ -0,0 +1,55 @@
+package controllers
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseIncludes(t *testing.T) {
+	cases := []struct {
+		Params   map[string]string
+		Includes Includes
+		Attrs    []string
+		Expected map[string]error
+	}{
+		{
+			Params:   map[string]string{},
+			Includes: Includes{},
+		},
+		{
+			Params:   map[string]string{"include": "user,user"},
+			Includes: Includes{"user": true},
+			Attrs:    []string{"UserID"},
+		},
+		{
+			Params: map[string]string{"include": "user,comments"},
+			Expected: map[string]error{
+				"include": &ParamError{Err: ErrInclude, Tag: "include", Param: "comments"},
+			},
+		},
+	}
+
+	for i, c := range cases {
+		msg := fmt.Sprintf("Case:%d", i+1)
+
+		includes, validErr := ParseIncludes(c.Params, MicropostIncludeSetting)
+
+		if c.Expected != nil {
+			if assert.NotNil(t, validErr, msg) {
+				assert.Equal(t, c.Expected, *validErr, msg)
+			}
+			continue
+		}
+		assert.Nil(t, validErr, msg)
+		assert.Equal(t, c.Includes, includes, msg)
+		assert.Equal(t, c.Attrs, includes.Attributes(MicropostIncludeSetting), msg)
+	}
+}
+
+func TestFields_Attributes_include(t *testing.T) {
+	fields := Fields{"content"}
+	assert.Equal(t, []string{"Content", "UserID"}, fields.Attributes(MicropostFieldsSetting, "UserID"))
+	assert.Nil(t, Fields(nil).Attributes(MicropostFieldsSetting, "UserID"))
+}
@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"sam-book-sample/models"
+	"sam-book-sample/utils"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	viewerParamName = "viewer_id"
+	// include=likers で埋め込むユーザーの数
+	includedLikersLimit = 5
+)
+
+var ValidateLikerParamSettings = []*ValidatorSetting{
+	{ArgName: "liker_id", ValidateTags: "required,uint"},
+}
+
+var ValidateViewerParamSettings = []*ValidatorSetting{
+	{ArgName: viewerParamName, ValidateTags: "uint"},
+}
+
+type RequestPostLike struct {
+	LikerID *uint64 `json:"liker_id" validate:"required"`
+}
+
+// parseViewerID は viewer_id= のユーザーの ID を返す。指定がなければ false を返す
+func parseViewerID(params map[string]string) (uint64, bool, error) {
+	value := params[viewerParamName]
+	if value == "" {
+		return 0, false, nil
+	}
+
+	id, err := utils.ParseUint(value)
+	if err != nil {
+		return 0, false, errors.WithStack(err)
+	}
+
+	return id, true, nil
+}
+
+// setLiked は viewer_id= のユーザーがいいねしているかを res の liked に入れる。指定がなければ何もしない
+func setLiked(params map[string]string, res []*ResponseMicropost) error {
+	viewerID, ok, err := parseViewerID(params)
+	if err != nil || !ok {
+		return errors.WithStack(err)
+	}
+
+	ids := make([]uint64, len(res))
+	for i, r := range res {
+		ids[i] = r.ID
+	}
+
+	liked, err := models.GetLikedMicropostIDs(viewerID, ids)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, r := range res {
+		v := liked[r.ID]
+		r.Liked = &v
+	}
+
+	return nil
+}
+
+// micropostPathParams はパスの user_id と micropost_id を返す
+func micropostPathParams(request Request) (uint64, uint64, error) {
+	userID, err := utils.ParseUint(request.PathParameters["user_id"])
+	if err != nil {
+		return 0, 0, errors.WithStack(err)
+	}
+
+	micropostID, err := utils.ParseUint(request.PathParameters["micropost_id"])
+	if err != nil {
+		return 0, 0, errors.WithStack(err)
+	}
+
+	return userID, micropostID, nil
+}
+
+func PostLike(request Request) Response {
+	var req RequestPostLike
+	validErr := MergeErrors(
+		ValidateParams(request.PathParameters, ValidateMicropostPathSettings),
+		DecodeBody(request.Body, &req),
+	)
+	if validErr != nil {
+		return RenderError(request, NewValidationError(*validErr))
+	}
+
+	userID, micropostID, err := micropostPathParams(request)
+	if err != nil {
+		return RenderError(request, err)
+	}
+
+	err = models.LikeMicropost(userID, micropostID, *req.LikerID)
+	if err != nil {
+		return RenderError(request, err)
+	}
+
+	return Response201(micropostID)
+}
+
+func DeleteLike(request Request) Response {
+	validErr := MergeErrors(
+		ValidateParams(request.PathParameters, ValidateMicropostPathSettings),
+		ValidateParams(request.QueryStringParameters, ValidateLikerParamSettings),
+	)
+	if validErr != nil {
+		return RenderError(request, NewValidationError(*validErr))
+	}
+
+	userID, micropostID, err := micropostPathParams(request)
+	if err != nil {
+		return RenderError(request, err)
+	}
+
+	likerID, err := utils.ParseUint(request.QueryStringParameters["liker_id"])
+	if err != nil {
+		return RenderError(request, err)
+	}
+
+	err = models.UnlikeMicropost(userID, micropostID, likerID)
+	if err != nil {
+		return RenderError(request, err)
+	}
+
+	return Response200OK()
+}
@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sam-book-sample/db"
+	"sam-book-sample/mocks"
+	"sam-book-sample/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func like(a testAdapter, userID, micropostID, likerID uint64) Response {
+	return a.Invoke(PostLike, RouteLikes, Request{
+		Method: "POST",
+		Body:   fmt.Sprintf(`{"liker_id":%d}`, likerID),
+		PathParameters: map[string]string{
+			"user_id":      fmt.Sprintf("%d", userID),
+			"micropost_id": fmt.Sprintf("%d", micropostID),
+		},
+	})
+}
+
+func unlike(a testAdapter, userID, micropostID, likerID uint64) Response {
+	return a.Invoke(DeleteLike, RouteLikes, Request{
+		Method: "DELETE",
+		QueryStringParameters: map[string]string{
+			"liker_id": fmt.Sprintf("%d", likerID),
+		},
+		PathParameters: map[string]string{
+			"user_id":      fmt.Sprintf("%d", userID),
+			"micropost_id": fmt.Sprintf("%d", micropostID),
+		},
+	})
+}
+
+func getLikedMicropost(t *testing.T, a testAdapter, m *models.Micropost, params map[string]string) map[string]interface{} {
+	t.Helper()
+
+	res := a.Invoke(GetMicropost, RouteMicropost, Request{
+		Method:                "GET",
+		QueryStringParameters: params,
+		PathParameters: map[string]string{
+			"user_id":      fmt.Sprintf("%d", m.UserID),
+			"micropost_id": fmt.Sprintf("%d", m.ID),
+		},
+	})
+	assert.Equal(t, 200, res.StatusCode)
+
+	var body map[string]interface{}
+	err := json.Unmarshal([]byte(res.Body), &body)
+	assert.NoError(t, err)
+
+	return body
+}
+
+func TestLike(t *testing.T) {
+	withDefaultAdapter(t, func(t *testing.T, a testAdapter) {
+		mocks.SetupDB(t)
+		defer db.DropTable()
+
+		userMocks := mocks.User().Multi(2, mocks.E)
+		u1 := userMocks[0].(*models.User)
+		u2 := userMocks[1].(*models.User)
+
+		micropost := &models.Micropost{UserID: u1.ID, Content: "hello"}
+		assert.NoError(t, micropost.Create())
+
+		// 二度いいねしても数は変わらない
+		assert.Equal(t, 201, like(a, u1.ID, micropost.ID, u2.ID).StatusCode)
+		assert.Equal(t, 201, like(a, u1.ID, micropost.ID, u2.ID).StatusCode)
+
+		body := getLikedMicropost(t, a, micropost, map[string]string{
+			"fields":    "like_count,liked",
+			"include":   "likers",
+			"viewer_id": fmt.Sprintf("%d", u2.ID),
+		})
+		assert.Equal(t, map[string]interface{}{
+			"like_count": float64(1),
+			"liked":      true,
+			"likers": []interface{}{
+				map[string]interface{}{
+					"id":        float64(u2.ID),
+					"user_name": u2.Name,
+					"email":     u2.Email,
+				},
+			},
+		}, body)
+
+		body = getLikedMicropost(t, a, micropost, map[string]string{"viewer_id": fmt.Sprintf("%d", u1.ID)})
+		assert.Equal(t, false, body["liked"])
+
+		// いいねは版を進めないので、読んだ後にいいねされても編集でき、数も上書きしない
+		stale, err := models.GetMicropostByID(micropost.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, 201, like(a, u1.ID, micropost.ID, u1.ID).StatusCode)
+		stale.Content = "edited"
+		assert.NoError(t, stale.Update())
+
+		body = getLikedMicropost(t, a, micropost, nil)
+		assert.Equal(t, "edited", body["content"])
+		assert.Equal(t, float64(2), body["like_count"])
+
+		assert.Equal(t, 200, unlike(a, u1.ID, micropost.ID, u2.ID).StatusCode)
+		assert.Equal(t, 200, unlike(a, u1.ID, micropost.ID, u2.ID).StatusCode)
+
+		body = getLikedMicropost(t, a, micropost, nil)
+		assert.Equal(t, float64(1), body["like_count"])
+		assert.NotContains(t, body, "liked")
+	})
+}
+
+func TestLike_404(t *testing.T) {
+	withDefaultAdapter(t, func(t *testing.T, a testAdapter) {
+		mocks.SetupDB(t)
+		defer db.DropTable()
+
+		userMocks := mocks.User().Multi(2, mocks.E)
+		u1 := userMocks[0].(*models.User)
+		u2 := userMocks[1].(*models.User)
+
+		micropost := &models.Micropost{UserID: u1.ID, Content: "hello"}
+		assert.NoError(t, micropost.Create())
+
+		assert.Equal(t, 404, like(a, u2.ID, micropost.ID, u2.ID).StatusCode)
+		assert.Equal(t, 404, like(a, u1.ID, micropost.ID+1, u2.ID).StatusCode)
+		// 存在しないユーザーのいいねは記録しない
+		assert.Equal(t, 404, like(a, u1.ID, micropost.ID, u2.ID+100).StatusCode)
+		assert.Equal(t, 404, unlike(a, u2.ID, micropost.ID, u2.ID).StatusCode)
+
+		res := a.Invoke(DeleteLike, RouteLikes, Request{
+			Method: "DELETE",
+			PathParameters: map[string]string{
+				"user_id":      fmt.Sprintf("%d", u1.ID),
+				"micropost_id": fmt.Sprintf("%d", micropost.ID),
+			},
+		})
+		assert.Equal(t, 400, res.StatusCode)
+	})
+}
@@ -0,0 +1,155 @@
+package controllers
+
+import (
+	"reflect"
+	"sam-book-sample/models"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/validator.v2"
+)
+
+const sortParamName = "sort"
+
+var (
+	ErrSort     = validator.TextErr{Err: errors.New("unknown sort")}
+	ErrDatetime = validator.TextErr{Err: errors.New("invalid datetime")}
+)
+
+// FilterSetting は絞り込みのパラメータ。Value は検証済みの値を比較する値にする。nil ならそのまま使う
+type FilterSetting struct {
+	Attr         string
+	Op           models.FilterOp
+	ValidateTags string
+	Value        func(v string) interface{}
+}
+
+// ListSetting は一覧で sort= に指定できる項目と絞り込みのパラメータ。
+// Sorts は項目名と DynamoDB の属性名の対応
+type ListSetting struct {
+	Sorts   map[string]string
+	Filters map[string]*FilterSetting
+}
+
+var UserListSetting = &ListSetting{
+	Sorts: map[string]string{
+		"id":         "ID",
+		"user_name":  "Name",
+		"created_at": "CreatedAt",
+	},
+	Filters: map[string]*FilterSetting{
+		"name_prefix": {Attr: "Name", Op: models.FilterBeginsWith, ValidateTags: "required"},
+		// DynamoDB には後方一致がないので "@" を付けて含むかどうかで比べる
+		"email_domain": {Attr: "Email", Op: models.FilterContains, ValidateTags: "required", Value: func(v string) interface{} {
+			return "@" + v
+		}},
+		"created_after": {Attr: "CreatedAt", Op: models.FilterAfter, ValidateTags: "required,datetime", Value: parseDatetime},
+	},
+}
+
+var MicropostListSetting = &ListSetting{
+	Sorts: map[string]string{
+		"id":         "ID",
+		"created_at": "CreatedAt",
+	},
+	Filters: map[string]*FilterSetting{
+		"content_contains": {Attr: "Content", Op: models.FilterContains, ValidateTags: "required"},
+		"created_after":    {Attr: "CreatedAt", Op: models.FilterAfter, ValidateTags: "required,datetime", Value: parseDatetime},
+	},
+}
+
+// ParseListOptions は sort= と絞り込みのパラメータを setting で検証する。
+// sort= は "-created_at" のように先頭に "-" を付けると降順になる
+func ParseListOptions(params map[string]string, setting *ListSetting) (*models.ListOptions, *map[string]error) {
+	opts := &models.ListOptions{}
+	errs := map[string]error{}
+
+	if value, ok := params[sortParamName]; ok {
+		name := strings.TrimPrefix(value, "-")
+		attr, ok := setting.Sorts[name]
+		switch {
+		case name == "":
+			errs[sortParamName] = ErrRequired
+		case !ok:
+			errs[sortParamName] = &ParamError{Err: ErrSort, Tag: sortParamName, Param: name}
+		default:
+			opts.SortAttr = attr
+			opts.Desc = strings.HasPrefix(value, "-")
+		}
+	}
+
+	// 結果の meta が毎回同じ順になるようにパラメータ名の順で並べる
+	var names []string
+	for name := range setting.Filters {
+		if _, ok := params[name]; ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	values := map[string]interface{}{}
+	var settings []*ValidatorSetting
+	for _, name := range names {
+		values[name] = params[name]
+		settings = append(settings, &ValidatorSetting{ArgName: name, ValidateTags: setting.Filters[name].ValidateTags})
+	}
+	if validErr := Validate(values, settings); validErr != nil {
+		for name, err := range *validErr {
+			errs[name] = err
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, &errs
+	}
+
+	for _, name := range names {
+		fs := setting.Filters[name]
+		var v interface{} = params[name]
+		if fs.Value != nil {
+			v = fs.Value(params[name])
+		}
+		opts.Filters = append(opts.Filters, &models.Filter{Name: name, Attr: fs.Attr, Op: fs.Op, Value: v})
+	}
+
+	return opts, nil
+}
+
+// listAttributes は並べ替えのために fields= に関係なく必要な属性名を返す。同じ値は ID で並べる
+func listAttributes(opts *models.ListOptions) []string {
+	attrs := []string{"ID"}
+	if opts.SortAttr != "" {
+		attrs = append(attrs, opts.SortAttr)
+	}
+	return attrs
+}
+
+func parseDatetime(v string) interface{} {
+	t, _ := time.Parse(time.RFC3339, v)
+	return t
+}
+
+func datetimeValidator(v interface{}, param string) error {
+	if v == nil {
+		return nil
+	}
+
+	st := reflect.ValueOf(v)
+
+	if st.Kind() != reflect.String {
+		return validator.ErrUnsupported
+	}
+
+	if st.String() == "" {
+		return nil
+	}
+
+	_, err := time.Parse(time.RFC3339, st.String())
+	if err != nil {
+		return ErrDatetime
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"fmt"
+	"sam-book-sample/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseListOptions(t *testing.T) {
+	cases := []struct {
+		Params   map[string]string
+		Opts     *models.ListOptions
+		Attrs    []string
+		Expected map[string]error
+	}{
+		{
+			Params: map[string]string{},
+			Opts:   &models.ListOptions{},
+			Attrs:  []string{"ID"},
+		},
+		{
+			Params: map[string]string{
+				"sort":          "-created_at",
+				"name_prefix":   "Name",
+				"email_domain":  "example.com",
+				"created_after": "2019-04-01T09:00:00+09:00",
+			},
+			Opts: &models.ListOptions{
+				SortAttr: "CreatedAt",
+				Desc:     true,
+				Filters: []*models.Filter{
+					{Name: "created_after", Attr: "CreatedAt", Op: models.FilterAfter, Value: time.Date(2019, 4, 1, 9, 0, 0, 0, time.FixedZone("", 9*60*60))},
+					{Name: "email_domain", Attr: "Email", Op: models.FilterContains, Value: "@example.com"},
+					{Name: "name_prefix", Attr: "Name", Op: models.FilterBeginsWith, Value: "Name"},
+				},
+			},
+			Attrs: []string{"ID", "CreatedAt"},
+		},
+		{
+			Params: map[string]string{"sort": "email", "created_after": "yesterday", "name_prefix": ""},
+			Expected: map[string]error{
+				"sort":          &ParamError{Err: ErrSort, Tag: "sort", Param: "email"},
+				"created_after": ErrDatetime,
+				"name_prefix":   ErrRequired,
+			},
+		},
+		{
+			Params: map[string]string{"sort": "-"},
+			Expected: map[string]error{
+				"sort": ErrRequired,
+			},
+		},
+	}
+
+	for i, c := range cases {
+		msg := fmt.Sprintf("Case:%d", i+1)
+
+		opts, validErr := ParseListOptions(c.Params, UserListSetting)
+
+		if c.Expected != nil {
+			if assert.NotNil(t, validErr, msg) {
+				assert.Equal(t, c.Expected, *validErr, msg)
+			}
+			continue
+		}
+		assert.Nil(t, validErr, msg)
+		assert.Equal(t, c.Opts.SortAttr, opts.SortAttr, msg)
+		assert.Equal(t, c.Opts.Desc, opts.Desc, msg)
+		if assert.Len(t, opts.Filters, len(c.Opts.Filters), msg) {
+			for j, f := range c.Opts.Filters {
+				assert.Equal(t, f.Name, opts.Filters[j].Name, msg)
+				assert.Equal(t, f.Attr, opts.Filters[j].Attr, msg)
+				assert.Equal(t, f.Op, opts.Filters[j].Op, msg)
+				if tm, ok := f.Value.(time.Time); ok {
+					assert.True(t, tm.Equal(opts.Filters[j].Value.(time.Time)), msg)
+					continue
+				}
+				assert.Equal(t, f.Value, opts.Filters[j].Value, msg)
+			}
+		}
+		assert.Equal(t, c.Attrs, listAttributes(opts), msg)
+	}
+}
+
+func TestParseListOptions_micropost(t *testing.T) {
+	_, validErr := ParseListOptions(map[string]string{"name_prefix": "Name", "sort": "user_name"}, MicropostListSetting)
+	if assert.NotNil(t, validErr) {
+		assert.Equal(t, map[string]error{
+			"sort": &ParamError{Err: ErrSort, Tag: "sort", Param: "user_name"},
+		}, *validErr)
+	}
+}
@@ -1,45 +1,105 @@
 package controllers
 
 import (
-	"fmt"
+	"sam-book-sample/i18n"
+	"strings"
 
 	"gopkg.in/validator.v2"
 )
 
-var validateErrorMessages = map[error]string{
-	validator.ErrUnsupported: "%sは不正な値です。",
-	validator.ErrZeroValue:   "%sを入力してください。",
-	validator.ErrLen:         "%sの文字列長が不正です。",
-	validator.ErrMax:         "%sの文字数が上限を超えています。",
-	ErrRequired:              "%sを入力してください。",
-	ErrEmail:                 "%sの形式が不正です。",
-	ErrUint:                  "%sは0以上の数値を入力してください。",
-	ErrUniq:                  "すでに登録されている%sです。",
+// validateErrorCodes はクライアント向けのエラーコード。メッセージは "validation.<code>" で引く
+var validateErrorCodes = map[error]string{
+	validator.ErrUnsupported: "unsupported",
+	validator.ErrZeroValue:   "required",
+	validator.ErrLen:         "len",
+	validator.ErrMin:         "min",
+	validator.ErrMax:         "max",
+	ErrRequired:              "required",
+	ErrEmail:                 "email",
+	ErrUint:                  "uint",
+	ErrUniq:                  "unique",
+	ErrBody:                  "body",
+	ErrType:                  "type",
+	ErrUnknownField:          "unknown_field",
+	ErrFields:                "fields",
+	ErrInclude:               "include",
+	ErrSort:                  "sort",
+	ErrDatetime:              "datetime",
+	ErrLimit:                 "limit",
+	ErrCursor:                "cursor",
+	ErrSelfFollow:            "self_follow",
+	ErrInReplyTo:             "in_reply_to",
+	ErrContentType:           "content_type",
+	ErrAttachmentSize:        "attachment_size",
+	ErrAttachmentCount:       "attachment_count",
+	ErrAttachment:            "attachment",
+	ErrModeration:            "moderation",
+	ErrPublishAt:             "publish_at",
 }
 
-var displayNames = map[string]string{
-	"user_id":      "ユーザーID",
-	"user_name":    "ユーザー名",
-	"micropost_id": "マイクロポストID",
-	"email":        "メールアドレス",
-	"content":      "本文",
+type FieldError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
 }
 
-func ConvertErrorsToMessage(errs map[string]error) map[string]string {
+func localizerFor(request Request) *i18n.Localizer {
+	return i18n.NewLocalizer(request.Header("Accept-Language"))
+}
+
+// fieldNameOf は "items[0].name" から表示名を引くための "name" を取り出す
+func fieldNameOf(path string) string {
+	name := path[strings.LastIndex(path, ".")+1:]
+	if i := strings.Index(name, "["); i >= 0 {
+		return name[:i]
+	}
+	return name
+}
+
+func newFieldError(l *i18n.Localizer, argName string, err error) *FieldError {
+	params := i18n.Params{
+		"field": l.Field(fieldNameOf(argName)),
+	}
+
+	if pe, ok := err.(*ParamError); ok {
+		err = pe.Err
+		params[pe.Tag] = pe.Param
+		params["count"] = pe.Param
+	}
+
+	code, ok := validateErrorCodes[err]
+	if !ok {
+		return &FieldError{
+			Code:    "invalid",
+			Message: err.Error(),
+		}
+	}
+
+	return &FieldError{
+		Code:    code,
+		Message: l.Message("validation."+code, params),
+	}
+}
+
+// ConvertErrorsToMessage は項目ごとに最初のエラーのメッセージを返す
+func ConvertErrorsToMessage(l *i18n.Localizer, errs map[string]error) map[string]string {
 	messages := map[string]string{}
 
 	for argName, err := range errs {
-		disp := displayNames[argName]
-		if disp == "" {
+		messages[argName] = newFieldError(l, argName, errorList(err)[0]).Message
+	}
 
-		}
-		message := validateErrorMessages[err]
-		if message == "" {
-			messages[argName] = err.Error()
-		} else {
-			messages[argName] = fmt.Sprintf(message, disp)
+	return messages
+}
+
+// ConvertErrorsToFieldErrors は項目ごとにすべてのエラーをコード付きで返す
+func ConvertErrorsToFieldErrors(l *i18n.Localizer, errs map[string]error) map[string][]*FieldError {
+	details := map[string][]*FieldError{}
+
+	for argName, err := range errs {
+		for _, e := range errorList(err) {
+			details[argName] = append(details[argName], newFieldError(l, argName, e))
 		}
 	}
 
-	return messages
+	return details
 }
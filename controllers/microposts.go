@@ -1,167 +1,412 @@
 package controllers
 
 import (
-	"encoding/json"
 	"sam-book-sample/models"
 	"sam-book-sample/utils"
+	"time"
 
-	"github.com/aws/aws-lambda-go/events"
+	"github.com/pkg/errors"
 )
 
-var ValidateMicropostSettings = []*ValidatorSetting{
-	{ArgName: "content", ValidateTags: "required,max=140"},
+// POST .../microposts が 202 で返す status
+const (
+	acceptedPendingReview = "pending_review"
+	acceptedScheduled     = "scheduled"
+)
+
+var ValidateMicropostsPathSettings = []*ValidatorSetting{
+	{ArgName: "user_id", ValidateTags: "required,uint"},
+}
+
+var ValidateMicropostPathSettings = []*ValidatorSetting{
+	{ArgName: "user_id", ValidateTags: "required,uint"},
+	{ArgName: "micropost_id", ValidateTags: "required,uint"},
 }
 
+// RequestMicropost の attachment_ids には POST /attachments で受け付けてアップロードを済ませたファイルを指定する
 type RequestMicropost struct {
-	Content string `json:"content"`
+	Content       string   `json:"content" validate:"required,max=140"`
+	AttachmentIDs []uint64 `json:"attachment_ids"`
 }
 
+// RequestPostMicropost の in_reply_to_id を指定すると、その Micropost への返信になる。
+// publish_at に未来の日時を指定すると、その日時まで公開しない予約投稿になる
 type RequestPostMicropost struct {
 	RequestMicropost
+	InReplyToID *uint64    `json:"in_reply_to_id"`
+	PublishAt   *time.Time `json:"publish_at"`
 }
 
 type RequestPutMicropost struct {
 	RequestMicropost
 }
 
+// RequestPatchMicropost は merge patch の body。含まれていない項目は nil になる
+type RequestPatchMicropost struct {
+	Content *string `json:"content" validate:"required,max=140"`
+}
+
+// ResponseMicropost の liked は viewer_id= のユーザーがいいねしているか。viewer_id= がなければ含めない。
+// in_reply_to_id と hashtags と mentions と attachments は値があるときだけ含める。
+// edited_at は本文を編集したときだけ含め、revision_count は GET .../revisions で読める編集前の本文の数
 type ResponseMicropost struct {
-	ID      uint64 `json:"id"`
-	UserID  uint64 `json:"user_id"`
-	Content string `json:"content"`
+	ID          uint64                `json:"id"`
+	UserID      uint64                `json:"user_id"`
+	Content     string                `json:"content"`
+	InReplyToID uint64                `json:"in_reply_to_id,omitempty"`
+	Hashtags    []string              `json:"hashtags,omitempty"`
+	Mentions    []string              `json:"mentions,omitempty"`
+	Attachments []*ResponseAttachment `json:"attachments,omitempty"`
+	LikeCount   int64                 `json:"like_count"`
+	ReplyCount  int64                 `json:"reply_count"`
+	Liked       *bool                 `json:"liked,omitempty"`
+
+	EditedAt      *time.Time `json:"edited_at,omitempty"`
+	RevisionCount int64      `json:"revision_count"`
 }
 
+// ResponseMicroposts の要素は fields= で項目を絞った ResponseMicropost
 type ResponseMicroposts struct {
-	Microposts []*ResponseMicropost `json:"microposts"`
+	Microposts []interface{}    `json:"microposts"`
+	Meta       *models.ListMeta `json:"meta"`
 }
 
-func PostMicroposts(request events.APIGatewayProxyRequest) events.APIGatewayProxyResponse {
-	validErr := ValidateBody(request.Body, ValidateMicropostSettings)
+func newResponseMicropost(m *models.Micropost) *ResponseMicropost {
+	var editedAt *time.Time
+	if !m.EditedAt.IsZero() {
+		editedAt = &m.EditedAt
+	}
+
+	return &ResponseMicropost{
+		ID:          m.ID,
+		UserID:      m.UserID,
+		Content:     m.Content,
+		InReplyToID: m.InReplyToID,
+		Hashtags:    m.Hashtags,
+		Mentions:    m.Mentions,
+		Attachments: newResponseAttachments(m.Attachments),
+		LikeCount:   m.LikeCount,
+		ReplyCount:  m.ReplyCount,
+
+		EditedAt:      editedAt,
+		RevisionCount: m.RevisionCount,
+	}
+}
+
+func PostMicroposts(request Request) Response {
+	var req RequestPostMicropost
+	validErr := MergeErrors(
+		ValidateParams(request.PathParameters, ValidateMicropostsPathSettings),
+		DecodeBody(request.Body, &req),
+	)
+	// 引数を評価する順序は決まっていないので、req のフィールドはデコードしてから検証する
+	validErr = MergeErrors(
+		validErr,
+		validateAttachmentIDs(req.AttachmentIDs),
+		validatePublishAt(req.PublishAt),
+	)
 	if validErr != nil {
-		return Response400(*validErr)
+		return RenderError(request, NewValidationError(*validErr))
 	}
 
 	userID, err := utils.ParseUint(request.PathParameters["user_id"])
 	if err != nil {
-		return Response500(err)
+		return RenderError(request, err)
 	}
 
-	var req RequestPostMicropost
-	err = json.Unmarshal([]byte(request.Body), &req)
+	attachments, err := models.GetUploadedAttachments(userID, req.AttachmentIDs)
 	if err != nil {
-		return Response500(err)
+		return RenderError(request, err)
 	}
 
 	micropost := &models.Micropost{
-		UserID:  userID,
-		Content: req.Content,
+		UserID:      userID,
+		Content:     req.Content,
+		Attachments: attachments,
+	}
+	if req.InReplyToID != nil {
+		micropost.InReplyToID = *req.InReplyToID
+	}
+
+	if req.PublishAt != nil {
+		scheduled, err := models.ScheduleMicropost(micropost, *req.PublishAt)
+		if err != nil {
+			return RenderError(request, err)
+		}
+		return Response202(scheduled.ID, acceptedScheduled)
 	}
 
-	err = micropost.Create()
+	held, err := models.SubmitMicropost(micropost)
 	if err != nil {
-		return Response500(err)
+		return RenderError(request, err)
+	}
+	if held != nil {
+		return Response202(held.ID, acceptedPendingReview)
 	}
 
 	return Response201(micropost.ID)
 }
 
-func PutMicropost(request events.APIGatewayProxyRequest) events.APIGatewayProxyResponse {
-	validErr := ValidateBody(request.Body, ValidateMicropostSettings)
+func PutMicropost(request Request) Response {
+	var req RequestPutMicropost
+	validErr := MergeErrors(
+		ValidateParams(request.PathParameters, ValidateMicropostPathSettings),
+		DecodeBody(request.Body, &req),
+	)
+	validErr = MergeErrors(validErr, validateAttachmentIDs(req.AttachmentIDs))
 	if validErr != nil {
-		return Response400(*validErr)
+		return RenderError(request, NewValidationError(*validErr))
 	}
 
 	userID, err := utils.ParseUint(request.PathParameters["user_id"])
 	if err != nil {
-		return Response500(err)
-	}
-
-	var req RequestPutMicropost
-	err = json.Unmarshal([]byte(request.Body), &req)
-	if err != nil {
-		return Response500(err)
+		return RenderError(request, err)
 	}
 
 	id, err := utils.ParseUint(request.PathParameters["micropost_id"])
 	if err != nil {
-		return Response500(err)
+		return RenderError(request, err)
 	}
 
 	micropost, err := models.GetMicropostByID(id)
 	if err != nil {
-		return Response500(err)
+		return RenderError(request, err)
 	}
-	if micropost == nil {
-		return Response404()
+
+	attachments, err := models.GetUploadedAttachments(userID, req.AttachmentIDs)
+	if err != nil {
+		return RenderError(request, err)
 	}
 
 	micropost.UserID = userID
 	micropost.Content = req.Content
+	micropost.Attachments = attachments
+
+	err = models.CheckMicropostContent(micropost)
+	if err != nil {
+		return RenderError(request, err)
+	}
 
 	err = micropost.Update()
 	if err != nil {
-		return Response500(err)
+		return RenderError(request, err)
+	}
+
+	return Response200OK()
+}
+
+func PatchMicropost(request Request) Response {
+	var req RequestPatchMicropost
+	validErr := MergeErrors(
+		ValidateParams(request.PathParameters, ValidateMicropostPathSettings),
+		DecodePatch(request.Body, &req),
+	)
+	if validErr != nil {
+		return RenderError(request, NewValidationError(*validErr))
+	}
+
+	userID, err := utils.ParseUint(request.PathParameters["user_id"])
+	if err != nil {
+		return RenderError(request, err)
+	}
+
+	id, err := utils.ParseUint(request.PathParameters["micropost_id"])
+	if err != nil {
+		return RenderError(request, err)
+	}
+
+	if req.Content != nil {
+		err = models.CheckMicropostContent(&models.Micropost{UserID: userID, Content: *req.Content})
+		if err != nil {
+			return RenderError(request, err)
+		}
+	}
+
+	err = models.PatchMicropost(userID, id, &models.MicropostPatch{
+		Content: req.Content,
+	})
+	if err != nil {
+		return RenderError(request, err)
 	}
 
 	return Response200OK()
 }
 
-func GetMicroposts(request events.APIGatewayProxyRequest) events.APIGatewayProxyResponse {
+// loadMicropostIncludes は include= の関連リソースを Micropost の ID ごとに読む
+func loadMicropostIncludes(microposts []*models.Micropost, includes Includes) (map[uint64]map[string]interface{}, error) {
+	embedded := map[uint64]map[string]interface{}{}
+	if !includes["user"] && !includes["likers"] {
+		return embedded, nil
+	}
+
+	var userIDs []uint64
+	seen := map[uint64]bool{}
+	addUserID := func(id uint64) {
+		if !seen[id] {
+			seen[id] = true
+			userIDs = append(userIDs, id)
+		}
+	}
+
+	likerIDs := map[uint64][]uint64{}
+	for _, m := range microposts {
+		if includes["user"] {
+			addUserID(m.UserID)
+		}
+		if includes["likers"] {
+			ids, err := models.GetLikerIDs(m.ID, includedLikersLimit)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			likerIDs[m.ID] = ids
+			for _, id := range ids {
+				addUserID(id)
+			}
+		}
+	}
+
+	users, err := models.GetUsersByIDs(userIDs)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	for _, m := range microposts {
+		e := map[string]interface{}{}
+		if includes["user"] {
+			var resUser *UserResponse
+			if u, ok := users[m.UserID]; ok {
+				resUser = newUserResponse(u)
+			}
+			e["user"] = resUser
+		}
+		if includes["likers"] {
+			resLikers := []*UserResponse{}
+			for _, id := range likerIDs[m.ID] {
+				if u, ok := users[id]; ok {
+					resLikers = append(resLikers, newUserResponse(u))
+				}
+			}
+			e["likers"] = resLikers
+		}
+		embedded[m.ID] = e
+	}
+
+	return embedded, nil
+}
+
+func GetMicroposts(request Request) Response {
+	fields, fieldsErr := ParseFields(request.QueryStringParameters, MicropostFieldsSetting)
+	includes, includeErr := ParseIncludes(request.QueryStringParameters, MicropostIncludeSetting)
+	opts, listErr := ParseListOptions(request.QueryStringParameters, MicropostListSetting)
+	validErr := MergeErrors(
+		ValidateParams(request.PathParameters, ValidateMicropostsPathSettings),
+		ValidateParams(request.QueryStringParameters, ValidateViewerParamSettings),
+		fieldsErr,
+		includeErr,
+		listErr,
+	)
+	if validErr != nil {
+		return RenderError(request, NewValidationError(*validErr))
+	}
+
 	userID, err := utils.ParseUint(request.PathParameters["user_id"])
 	if err != nil {
-		return Response500(err)
+		return RenderError(request, err)
+	}
+
+	extra := append(includes.Attributes(MicropostIncludeSetting), listAttributes(opts)...)
+	attrs := fields.Attributes(MicropostFieldsSetting, extra...)
+	microposts, meta, err := models.ListMicropostsByUserID(userID, opts, attrs...)
+	if err != nil {
+		return RenderError(request, err)
 	}
 
-	microposts, err := models.GetMicropostsByUserID(userID)
+	embedded, err := loadMicropostIncludes(microposts, includes)
 	if err != nil {
-		return Response500(err)
+		return RenderError(request, err)
 	}
 
-	var resMicroposts = make([]*ResponseMicropost, len(microposts))
+	res := make([]*ResponseMicropost, len(microposts))
 	for i, m := range microposts {
-		resMicroposts[i] = &ResponseMicropost{
-			ID:      m.ID,
-			UserID:  m.UserID,
-			Content: m.Content,
+		res[i] = newResponseMicropost(m)
+	}
+
+	err = setLiked(request.QueryStringParameters, res)
+	if err != nil {
+		return RenderError(request, err)
+	}
+
+	var resMicroposts = make([]interface{}, len(microposts))
+	for i, r := range res {
+		resMicroposts[i], err = fields.Select(r, embedded[r.ID])
+		if err != nil {
+			return RenderError(request, err)
 		}
 	}
 
 	return Response200(&ResponseMicroposts{
 		Microposts: resMicroposts,
+		Meta:       meta,
 	})
 }
 
-func GetMicropost(request events.APIGatewayProxyRequest) events.APIGatewayProxyResponse {
+func GetMicropost(request Request) Response {
+	fields, fieldsErr := ParseFields(request.QueryStringParameters, MicropostFieldsSetting)
+	includes, includeErr := ParseIncludes(request.QueryStringParameters, MicropostIncludeSetting)
+	validErr := MergeErrors(
+		ValidateParams(request.PathParameters, ValidateMicropostPathSettings),
+		ValidateParams(request.QueryStringParameters, ValidateViewerParamSettings),
+		fieldsErr,
+		includeErr,
+	)
+	if validErr != nil {
+		return RenderError(request, NewValidationError(*validErr))
+	}
+
 	micropostID, err := utils.ParseUint(request.PathParameters["micropost_id"])
 	if err != nil {
-		return Response500(err)
+		return RenderError(request, err)
 	}
 
-	micropost, err := models.GetMicropostByID(micropostID)
+	attrs := fields.Attributes(MicropostFieldsSetting, includes.Attributes(MicropostIncludeSetting)...)
+	micropost, err := models.GetMicropostByID(micropostID, attrs...)
 	if err != nil {
-		return Response500(err)
+		return RenderError(request, err)
 	}
-	if micropost == nil {
-		return Response404()
+
+	embedded, err := loadMicropostIncludes([]*models.Micropost{micropost}, includes)
+	if err != nil {
+		return RenderError(request, err)
 	}
 
-	res := &ResponseMicropost{
-		ID:      micropost.ID,
-		Content: micropost.Content,
-		UserID:  micropost.UserID,
+	resMicropost := newResponseMicropost(micropost)
+	err = setLiked(request.QueryStringParameters, []*ResponseMicropost{resMicropost})
+	if err != nil {
+		return RenderError(request, err)
+	}
+
+	res, err := fields.Select(resMicropost, embedded[micropost.ID])
+	if err != nil {
+		return RenderError(request, err)
 	}
 
 	return Response200(res)
 }
 
-func DeleteMicropost(request events.APIGatewayProxyRequest) events.APIGatewayProxyResponse {
+func DeleteMicropost(request Request) Response {
+	validErr := ValidateParams(request.PathParameters, ValidateMicropostPathSettings)
+	if validErr != nil {
+		return RenderError(request, NewValidationError(*validErr))
+	}
+
 	id, err := utils.ParseUint(request.PathParameters["micropost_id"])
 	if err != nil {
-		return Response500(err)
+		return RenderError(request, err)
 	}
 
 	err = models.DeleteMicropost(id)
 	if err != nil {
-		return Response500(err)
+		return RenderError(request, err)
 	}
 
 	return Response200OK()
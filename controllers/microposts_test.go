@@ -12,263 +12,478 @@ import (
 	"github.com/memememomo/dbmock"
 
 	"github.com/stretchr/testify/assert"
-
-	"github.com/aws/aws-lambda-go/events"
 )
 
 func TestPostMicroposts_201(t *testing.T) {
-	mocks.SetupDB(t)
-	defer db.DropTable()
-
-	body := map[string]interface{}{
-		"content": strings.Repeat("a", 140),
-	}
-	bodyStr, err := json.Marshal(body)
-	assert.NoError(t, err)
-
-	userID := uint64(1)
-
-	res := PostMicroposts(events.APIGatewayProxyRequest{
-		Body: string(bodyStr),
-		PathParameters: map[string]string{
-			"user_id": fmt.Sprintf("%d", userID),
-		},
-	})
+	forEachAdapter(t, func(t *testing.T, a testAdapter) {
+		mocks.SetupDB(t)
+		defer db.DropTable()
+
+		body := map[string]interface{}{
+			"content": strings.Repeat("a", 140),
+		}
+		bodyStr, err := json.Marshal(body)
+		assert.NoError(t, err)
 
-	assert.Equal(t, 201, res.StatusCode)
+		userID := uint64(1)
 
-	var resBody map[string]interface{}
-	err = json.Unmarshal([]byte(res.Body), &resBody)
-	assert.NoError(t, err)
+		res := a.Invoke(PostMicroposts, RouteMicroposts, Request{
+			Method: "POST",
+			Body:   string(bodyStr),
+			PathParameters: map[string]string{
+				"user_id": fmt.Sprintf("%d", userID),
+			},
+		})
 
-	id := uint64(resBody["id"].(float64))
-	assert.Equal(t, uint64(1), id)
+		assert.Equal(t, 201, res.StatusCode)
 
-	micropost, err := models.GetMicropostByID(id)
-	assert.NoError(t, err)
-	assert.Equal(t, body["content"].(string), micropost.Content)
-	assert.Equal(t, userID, micropost.UserID)
+		var resBody map[string]interface{}
+		err = json.Unmarshal([]byte(res.Body), &resBody)
+		assert.NoError(t, err)
+
+		id := uint64(resBody["id"].(float64))
+		assert.Equal(t, uint64(1), id)
+
+		micropost, err := models.GetMicropostByID(id)
+		assert.NoError(t, err)
+		assert.Equal(t, body["content"].(string), micropost.Content)
+		assert.Equal(t, userID, micropost.UserID)
+	})
 }
 
 func TestPostMicroposts_400(t *testing.T) {
-	mocks.SetupDB(t)
-	defer db.DropTable()
-
-	cases := []struct {
-		Request  map[string]interface{}
-		Expected map[string]interface{}
-	}{
-		{
-			Request: map[string]interface{}{
-				"content": "",
-			},
-			Expected: map[string]interface{}{
-				"content": "本文を入力してください。",
+	forEachAdapter(t, func(t *testing.T, a testAdapter) {
+		mocks.SetupDB(t)
+		defer db.DropTable()
+
+		cases := []struct {
+			Request  map[string]interface{}
+			Expected map[string]interface{}
+		}{
+			{
+				Request: map[string]interface{}{
+					"content": "",
+				},
+				Expected: map[string]interface{}{
+					"content": "本文を入力してください。",
+				},
 			},
-		},
-		{
-			Request: map[string]interface{}{
-				"content": strings.Repeat("a", 141),
+			{
+				Request: map[string]interface{}{
+					"content": strings.Repeat("a", 141),
+				},
+				Expected: map[string]interface{}{
+					"content": "本文は140文字以内で入力してください。",
+				},
 			},
-			Expected: map[string]interface{}{
-				"content": "本文の文字数が上限を超えています。",
-			},
-		},
-	}
+		}
 
-	for i, c := range cases {
-		msg := fmt.Sprintf("Case:%d", i+1)
+		for i, c := range cases {
+			msg := fmt.Sprintf("Case:%d", i+1)
 
-		body := c.Request
+			body := c.Request
+			bodyStr, err := json.Marshal(body)
+			assert.NoError(t, err)
+
+			res := a.Invoke(PostMicroposts, RouteMicroposts, Request{
+				Method: "POST",
+				Body:   string(bodyStr),
+				PathParameters: map[string]string{
+					"user_id": "1",
+				},
+			})
+
+			var resBody map[string]interface{}
+			err = json.Unmarshal([]byte(res.Body), &resBody)
+			assert.NoError(t, err)
+
+			errors := resBody["errors"].(map[string]interface{})
+
+			assert.Equal(t, 400, res.StatusCode, msg)
+			assert.Equal(t, c.Expected, errors)
+		}
+	})
+}
+
+func TestPutMicropost_200(t *testing.T) {
+	forEachAdapter(t, func(t *testing.T, a testAdapter) {
+		mocks.SetupDB(t)
+		defer db.DropTable()
+
+		micropostGen := mocks.Micropost()
+		micropostMock := micropostGen.Single(0, mocks.E).(*models.Micropost)
+
+		body := map[string]interface{}{
+			"content": strings.Repeat("a", 140),
+		}
 		bodyStr, err := json.Marshal(body)
 		assert.NoError(t, err)
 
-		res := PostMicroposts(events.APIGatewayProxyRequest{
-			Body: string(bodyStr),
+		res := a.Invoke(PutMicropost, RouteMicropost, Request{
+			Method: "PUT",
+			Body:   string(bodyStr),
 			PathParameters: map[string]string{
-				"user_id": "1",
+				"user_id":      fmt.Sprintf("%d", micropostMock.UserID),
+				"micropost_id": fmt.Sprintf("%d", micropostMock.ID),
 			},
 		})
 
+		assert.Equal(t, 200, res.StatusCode)
+
 		var resBody map[string]interface{}
 		err = json.Unmarshal([]byte(res.Body), &resBody)
 		assert.NoError(t, err)
 
-		errors := resBody["errors"].(map[string]interface{})
-
-		assert.Equal(t, 400, res.StatusCode, msg)
-		assert.Equal(t, c.Expected, errors)
-	}
+		micropost, err := models.GetMicropostByID(micropostMock.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, body["content"].(string), micropost.Content)
+	})
 }
 
-func TestPutMicropost_200(t *testing.T) {
-	mocks.SetupDB(t)
-	defer db.DropTable()
-
-	micropostGen := mocks.Micropost()
-	micropostMock := micropostGen.Single(0, mocks.E).(*models.Micropost)
-
-	body := map[string]interface{}{
-		"content": strings.Repeat("a", 140),
-	}
-	bodyStr, err := json.Marshal(body)
-	assert.NoError(t, err)
-
-	res := PutMicropost(events.APIGatewayProxyRequest{
-		Body: string(bodyStr),
-		PathParameters: map[string]string{
-			"user_id":      fmt.Sprintf("%d", micropostMock.UserID),
-			"micropost_id": fmt.Sprintf("%d", micropostMock.ID),
-		},
-	})
+func TestPutMicropost_400(t *testing.T) {
+	forEachAdapter(t, func(t *testing.T, a testAdapter) {
+		mocks.SetupDB(t)
+		defer db.DropTable()
+
+		micropostGen := mocks.Micropost()
+		micropostMock := micropostGen.Single(0, mocks.E).(*models.Micropost)
+
+		cases := []struct {
+			Request  map[string]interface{}
+			Expected map[string]interface{}
+		}{
+			{
+				Request: map[string]interface{}{
+					"content": "",
+				},
+				Expected: map[string]interface{}{
+					"content": "本文を入力してください。",
+				},
+			},
+			{
+				Request: map[string]interface{}{
+					"content": strings.Repeat("a", 141),
+				},
+				Expected: map[string]interface{}{
+					"content": "本文は140文字以内で入力してください。",
+				},
+			},
+		}
+
+		for i, c := range cases {
+			msg := fmt.Sprintf("Case:%d", i+1)
+
+			body := c.Request
+			bodyStr, err := json.Marshal(body)
+			assert.NoError(t, err)
+
+			res := a.Invoke(PutMicropost, RouteMicropost, Request{
+				Method: "PUT",
+				Body:   string(bodyStr),
+				PathParameters: map[string]string{
+					"user_id":      fmt.Sprintf("%d", micropostMock.UserID),
+					"micropost_id": fmt.Sprintf("%d", micropostMock.ID),
+				},
+			})
 
-	assert.Equal(t, 200, res.StatusCode)
+			var resBody map[string]interface{}
+			err = json.Unmarshal([]byte(res.Body), &resBody)
+			assert.NoError(t, err)
 
-	var resBody map[string]interface{}
-	err = json.Unmarshal([]byte(res.Body), &resBody)
-	assert.NoError(t, err)
+			errors := resBody["errors"].(map[string]interface{})
 
-	micropost, err := models.GetMicropostByID(micropostMock.ID)
-	assert.NoError(t, err)
-	assert.Equal(t, body["content"].(string), micropost.Content)
+			assert.Equal(t, 400, res.StatusCode, msg)
+			assert.Equal(t, c.Expected, errors)
+		}
+	})
 }
 
-func TestPutMicropost_400(t *testing.T) {
-	mocks.SetupDB(t)
-	defer db.DropTable()
-
-	micropostGen := mocks.Micropost()
-	micropostMock := micropostGen.Single(0, mocks.E).(*models.Micropost)
-
-	cases := []struct {
-		Request  map[string]interface{}
-		Expected map[string]interface{}
-	}{
-		{
-			Request: map[string]interface{}{
-				"content": "",
-			},
-			Expected: map[string]interface{}{
-				"content": "本文を入力してください。",
-			},
-		},
-		{
-			Request: map[string]interface{}{
-				"content": strings.Repeat("a", 141),
+func TestGetMicropost(t *testing.T) {
+	forEachAdapter(t, func(t *testing.T, a testAdapter) {
+		mocks.SetupDB(t)
+		defer db.DropTable()
+
+		micropostGen := mocks.Micropost()
+		micropostMock := micropostGen.Single(0, mocks.E).(*models.Micropost)
+
+		res := a.Invoke(GetMicropost, RouteMicropost, Request{
+			Method: "GET",
+			PathParameters: map[string]string{
+				"user_id":      fmt.Sprintf("%d", micropostMock.UserID),
+				"micropost_id": fmt.Sprintf("%d", micropostMock.ID),
 			},
-			Expected: map[string]interface{}{
-				"content": "本文の文字数が上限を超えています。",
+		})
+
+		var body map[string]interface{}
+		err := json.Unmarshal([]byte(res.Body), &body)
+		assert.NoError(t, err)
+		assert.Equal(t, float64(micropostMock.ID), body["id"])
+		assert.Equal(t, micropostMock.Content, body["content"])
+		assert.Equal(t, float64(micropostMock.UserID), body["user_id"])
+	})
+}
+
+func TestGetMicroposts(t *testing.T) {
+	forEachAdapter(t, func(t *testing.T, a testAdapter) {
+		mocks.SetupDB(t)
+		defer db.DropTable()
+
+		micropostGen := mocks.Micropost()
+		micropostMocks := micropostGen.Multi(3, func(i uint64, mapper dbmock.DBMapper) dbmock.DBMapper {
+			m := mapper.(*models.Micropost)
+			if i == 2 {
+				m.UserID = 2
+			} else {
+				m.UserID = 1
+			}
+			return m
+		})
+
+		res := a.Invoke(GetMicroposts, RouteMicroposts, Request{
+			Method: "GET",
+			PathParameters: map[string]string{
+				"user_id": "1",
 			},
-		},
-	}
+		})
 
-	for i, c := range cases {
-		msg := fmt.Sprintf("Case:%d", i+1)
+		assert.Equal(t, 200, res.StatusCode)
 
-		body := c.Request
-		bodyStr, err := json.Marshal(body)
+		var body map[string]interface{}
+		err := json.Unmarshal([]byte(res.Body), &body)
 		assert.NoError(t, err)
 
-		res := PutMicropost(events.APIGatewayProxyRequest{
-			Body: string(bodyStr),
+		actualMicroposts := body["microposts"].([]interface{})
+
+		expected1 := micropostMocks[1].(*models.Micropost)
+		actual1 := actualMicroposts[0].(map[string]interface{})
+		assert.Equal(t, float64(expected1.ID), actual1["id"])
+		assert.Equal(t, expected1.Content, actual1["content"])
+		assert.Equal(t, float64(expected1.UserID), actual1["user_id"])
+
+		expected2 := micropostMocks[0].(*models.Micropost)
+		actual2 := actualMicroposts[1].(map[string]interface{})
+		assert.Equal(t, float64(expected2.ID), actual2["id"])
+		assert.Equal(t, expected2.Content, actual2["content"])
+		assert.Equal(t, float64(expected2.UserID), actual2["user_id"])
+	})
+}
+
+func TestDeleteMicropost(t *testing.T) {
+	forEachAdapter(t, func(t *testing.T, a testAdapter) {
+		mocks.SetupDB(t)
+		defer db.DropTable()
+
+		micropostGen := mocks.Micropost()
+		micropostMock := micropostGen.Single(0, mocks.E).(*models.Micropost)
+
+		res := a.Invoke(DeleteMicropost, RouteMicropost, Request{
+			Method: "DELETE",
 			PathParameters: map[string]string{
 				"user_id":      fmt.Sprintf("%d", micropostMock.UserID),
 				"micropost_id": fmt.Sprintf("%d", micropostMock.ID),
 			},
 		})
 
+		assert.Equal(t, 200, res.StatusCode)
+
+		microposts, err := models.GetMicropostsByUserID(micropostMock.UserID)
+		assert.NoError(t, err)
+		assert.Len(t, microposts, 0)
+	})
+}
+
+func TestPutMicropost_400_params(t *testing.T) {
+	withDefaultAdapter(t, func(t *testing.T, a testAdapter) {
+		res := a.Invoke(PutMicropost, RouteMicropost, Request{
+			Method: "PUT",
+			Body:   `{"content":""}`,
+			PathParameters: map[string]string{
+				"user_id":      "abc",
+				"micropost_id": "xyz",
+			},
+		})
+
 		var resBody map[string]interface{}
-		err = json.Unmarshal([]byte(res.Body), &resBody)
+		err := json.Unmarshal([]byte(res.Body), &resBody)
 		assert.NoError(t, err)
 
 		errors := resBody["errors"].(map[string]interface{})
 
-		assert.Equal(t, 400, res.StatusCode, msg)
-		assert.Equal(t, c.Expected, errors)
-	}
+		assert.Equal(t, 400, res.StatusCode)
+		assert.Equal(t, map[string]interface{}{
+			"user_id":      "ユーザーIDは0以上の数値を入力してください。",
+			"micropost_id": "マイクロポストIDは0以上の数値を入力してください。",
+			"content":      "本文を入力してください。",
+		}, errors)
+	})
 }
 
-func TestGetMicropost(t *testing.T) {
-	mocks.SetupDB(t)
-	defer db.DropTable()
+func TestPatchMicropost(t *testing.T) {
+	withDefaultAdapter(t, func(t *testing.T, a testAdapter) {
+		mocks.SetupDB(t)
+		defer db.DropTable()
 
-	micropostGen := mocks.Micropost()
-	micropostMock := micropostGen.Single(0, mocks.E).(*models.Micropost)
+		micropostGen := mocks.Micropost()
+		micropostMock := micropostGen.Single(0, mocks.E).(*models.Micropost)
 
-	res := GetMicropost(events.APIGatewayProxyRequest{
-		PathParameters: map[string]string{
-			"user_id":      fmt.Sprintf("%d", micropostMock.UserID),
-			"micropost_id": fmt.Sprintf("%d", micropostMock.ID),
-		},
-	})
+		res := a.Invoke(PatchMicropost, RouteMicropost, Request{
+			Method: "PATCH",
+			Body:   `{"content":"patched"}`,
+			PathParameters: map[string]string{
+				"user_id":      fmt.Sprintf("%d", micropostMock.UserID),
+				"micropost_id": fmt.Sprintf("%d", micropostMock.ID),
+			},
+		})
 
-	var body map[string]interface{}
-	err := json.Unmarshal([]byte(res.Body), &body)
-	assert.NoError(t, err)
-	assert.Equal(t, float64(micropostMock.ID), body["id"])
-	assert.Equal(t, micropostMock.Content, body["content"])
-	assert.Equal(t, float64(micropostMock.UserID), body["user_id"])
-}
+		assert.Equal(t, 200, res.StatusCode)
 
-func TestGetMicroposts(t *testing.T) {
-	mocks.SetupDB(t)
-	defer db.DropTable()
-
-	micropostGen := mocks.Micropost()
-	micropostMocks := micropostGen.Multi(3, func(i uint64, mapper dbmock.DBMapper) dbmock.DBMapper {
-		m := mapper.(*models.Micropost)
-		if i == 2 {
-			m.UserID = 2
-		} else {
-			m.UserID = 1
-		}
-		return m
+		micropost, err := models.GetMicropostByID(micropostMock.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "patched", micropost.Content)
+		assert.Equal(t, micropostMock.UserID, micropost.UserID)
 	})
+}
+
+func TestPatchMicropost_404(t *testing.T) {
+	withDefaultAdapter(t, func(t *testing.T, a testAdapter) {
+		mocks.SetupDB(t)
+		defer db.DropTable()
 
-	res := GetMicroposts(events.APIGatewayProxyRequest{
-		PathParameters: map[string]string{
-			"user_id": "1",
-		},
+		micropostGen := mocks.Micropost()
+		micropostMock := micropostGen.Single(0, mocks.E).(*models.Micropost)
+
+		res := a.Invoke(PatchMicropost, RouteMicropost, Request{
+			Method: "PATCH",
+			Body:   `{"content":"patched"}`,
+			PathParameters: map[string]string{
+				"user_id":      fmt.Sprintf("%d", micropostMock.UserID+1),
+				"micropost_id": fmt.Sprintf("%d", micropostMock.ID),
+			},
+		})
+
+		assert.Equal(t, 404, res.StatusCode)
+
+		micropost, err := models.GetMicropostByID(micropostMock.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, micropostMock.Content, micropost.Content)
 	})
+}
 
-	assert.Equal(t, 200, res.StatusCode)
+func TestGetMicropost_fields(t *testing.T) {
+	withDefaultAdapter(t, func(t *testing.T, a testAdapter) {
+		mocks.SetupDB(t)
+		defer db.DropTable()
 
-	var body map[string]interface{}
-	err := json.Unmarshal([]byte(res.Body), &body)
-	assert.NoError(t, err)
+		micropostGen := mocks.Micropost()
+		micropostMock := micropostGen.Single(0, mocks.E).(*models.Micropost)
 
-	actualMicroposts := body["microposts"].([]interface{})
+		res := a.Invoke(GetMicropost, RouteMicropost, Request{
+			Method: "GET",
+			QueryStringParameters: map[string]string{
+				"fields": "content",
+			},
+			PathParameters: map[string]string{
+				"user_id":      fmt.Sprintf("%d", micropostMock.UserID),
+				"micropost_id": fmt.Sprintf("%d", micropostMock.ID),
+			},
+		})
+
+		assert.Equal(t, 200, res.StatusCode)
 
-	expected1 := micropostMocks[1].(*models.Micropost)
-	actual1 := actualMicroposts[0].(map[string]interface{})
-	assert.Equal(t, float64(expected1.ID), actual1["id"])
-	assert.Equal(t, expected1.Content, actual1["content"])
-	assert.Equal(t, float64(expected1.UserID), actual1["user_id"])
+		var body map[string]interface{}
+		err := json.Unmarshal([]byte(res.Body), &body)
+		assert.NoError(t, err)
 
-	expected2 := micropostMocks[0].(*models.Micropost)
-	actual2 := actualMicroposts[1].(map[string]interface{})
-	assert.Equal(t, float64(expected2.ID), actual2["id"])
-	assert.Equal(t, expected2.Content, actual2["content"])
-	assert.Equal(t, float64(expected2.UserID), actual2["user_id"])
+		assert.Equal(t, map[string]interface{}{
+			"content": micropostMock.Content,
+		}, body)
+	})
 }
 
-func TestDeleteMicropost(t *testing.T) {
-	mocks.SetupDB(t)
-	defer db.DropTable()
+func TestGetMicropost_include(t *testing.T) {
+	withDefaultAdapter(t, func(t *testing.T, a testAdapter) {
+		mocks.SetupDB(t)
+		defer db.DropTable()
 
-	micropostGen := mocks.Micropost()
-	micropostMock := micropostGen.Single(0, mocks.E).(*models.Micropost)
+		userMock := mocks.User().Single(0, mocks.E).(*models.User)
 
-	res := DeleteMicropost(events.APIGatewayProxyRequest{
-		PathParameters: map[string]string{
-			"user_id":      fmt.Sprintf("%d", micropostMock.UserID),
-			"micropost_id": fmt.Sprintf("%d", micropostMock.ID),
-		},
+		micropost := &models.Micropost{
+			UserID:  userMock.ID,
+			Content: "hello",
+		}
+		assert.NoError(t, micropost.Create())
+
+		res := a.Invoke(GetMicropost, RouteMicropost, Request{
+			Method: "GET",
+			QueryStringParameters: map[string]string{
+				"fields":  "content",
+				"include": "user",
+			},
+			PathParameters: map[string]string{
+				"user_id":      fmt.Sprintf("%d", userMock.ID),
+				"micropost_id": fmt.Sprintf("%d", micropost.ID),
+			},
+		})
+
+		assert.Equal(t, 200, res.StatusCode)
+
+		var body map[string]interface{}
+		err := json.Unmarshal([]byte(res.Body), &body)
+		assert.NoError(t, err)
+
+		assert.Equal(t, map[string]interface{}{
+			"content": "hello",
+			"user": map[string]interface{}{
+				"id":        float64(userMock.ID),
+				"user_name": userMock.Name,
+				"email":     userMock.Email,
+			},
+		}, body)
 	})
+}
+
+func TestGetMicroposts_createdAfter(t *testing.T) {
+	withDefaultAdapter(t, func(t *testing.T, a testAdapter) {
+		mocks.SetupDB(t)
+		defer db.DropTable()
+
+		micropostGen := mocks.Micropost()
+		micropostMocks := micropostGen.Multi(3, func(i uint64, mapper dbmock.DBMapper) dbmock.DBMapper {
+			m := mapper.(*models.Micropost)
+			m.UserID = 1
+			return m
+		})
+
+		res := a.Invoke(GetMicroposts, RouteMicroposts, Request{
+			Method: "GET",
+			PathParameters: map[string]string{
+				"user_id": "1",
+			},
+			QueryStringParameters: map[string]string{
+				"sort":             "-created_at",
+				"created_after":    "2019-01-01T00:00:00Z",
+				"content_contains": "Content",
+			},
+		})
 
-	assert.Equal(t, 200, res.StatusCode)
+		assert.Equal(t, 200, res.StatusCode)
 
-	microposts, err := models.GetMicropostsByUserID(micropostMock.UserID)
-	assert.NoError(t, err)
-	assert.Len(t, microposts, 0)
+		var body struct {
+			Microposts []map[string]interface{} `json:"microposts"`
+			Meta       *models.ListMeta         `json:"meta"`
+		}
+		err := json.Unmarshal([]byte(res.Body), &body)
+		assert.NoError(t, err)
+
+		if assert.Len(t, body.Microposts, 3) {
+			// 作成日時が同じなら ID で並ぶので、最後に作ったものが先頭になる
+			expected := micropostMocks[2].(*models.Micropost)
+			assert.Equal(t, float64(expected.ID), body.Microposts[0]["id"])
+		}
+		assert.False(t, body.Meta.Scan)
+		assert.Equal(t, db.UserIDCreatedAtIndex, body.Meta.Index)
+		assert.Equal(t, []string{"user_id", "created_after"}, body.Meta.KeyConditions)
+		assert.Equal(t, []string{"content_contains"}, body.Meta.Filters)
+		assert.Equal(t, []string{}, body.Meta.ScanFilters)
+	})
 }
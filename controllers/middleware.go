@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"sam-book-sample/logging"
+	"sam-book-sample/settings"
+	"sam-book-sample/utils"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/pkg/errors"
+)
+
+type Middleware func(Handler) Handler
+
+type contextKey string
+
+const (
+	requestIDKey contextKey = "request_id"
+	accessLogKey contextKey = "access_log"
+)
+
+const RequestIDHeader = "X-Request-Id"
+
+// Chain は middlewares を先頭が最も外側になるように h に適用する
+func Chain(h Handler, middlewares ...Middleware) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+func DefaultMiddlewares() []Middleware {
+	return []Middleware{
+		RequestID,
+		Logging,
+		AccessLog,
+		Latency,
+		Recover,
+	}
+}
+
+// AdminMiddlewares は管理用の API に使う。DefaultMiddlewares の内側で RequireAdmin を確かめる
+func AdminMiddlewares() []Middleware {
+	return append(DefaultMiddlewares(), RequireAdmin)
+}
+
+func setHeader(res Response, key, value string) Response {
+	headers := map[string]string{}
+	for k, v := range res.Headers {
+		headers[k] = v
+	}
+	headers[key] = value
+	res.Headers = headers
+	return res
+}
+
+// Recover は panic を 500 のレスポンスに変換する
+func Recover(next Handler) Handler {
+	return func(request Request) (res Response) {
+		defer func() {
+			if r := recover(); r != nil {
+				res = RenderError(request, errors.Errorf("panic: %v", r))
+			}
+		}()
+		return next(request)
+	}
+}
+
+// accessLogged は AccessLog の内側で処理しているかを返す
+func accessLogged(ctx context.Context) bool {
+	logged, _ := ctx.Value(accessLogKey).(bool)
+	return logged
+}
+
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// RequestID は X-Request-Id ヘッダ、API Gateway のリクエストIDの順にリクエストIDを決め、
+// context とレスポンスヘッダに設定する。request.RequestID は API Gateway の値のまま残す
+func RequestID(next Handler) Handler {
+	return func(request Request) Response {
+		id := request.Header(RequestIDHeader)
+		if id == "" {
+			id = request.RequestID
+		}
+		if id == "" {
+			token, err := utils.GenerateToken(32)
+			if err != nil {
+				return RenderError(request, err)
+			}
+			id = token
+		}
+
+		request = request.WithContext(context.WithValue(request.Context(), requestIDKey, id))
+
+		return setHeader(next(request), RequestIDHeader, id)
+	}
+}
+
+// Logging はリクエストの識別情報を持つ Logger を context に設定する
+func Logging(next Handler) Handler {
+	return func(request Request) Response {
+		ctx := request.Context()
+
+		fields := logging.Fields{
+			"request_id":       RequestIDFromContext(ctx),
+			"apigw_request_id": request.RequestID,
+			"method":           request.Method,
+			"route":            request.Route,
+		}
+		if lc, ok := lambdacontext.FromContext(ctx); ok {
+			fields["lambda_request_id"] = lc.AwsRequestID
+		}
+		if userID := request.PathParameters["user_id"]; userID != "" {
+			fields["user_id"] = userID
+		}
+
+		logger := logging.FromContext(ctx).With(fields)
+
+		return next(request.WithContext(logging.NewContext(ctx, logger)))
+	}
+}
+
+// AccessLog はリクエストごとに 1 行のログを書く。エラーもここで書くので、内側の RenderError は書かない
+func AccessLog(next Handler) Handler {
+	return func(request Request) Response {
+		start := time.Now()
+		res := next(request.WithContext(context.WithValue(request.Context(), accessLogKey, true)))
+
+		logger := logging.FromContext(request.Context()).With(logging.Fields{
+			"path":       request.Path,
+			"status":     res.StatusCode,
+			"latency_ms": float64(time.Since(start)) / float64(time.Millisecond),
+		})
+
+		switch {
+		case res.StatusCode >= 500:
+			logger.WithError(res.err).Error("request failed")
+		case res.StatusCode >= 400:
+			logger.WithError(res.err).Warn("request rejected")
+		default:
+			logger.Info("request completed")
+		}
+
+		return res
+	}
+}
+
+// Latency は処理時間を X-Response-Time ヘッダに設定する
+func Latency(next Handler) Handler {
+	return func(request Request) Response {
+		start := time.Now()
+		res := next(request)
+		elapsed := float64(time.Since(start)) / float64(time.Millisecond)
+		return setHeader(res, "X-Response-Time", fmt.Sprintf("%.3fms", elapsed))
+	}
+}
+
+// RequireAdmin は Authorization: Bearer <ADMIN_TOKEN> のリクエストだけを通す。ADMIN_TOKEN が設定されていなければすべて拒む
+func RequireAdmin(next Handler) Handler {
+	return func(request Request) Response {
+		token := settings.Env().AdminToken()
+		given := strings.TrimPrefix(request.Header("Authorization"), "Bearer ")
+		if token == "" || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			return RenderError(request, ErrForbidden)
+		}
+		return next(request)
+	}
+}
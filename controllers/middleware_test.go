@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"sam-book-sample/logging"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChain(t *testing.T) {
+	var order []string
+	mark := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(request Request) Response {
+				order = append(order, name)
+				return next(request)
+			}
+		}
+	}
+
+	h := Chain(func(request Request) Response {
+		order = append(order, "handler")
+		return Response200OK()
+	}, mark("first"), mark("second"))
+
+	res := h(Request{})
+
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, []string{"first", "second", "handler"}, order)
+}
+
+func TestRecover(t *testing.T) {
+	h := Chain(func(request Request) Response {
+		panic("boom")
+	}, DefaultMiddlewares()...)
+
+	res := h(Request{})
+
+	assert.Equal(t, 500, res.StatusCode)
+	assert.NotEmpty(t, res.Headers[RequestIDHeader])
+	assert.NotEmpty(t, res.Headers["X-Response-Time"])
+}
+
+func TestAccessLog_ServerError(t *testing.T) {
+	failing := func(request Request) Response {
+		return RenderError(request, errors.New("boom"))
+	}
+
+	// AccessLog を通らなければ RenderError が書く
+	buf := &bytes.Buffer{}
+	ctx := logging.NewContext(context.Background(), logging.New(buf, logging.InfoLevel))
+	res := failing(Request{}.WithContext(ctx))
+
+	assert.Equal(t, 500, res.StatusCode)
+	assert.Equal(t, 1, strings.Count(buf.String(), "boom"))
+
+	// AccessLog を通れば 1 度だけ書く
+	buf.Reset()
+	res = AccessLog(failing)(Request{}.WithContext(ctx))
+
+	assert.Equal(t, 500, res.StatusCode)
+	assert.Equal(t, 1, strings.Count(buf.String(), "boom"))
+}
+
+func TestRequestID(t *testing.T) {
+	cases := []struct {
+		Request  Request
+		Expected string
+	}{
+		{
+			Request: Request{
+				Headers:   map[string]string{"x-request-id": "from-header"},
+				RequestID: "from-gateway",
+			},
+			Expected: "from-header",
+		},
+		{
+			Request: Request{
+				RequestID: "from-gateway",
+			},
+			Expected: "from-gateway",
+		},
+	}
+
+	for _, c := range cases {
+		var fromContext string
+		h := RequestID(func(request Request) Response {
+			fromContext = RequestIDFromContext(request.Context())
+			return Response200OK()
+		})
+
+		res := h(c.Request)
+
+		assert.Equal(t, c.Expected, fromContext)
+		assert.Equal(t, c.Expected, res.Headers[RequestIDHeader])
+	}
+}
+
+func TestRequireAdmin(t *testing.T) {
+	// デプロイしたときと同じく、復号を止めずに平文の ADMIN_TOKEN を読めること
+	os.Unsetenv("DISABLE_ENV_DECRYPT")
+
+	h := Chain(func(request Request) Response {
+		return Response200OK()
+	}, RequireAdmin)
+
+	withToken := func(token string) Request {
+		return Request{Headers: map[string]string{"Authorization": "Bearer " + token}}
+	}
+
+	// ADMIN_TOKEN がなければ空のトークンでも通さない
+	assert.Equal(t, 403, h(withToken("")).StatusCode)
+
+	os.Setenv("ADMIN_TOKEN", "secret")
+	defer os.Unsetenv("ADMIN_TOKEN")
+
+	assert.Equal(t, 403, h(Request{}).StatusCode)
+	assert.Equal(t, 403, h(withToken("wrong")).StatusCode)
+	assert.Equal(t, 200, h(withToken("secret")).StatusCode)
+}
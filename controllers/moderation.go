@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"sam-book-sample/models"
+	"sam-book-sample/utils"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/validator.v2"
+)
+
+var ErrModeration = validator.TextErr{Err: errors.New("rejected by moderation")}
+
+var ValidateHeldMicropostPathSettings = []*ValidatorSetting{
+	{ArgName: "held_id", ValidateTags: "required,uint"},
+}
+
+// ResponseHeldMicropost の reason は保留した規則の名前
+type ResponseHeldMicropost struct {
+	ID          uint64                `json:"id"`
+	UserID      uint64                `json:"user_id"`
+	Content     string                `json:"content"`
+	InReplyToID uint64                `json:"in_reply_to_id,omitempty"`
+	Attachments []*ResponseAttachment `json:"attachments,omitempty"`
+	Reason      string                `json:"reason"`
+	CreatedAt   time.Time             `json:"created_at"`
+}
+
+// ResponseHeldMicroposts は保留した投稿の 1 ページ分で、古い順に並ぶ
+type ResponseHeldMicroposts struct {
+	HeldMicroposts []*ResponseHeldMicropost `json:"held_microposts"`
+	NextCursor     string                   `json:"next_cursor,omitempty"`
+}
+
+func newResponseHeldMicropost(h *models.HeldMicropost) *ResponseHeldMicropost {
+	return &ResponseHeldMicropost{
+		ID:          h.ID,
+		UserID:      h.AuthorID,
+		Content:     h.Content,
+		InReplyToID: h.InReplyToID,
+		Attachments: newResponseAttachments(h.Attachments),
+		Reason:      h.Reason,
+		CreatedAt:   h.CreatedAt,
+	}
+}
+
+func GetHeldMicroposts(request Request) Response {
+	page, pageErr := ParsePage(request.QueryStringParameters)
+	if pageErr != nil {
+		return RenderError(request, NewValidationError(*pageErr))
+	}
+
+	held, next, err := models.ListHeldMicroposts(page)
+	if err != nil {
+		return RenderError(request, err)
+	}
+
+	res := make([]*ResponseHeldMicropost, len(held))
+	for i, h := range held {
+		res[i] = newResponseHeldMicropost(h)
+	}
+
+	return Response200(&ResponseHeldMicroposts{
+		HeldMicroposts: res,
+		NextCursor:     next,
+	})
+}
+
+// PostHeldMicropostApprove は保留した投稿を公開し、公開した Micropost の ID を返す
+func PostHeldMicropostApprove(request Request) Response {
+	validErr := ValidateParams(request.PathParameters, ValidateHeldMicropostPathSettings)
+	if validErr != nil {
+		return RenderError(request, NewValidationError(*validErr))
+	}
+
+	id, err := utils.ParseUint(request.PathParameters["held_id"])
+	if err != nil {
+		return RenderError(request, err)
+	}
+
+	micropost, err := models.ApproveHeldMicropost(id)
+	if err != nil {
+		return RenderError(request, err)
+	}
+
+	return Response201(micropost.ID)
+}
+
+// PostHeldMicropostReject は保留した投稿を公開せずに消す
+func PostHeldMicropostReject(request Request) Response {
+	validErr := ValidateParams(request.PathParameters, ValidateHeldMicropostPathSettings)
+	if validErr != nil {
+		return RenderError(request, NewValidationError(*validErr))
+	}
+
+	id, err := utils.ParseUint(request.PathParameters["held_id"])
+	if err != nil {
+		return RenderError(request, err)
+	}
+
+	err = models.RejectHeldMicropost(id)
+	if err != nil {
+		return RenderError(request, err)
+	}
+
+	return Response200OK()
+}
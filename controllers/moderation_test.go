@@ -0,0 +1,116 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sam-book-sample/db"
+	"sam-book-sample/mocks"
+	"sam-book-sample/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func postMicropost(a testAdapter, userID uint64, content string) Response {
+	return a.Invoke(PostMicroposts, RouteMicroposts, Request{
+		Method:         "POST",
+		Body:           fmt.Sprintf(`{"content":%q}`, content),
+		PathParameters: map[string]string{"user_id": fmt.Sprintf("%d", userID)},
+	})
+}
+
+func listHeldMicroposts(t *testing.T, a testAdapter) []*ResponseHeldMicropost {
+	t.Helper()
+
+	res := a.Invoke(GetHeldMicroposts, RouteHeldMicroposts, Request{Method: "GET"})
+	assert.Equal(t, 200, res.StatusCode)
+
+	var body ResponseHeldMicroposts
+	assert.NoError(t, json.Unmarshal([]byte(res.Body), &body))
+
+	return body.HeldMicroposts
+}
+
+func TestModeration(t *testing.T) {
+	os.Setenv("MODERATION_BANNED_WORDS", "spam")
+	os.Setenv("MODERATION_REVIEW_WORDS", "sale")
+	defer os.Unsetenv("MODERATION_BANNED_WORDS")
+	defer os.Unsetenv("MODERATION_REVIEW_WORDS")
+
+	withDefaultAdapter(t, func(t *testing.T, a testAdapter) {
+		mocks.SetupDB(t)
+		defer db.DropTable()
+
+		u := mocks.User().Multi(1, mocks.E)[0].(*models.User)
+
+		res := postMicropost(a, u.ID, "buy SPAM now")
+		assert.Equal(t, 400, res.StatusCode)
+		assert.Contains(t, res.Body, `"content"`)
+
+		res = postMicropost(a, u.ID, "big sale today")
+		assert.Equal(t, 202, res.StatusCode)
+
+		var accepted Response201Body
+		assert.NoError(t, json.Unmarshal([]byte(res.Body), &accepted))
+
+		// 保留中は一覧に出ない
+		microposts, err := models.GetMicropostsByUserID(u.ID)
+		assert.NoError(t, err)
+		assert.Len(t, microposts, 0)
+
+		held := listHeldMicroposts(t, a)
+		if assert.Len(t, held, 1) {
+			assert.Equal(t, accepted.ID, held[0].ID)
+			assert.Equal(t, u.ID, held[0].UserID)
+			assert.Equal(t, "review_word", held[0].Reason)
+		}
+
+		approve := func(id uint64) Response {
+			return a.Invoke(PostHeldMicropostApprove, RouteHeldMicropostApprove, Request{
+				Method:         "POST",
+				PathParameters: map[string]string{"held_id": fmt.Sprintf("%d", id)},
+			})
+		}
+
+		res = approve(accepted.ID)
+		assert.Equal(t, 201, res.StatusCode)
+		assert.Len(t, listHeldMicroposts(t, a), 0)
+
+		microposts, err = models.GetMicropostsByUserID(u.ID)
+		assert.NoError(t, err)
+		if assert.Len(t, microposts, 1) {
+			assert.Equal(t, "big sale today", microposts[0].Content)
+		}
+
+		// 承認済みの投稿は二重に公開しない
+		res = approve(accepted.ID)
+		assert.Equal(t, 404, res.StatusCode)
+
+		res = postMicropost(a, u.ID, "another sale")
+		assert.Equal(t, 202, res.StatusCode)
+		assert.NoError(t, json.Unmarshal([]byte(res.Body), &accepted))
+
+		reject := func(id uint64) Response {
+			return a.Invoke(PostHeldMicropostReject, RouteHeldMicropostReject, Request{
+				Method:         "POST",
+				PathParameters: map[string]string{"held_id": fmt.Sprintf("%d", id)},
+			})
+		}
+
+		assert.Equal(t, 200, reject(accepted.ID).StatusCode)
+		assert.Equal(t, 404, reject(accepted.ID).StatusCode)
+		assert.Len(t, listHeldMicroposts(t, a), 0)
+
+		// 編集は保留できないので受け付けない
+		res = a.Invoke(PatchMicropost, RouteMicropost, Request{
+			Method: "PATCH",
+			Body:   `{"content":"now on sale"}`,
+			PathParameters: map[string]string{
+				"user_id":      fmt.Sprintf("%d", u.ID),
+				"micropost_id": fmt.Sprintf("%d", microposts[0].ID),
+			},
+		})
+		assert.Equal(t, 400, res.StatusCode)
+	})
+}
@@ -0,0 +1,43 @@
+package controllers
+
+import (
+	"sam-book-sample/models"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"gopkg.in/validator.v2"
+)
+
+const (
+	limitParamName  = "limit"
+	cursorParamName = "cursor"
+
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+var (
+	ErrLimit  = validator.TextErr{Err: errors.New("invalid limit")}
+	ErrCursor = validator.TextErr{Err: errors.New("invalid cursor")}
+)
+
+// ParsePage は limit= と cursor= を読む。limit= がなければ defaultPageLimit 件にする。
+// cursor= の中身は models が検証する
+func ParsePage(params map[string]string) (*models.Page, *map[string]error) {
+	page := &models.Page{
+		Limit:  defaultPageLimit,
+		Cursor: params[cursorParamName],
+	}
+
+	if value, ok := params[limitParamName]; ok {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxPageLimit {
+			return nil, &map[string]error{
+				limitParamName: &ParamError{Err: ErrLimit, Tag: "max", Param: strconv.Itoa(maxPageLimit)},
+			}
+		}
+		page.Limit = n
+	}
+
+	return page, nil
+}
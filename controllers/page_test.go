@@ -0,0 +1,53 @@
+package controllers
+
+import (
+	"fmt"
+	"sam-book-sample/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePage(t *testing.T) {
+	cases := []struct {
+		Params   map[string]string
+		Page     *models.Page
+		Expected map[string]error
+	}{
+		{
+			Params: map[string]string{},
+			Page:   &models.Page{Limit: defaultPageLimit},
+		},
+		{
+			Params: map[string]string{"limit": "5", "cursor": "abc"},
+			Page:   &models.Page{Limit: 5, Cursor: "abc"},
+		},
+		{
+			Params: map[string]string{"limit": "0"},
+			Expected: map[string]error{
+				"limit": &ParamError{Err: ErrLimit, Tag: "max", Param: "100"},
+			},
+		},
+		{
+			Params: map[string]string{"limit": "many"},
+			Expected: map[string]error{
+				"limit": &ParamError{Err: ErrLimit, Tag: "max", Param: "100"},
+			},
+		},
+	}
+
+	for i, c := range cases {
+		msg := fmt.Sprintf("Case:%d", i+1)
+
+		page, validErr := ParsePage(c.Params)
+
+		if c.Expected != nil {
+			if assert.NotNil(t, validErr, msg) {
+				assert.Equal(t, c.Expected, *validErr, msg)
+			}
+			continue
+		}
+		assert.Nil(t, validErr, msg)
+		assert.Equal(t, c.Page, page, msg)
+	}
+}
@@ -0,0 +1,133 @@
+package controllers
+
+import (
+	"sam-book-sample/models"
+	"sam-book-sample/utils"
+
+	"github.com/pkg/errors"
+	"gopkg.in/validator.v2"
+)
+
+var ErrSelfFollow = validator.TextErr{Err: errors.New("self follow")}
+
+var ValidateFolloweePathSettings = []*ValidatorSetting{
+	{ArgName: "user_id", ValidateTags: "required,uint"},
+	{ArgName: "followee_id", ValidateTags: "required,uint"},
+}
+
+type RequestPostFollowing struct {
+	FolloweeID *uint64 `json:"followee_id" validate:"required"`
+}
+
+// FollowUsersResponse の count はフォロー数またはフォロワー数の合計で、users はそのうちの 1 ページ分
+type FollowUsersResponse struct {
+	Users      []*UserResponse `json:"users"`
+	Count      int64           `json:"count"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+func PostFollowing(request Request) Response {
+	var req RequestPostFollowing
+	validErr := MergeErrors(
+		ValidateParams(request.PathParameters, ValidateUserPathSettings),
+		DecodeBody(request.Body, &req),
+	)
+	if validErr != nil {
+		return RenderError(request, NewValidationError(*validErr))
+	}
+
+	userID, err := utils.ParseUint(request.PathParameters["user_id"])
+	if err != nil {
+		return RenderError(request, err)
+	}
+
+	err = models.Follow(userID, *req.FolloweeID)
+	if err != nil {
+		return RenderError(request, err)
+	}
+
+	return Response201(*req.FolloweeID)
+}
+
+func DeleteFollowing(request Request) Response {
+	validErr := ValidateParams(request.PathParameters, ValidateFolloweePathSettings)
+	if validErr != nil {
+		return RenderError(request, NewValidationError(*validErr))
+	}
+
+	userID, err := utils.ParseUint(request.PathParameters["user_id"])
+	if err != nil {
+		return RenderError(request, err)
+	}
+
+	followeeID, err := utils.ParseUint(request.PathParameters["followee_id"])
+	if err != nil {
+		return RenderError(request, err)
+	}
+
+	err = models.Unfollow(userID, followeeID)
+	if err != nil {
+		return RenderError(request, err)
+	}
+
+	return Response200OK()
+}
+
+// listFollowUsers は GetFollowing と GetFollowers の共通部分。list でユーザーを、count で合計を選ぶ
+func listFollowUsers(
+	request Request,
+	list func(userID uint64, page *models.Page) ([]*models.User, string, error),
+	count func(c *models.FollowCounts) int64,
+) Response {
+	page, pageErr := ParsePage(request.QueryStringParameters)
+	validErr := MergeErrors(
+		ValidateParams(request.PathParameters, ValidateUserPathSettings),
+		pageErr,
+	)
+	if validErr != nil {
+		return RenderError(request, NewValidationError(*validErr))
+	}
+
+	userID, err := utils.ParseUint(request.PathParameters["user_id"])
+	if err != nil {
+		return RenderError(request, err)
+	}
+
+	_, err = models.GetUserByID(userID, "ID")
+	if err != nil {
+		return RenderError(request, err)
+	}
+
+	counts, err := models.GetFollowCounts(userID)
+	if err != nil {
+		return RenderError(request, err)
+	}
+
+	users, next, err := list(userID, page)
+	if err != nil {
+		return RenderError(request, err)
+	}
+
+	resUsers := make([]*UserResponse, len(users))
+	for i, u := range users {
+		resUsers[i] = newUserResponse(u)
+	}
+
+	return Response200(&FollowUsersResponse{
+		Users:      resUsers,
+		Count:      count(counts),
+		NextCursor: next,
+	})
+}
+
+func GetFollowing(request Request) Response {
+	return listFollowUsers(request, models.ListFollowing, func(c *models.FollowCounts) int64 {
+		return c.FollowingCount
+	})
+}
+
+func GetFollowers(request Request) Response {
+	return listFollowUsers(request, models.ListFollowers, func(c *models.FollowCounts) int64 {
+		return c.FollowerCount
+	})
+}
@@ -0,0 +1,258 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sam-book-sample/db"
+	"sam-book-sample/mocks"
+	"sam-book-sample/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func follow(a testAdapter, followerID, followeeID uint64) Response {
+	return a.Invoke(PostFollowing, RouteFollowing, Request{
+		Method: "POST",
+		Body:   fmt.Sprintf(`{"followee_id":%d}`, followeeID),
+		PathParameters: map[string]string{
+			"user_id": fmt.Sprintf("%d", followerID),
+		},
+	})
+}
+
+func listFollow(t *testing.T, a testAdapter, h Handler, route string, userID uint64, params map[string]string) *FollowUsersResponse {
+	t.Helper()
+
+	res := a.Invoke(h, route, Request{
+		Method: "GET",
+		PathParameters: map[string]string{
+			"user_id": fmt.Sprintf("%d", userID),
+		},
+		QueryStringParameters: params,
+	})
+	assert.Equal(t, 200, res.StatusCode)
+
+	var body FollowUsersResponse
+	err := json.Unmarshal([]byte(res.Body), &body)
+	assert.NoError(t, err)
+
+	return &body
+}
+
+func userIDs(users []*UserResponse) []uint64 {
+	ids := make([]uint64, len(users))
+	for i, u := range users {
+		ids[i] = u.ID
+	}
+	return ids
+}
+
+func TestFollow(t *testing.T) {
+	withDefaultAdapter(t, func(t *testing.T, a testAdapter) {
+		mocks.SetupDB(t)
+		defer db.DropTable()
+
+		userMocks := mocks.User().Multi(3, mocks.E)
+		u1 := userMocks[0].(*models.User)
+		u2 := userMocks[1].(*models.User)
+		u3 := userMocks[2].(*models.User)
+
+		assert.Equal(t, 201, follow(a, u1.ID, u2.ID).StatusCode)
+		assert.Equal(t, 201, follow(a, u1.ID, u3.ID).StatusCode)
+		assert.Equal(t, 201, follow(a, u3.ID, u2.ID).StatusCode)
+
+		// 同じユーザーを二度フォローすると競合になり、数は変わらない
+		assert.Equal(t, 409, follow(a, u1.ID, u2.ID).StatusCode)
+
+		following := listFollow(t, a, GetFollowing, RouteFollowing, u1.ID, map[string]string{"limit": "1"})
+		assert.Equal(t, []uint64{u2.ID}, userIDs(following.Users))
+		assert.Equal(t, int64(2), following.Count)
+		assert.NotEmpty(t, following.NextCursor)
+
+		following = listFollow(t, a, GetFollowing, RouteFollowing, u1.ID, map[string]string{"limit": "1", "cursor": following.NextCursor})
+		assert.Equal(t, []uint64{u3.ID}, userIDs(following.Users))
+
+		followers := listFollow(t, a, GetFollowers, RouteFollowers, u2.ID, nil)
+		assert.Equal(t, []uint64{u1.ID, u3.ID}, userIDs(followers.Users))
+		assert.Equal(t, int64(2), followers.Count)
+		assert.Empty(t, followers.NextCursor)
+
+		// フォローの項目はユーザーの一覧に混ざらない
+		users, err := models.GetUsers()
+		assert.NoError(t, err)
+		assert.Len(t, users, 3)
+
+		res := a.Invoke(DeleteFollowing, RouteFollowee, Request{
+			Method: "DELETE",
+			PathParameters: map[string]string{
+				"user_id":     fmt.Sprintf("%d", u1.ID),
+				"followee_id": fmt.Sprintf("%d", u2.ID),
+			},
+		})
+		assert.Equal(t, 200, res.StatusCode)
+
+		followers = listFollow(t, a, GetFollowers, RouteFollowers, u2.ID, nil)
+		assert.Equal(t, []uint64{u3.ID}, userIDs(followers.Users))
+		assert.Equal(t, int64(1), followers.Count)
+
+		// フォローしていないユーザーの解除は何もしない
+		res = a.Invoke(DeleteFollowing, RouteFollowee, Request{
+			Method: "DELETE",
+			PathParameters: map[string]string{
+				"user_id":     fmt.Sprintf("%d", u1.ID),
+				"followee_id": fmt.Sprintf("%d", u2.ID),
+			},
+		})
+		assert.Equal(t, 200, res.StatusCode)
+
+		counts, err := models.GetFollowCounts(u1.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, &models.FollowCounts{FollowingCount: 1}, counts)
+	})
+}
+
+func TestFollow_400(t *testing.T) {
+	withDefaultAdapter(t, func(t *testing.T, a testAdapter) {
+		mocks.SetupDB(t)
+		defer db.DropTable()
+
+		u1 := mocks.User().Single(0, mocks.E).(*models.User)
+
+		res := follow(a, u1.ID, u1.ID)
+		assert.Equal(t, 400, res.StatusCode)
+
+		var body Response400Body
+		err := json.Unmarshal([]byte(res.Body), &body)
+		assert.NoError(t, err)
+		assert.Equal(t, "self_follow", body.Details["followee_id"][0].Code)
+
+		res = a.Invoke(PostFollowing, RouteFollowing, Request{
+			Method: "POST",
+			Body:   `{}`,
+			PathParameters: map[string]string{
+				"user_id": fmt.Sprintf("%d", u1.ID),
+			},
+		})
+		assert.Equal(t, 400, res.StatusCode)
+
+		// 存在しないユーザーはフォローできない
+		assert.Equal(t, 404, follow(a, u1.ID, u1.ID+100).StatusCode)
+	})
+}
+
+func TestFollow_foreignCursor(t *testing.T) {
+	withDefaultAdapter(t, func(t *testing.T, a testAdapter) {
+		mocks.SetupDB(t)
+		defer db.DropTable()
+
+		userMocks := mocks.User().Multi(3, mocks.E)
+		u1 := userMocks[0].(*models.User)
+		u2 := userMocks[1].(*models.User)
+		u3 := userMocks[2].(*models.User)
+
+		assert.Equal(t, 201, follow(a, u1.ID, u2.ID).StatusCode)
+		assert.Equal(t, 201, follow(a, u1.ID, u3.ID).StatusCode)
+
+		following := listFollow(t, a, GetFollowing, RouteFollowing, u1.ID, map[string]string{"limit": "1"})
+		assert.NotEmpty(t, following.NextCursor)
+
+		// 他のユーザーの一覧のカーソルは使えない
+		for _, route := range []struct {
+			Handler Handler
+			Route   string
+		}{
+			{GetFollowing, RouteFollowing},
+			{GetFollowers, RouteFollowers},
+		} {
+			res := a.Invoke(route.Handler, route.Route, Request{
+				Method: "GET",
+				PathParameters: map[string]string{
+					"user_id": fmt.Sprintf("%d", u2.ID),
+				},
+				QueryStringParameters: map[string]string{"cursor": following.NextCursor},
+			})
+			assert.Equal(t, 400, res.StatusCode, route.Route)
+		}
+	})
+}
+
+func TestFollow_retry(t *testing.T) {
+	withDefaultAdapter(t, func(t *testing.T, a testAdapter) {
+		mocks.SetupDB(t)
+		defer db.DropTable()
+
+		userMocks := mocks.User().Multi(2, mocks.E)
+		u1 := userMocks[0].(*models.User)
+		u2 := userMocks[1].(*models.User)
+
+		table, err := db.Table()
+		assert.NoError(t, err)
+
+		// 数の項目が壊れていて書き込めなければ、関係の項目も書き込まない
+		err = table.Put(map[string]interface{}{
+			db.PKName:        u1.PK(),
+			db.SKName:        "FollowCounts",
+			"FollowingCount": "broken",
+		}).Run()
+		assert.NoError(t, err)
+
+		assert.Equal(t, 500, follow(a, u1.ID, u2.ID).StatusCode)
+
+		following := listFollow(t, a, GetFollowing, RouteFollowing, u1.ID, nil)
+		assert.Empty(t, following.Users)
+		counts, err := models.GetFollowCounts(u2.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, &models.FollowCounts{}, counts)
+
+		// 直れば同じリクエストをそのまま再試行できる
+		err = table.Delete(db.PKName, u1.PK()).Range(db.SKName, "FollowCounts").Run()
+		assert.NoError(t, err)
+
+		assert.Equal(t, 201, follow(a, u1.ID, u2.ID).StatusCode)
+
+		counts, err = models.GetFollowCounts(u1.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, &models.FollowCounts{FollowingCount: 1}, counts)
+		counts, err = models.GetFollowCounts(u2.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, &models.FollowCounts{FollowerCount: 1}, counts)
+	})
+}
+
+func TestDeleteUser_relationships(t *testing.T) {
+	withDefaultAdapter(t, func(t *testing.T, a testAdapter) {
+		mocks.SetupDB(t)
+		defer db.DropTable()
+
+		userMocks := mocks.User().Multi(3, mocks.E)
+		u1 := userMocks[0].(*models.User)
+		u2 := userMocks[1].(*models.User)
+		u3 := userMocks[2].(*models.User)
+
+		assert.Equal(t, 201, follow(a, u1.ID, u2.ID).StatusCode)
+		assert.Equal(t, 201, follow(a, u3.ID, u1.ID).StatusCode)
+		assert.Equal(t, 201, follow(a, u3.ID, u2.ID).StatusCode)
+
+		res := a.Invoke(DeleteUser, RouteUser, Request{
+			Method: "DELETE",
+			PathParameters: map[string]string{
+				"user_id": fmt.Sprintf("%d", u1.ID),
+			},
+		})
+		assert.Equal(t, 200, res.StatusCode)
+
+		// 削除したユーザーとの関係は一覧にも数にも残らない
+		followers := listFollow(t, a, GetFollowers, RouteFollowers, u2.ID, nil)
+		assert.Equal(t, []uint64{u3.ID}, userIDs(followers.Users))
+		assert.Equal(t, int64(1), followers.Count)
+
+		following := listFollow(t, a, GetFollowing, RouteFollowing, u3.ID, nil)
+		assert.Equal(t, []uint64{u2.ID}, userIDs(following.Users))
+		assert.Equal(t, int64(1), following.Count)
+
+		counts, err := models.GetFollowCounts(u1.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, &models.FollowCounts{}, counts)
+	})
+}
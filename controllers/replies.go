@@ -0,0 +1,53 @@
+package controllers
+
+import (
+	"sam-book-sample/models"
+
+	"github.com/pkg/errors"
+	"gopkg.in/validator.v2"
+)
+
+var ErrInReplyTo = validator.TextErr{Err: errors.New("unknown micropost to reply")}
+
+// ResponseReplies は返信の 1 ページ分で、古い順に並ぶ。next_cursor を cursor= に渡すと続きを読める
+type ResponseReplies struct {
+	Microposts []*ResponseMicropost `json:"microposts"`
+	NextCursor string               `json:"next_cursor,omitempty"`
+}
+
+func GetReplies(request Request) Response {
+	page, pageErr := ParsePage(request.QueryStringParameters)
+	validErr := MergeErrors(
+		ValidateParams(request.PathParameters, ValidateMicropostPathSettings),
+		ValidateParams(request.QueryStringParameters, ValidateViewerParamSettings),
+		pageErr,
+	)
+	if validErr != nil {
+		return RenderError(request, NewValidationError(*validErr))
+	}
+
+	userID, micropostID, err := micropostPathParams(request)
+	if err != nil {
+		return RenderError(request, err)
+	}
+
+	microposts, next, err := models.ListReplies(userID, micropostID, page)
+	if err != nil {
+		return RenderError(request, err)
+	}
+
+	res := make([]*ResponseMicropost, len(microposts))
+	for i, m := range microposts {
+		res[i] = newResponseMicropost(m)
+	}
+
+	err = setLiked(request.QueryStringParameters, res)
+	if err != nil {
+		return RenderError(request, err)
+	}
+
+	return Response200(&ResponseReplies{
+		Microposts: res,
+		NextCursor: next,
+	})
+}
@@ -0,0 +1,113 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sam-book-sample/db"
+	"sam-book-sample/mocks"
+	"sam-book-sample/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func postReply(a testAdapter, userID, parentID uint64, content string) Response {
+	return a.Invoke(PostMicroposts, RouteMicroposts, Request{
+		Method: "POST",
+		Body:   fmt.Sprintf(`{"content":%q,"in_reply_to_id":%d}`, content, parentID),
+		PathParameters: map[string]string{
+			"user_id": fmt.Sprintf("%d", userID),
+		},
+	})
+}
+
+func getReplies(t *testing.T, a testAdapter, parent *models.Micropost, params map[string]string) *ResponseReplies {
+	t.Helper()
+
+	res := a.Invoke(GetReplies, RouteReplies, Request{
+		Method:                "GET",
+		QueryStringParameters: params,
+		PathParameters: map[string]string{
+			"user_id":      fmt.Sprintf("%d", parent.UserID),
+			"micropost_id": fmt.Sprintf("%d", parent.ID),
+		},
+	})
+	assert.Equal(t, 200, res.StatusCode)
+
+	var body ResponseReplies
+	err := json.Unmarshal([]byte(res.Body), &body)
+	assert.NoError(t, err)
+
+	return &body
+}
+
+func TestReplies(t *testing.T) {
+	withDefaultAdapter(t, func(t *testing.T, a testAdapter) {
+		mocks.SetupDB(t)
+		defer db.DropTable()
+
+		userMocks := mocks.User().Multi(2, mocks.E)
+		u1 := userMocks[0].(*models.User)
+		u2 := userMocks[1].(*models.User)
+
+		parent := &models.Micropost{UserID: u1.ID, Content: "hello"}
+		assert.NoError(t, parent.Create())
+
+		assert.Equal(t, 201, postReply(a, u2.ID, parent.ID, "reply 1").StatusCode)
+		assert.Equal(t, 201, postReply(a, u1.ID, parent.ID, "reply 2").StatusCode)
+
+		replies := getReplies(t, a, parent, map[string]string{"limit": "1"})
+		if assert.Len(t, replies.Microposts, 1) {
+			assert.Equal(t, "reply 1", replies.Microposts[0].Content)
+			assert.Equal(t, parent.ID, replies.Microposts[0].InReplyToID)
+		}
+		assert.NotEmpty(t, replies.NextCursor)
+
+		replies = getReplies(t, a, parent, map[string]string{"limit": "1", "cursor": replies.NextCursor})
+		if assert.Len(t, replies.Microposts, 1) {
+			assert.Equal(t, "reply 2", replies.Microposts[0].Content)
+		}
+
+		loaded, err := models.GetMicropostByID(parent.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), loaded.ReplyCount)
+
+		// 返信を削除すると数が減る
+		reply := replies.Microposts[0]
+		assert.NoError(t, models.DeleteMicropost(reply.ID))
+		loaded, err = models.GetMicropostByID(parent.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), loaded.ReplyCount)
+
+		// 返信先を削除しても返信は残る
+		all := getReplies(t, a, parent, nil)
+		assert.NoError(t, models.DeleteMicropost(parent.ID))
+		for _, r := range all.Microposts {
+			orphan, err := models.GetMicropostByID(r.ID)
+			assert.NoError(t, err)
+			assert.Equal(t, parent.ID, orphan.InReplyToID)
+		}
+	})
+}
+
+func TestReplies_notFound(t *testing.T) {
+	withDefaultAdapter(t, func(t *testing.T, a testAdapter) {
+		mocks.SetupDB(t)
+		defer db.DropTable()
+
+		userMock := mocks.User().Single(0, mocks.E).(*models.User)
+
+		res := postReply(a, userMock.ID, 100, "reply")
+		assert.Equal(t, 400, res.StatusCode)
+		assert.Contains(t, res.Body, "in_reply_to_id")
+
+		res = a.Invoke(GetReplies, RouteReplies, Request{
+			Method: "GET",
+			PathParameters: map[string]string{
+				"user_id":      fmt.Sprintf("%d", userMock.ID),
+				"micropost_id": "100",
+			},
+		})
+		assert.Equal(t, 404, res.StatusCode)
+	})
+}
@@ -0,0 +1,53 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+)
+
+// Request は API Gateway (REST / HTTP API) や ALB のイベントに依存しないリクエスト
+type Request struct {
+	Method                string
+	Route                 string
+	Path                  string
+	Headers               map[string]string
+	QueryStringParameters map[string]string
+	PathParameters        map[string]string
+	Body                  string
+	RequestID             string
+
+	ctx context.Context
+}
+
+// Response は各イベントのレスポンスへ変換される前のレスポンス
+type Response struct {
+	StatusCode int
+	Headers    map[string]string
+	Body       string
+
+	// アクセスログに出力するためのエラー
+	err error
+}
+
+type Handler func(request Request) Response
+
+func (r Request) Context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+func (r Request) WithContext(ctx context.Context) Request {
+	r.ctx = ctx
+	return r
+}
+
+func (r Request) Header(name string) string {
+	for k, v := range r.Headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
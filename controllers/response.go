@@ -3,9 +3,11 @@ package controllers
 import (
 	"encoding/json"
 	"fmt"
-
-	"github.com/aws/aws-lambda-go/events"
-	"github.com/golang/glog"
+	"mime"
+	"sam-book-sample/i18n"
+	"sam-book-sample/logging"
+	"strconv"
+	"strings"
 )
 
 type Response201Body struct {
@@ -14,82 +16,178 @@ type Response201Body struct {
 }
 
 type Response400Body struct {
-	Message string            `json:"message"`
-	Errors  map[string]string `json:"errors"`
+	Message string                   `json:"message"`
+	Errors  map[string]string        `json:"errors"`
+	Details map[string][]*FieldError `json:"details"`
 }
 
 type Response401Body struct {
 	Message string `json:"message"`
 }
 
+type ResponseMessageBody struct {
+	Message string `json:"message"`
+}
+
+// Problem は RFC 7807 の problem details。Errors は検証エラーの拡張メンバ
+type Problem struct {
+	Type     string                   `json:"type"`
+	Title    string                   `json:"title"`
+	Status   int                      `json:"status"`
+	Detail   string                   `json:"detail,omitempty"`
+	Instance string                   `json:"instance,omitempty"`
+	Errors   map[string][]*FieldError `json:"errors,omitempty"`
+}
+
+const (
+	contentTypeJSON    = "application/json"
+	contentTypeProblem = "application/problem+json"
+)
+
 func commonHeaders() map[string]string {
 	return map[string]string{
-		"Content-Type":                "application/json",
+		"Content-Type":                contentTypeJSON,
 		"Access-Control-Allow-Origin": "*",
 	}
 }
 
-func Response200(body interface{}) events.APIGatewayProxyResponse {
+func errorHeaders(l *i18n.Localizer) map[string]string {
+	headers := commonHeaders()
+	headers["Content-Language"] = l.Lang()
+	return headers
+}
+
+func Response200(body interface{}) Response {
 	b, err := json.Marshal(body)
 	if err != nil {
-		return Response500(err)
+		return RenderError(Request{}, err)
 	}
 
-	return events.APIGatewayProxyResponse{
+	return Response{
 		StatusCode: 200,
 		Body:       string(b),
 		Headers:    commonHeaders(),
 	}
 }
 
-func Response200OK() events.APIGatewayProxyResponse {
-	return events.APIGatewayProxyResponse{
+func Response200OK() Response {
+	return Response{
 		StatusCode: 200,
 		Headers:    commonHeaders(),
 		Body:       `{"message":"OK"}`,
 	}
 }
 
-func Response201(id uint64) events.APIGatewayProxyResponse {
-	return events.APIGatewayProxyResponse{
+func Response201(id uint64) Response {
+	return Response{
 		StatusCode: 201,
 		Headers:    commonHeaders(),
 		Body:       fmt.Sprintf(`{"message":"OK","id":%d}`, id),
 	}
 }
 
-func Response400(errs map[string]error) events.APIGatewayProxyResponse {
-	glog.Warningf("%+v", errs)
-	res := &Response400Body{
-		Message: "入力値を確認してください。",
-		Errors:  ConvertErrorsToMessage(errs),
+// Response202 は受け付けたが、まだ公開していないリソースの ID と、公開していない理由を status で返す
+func Response202(id uint64, status string) Response {
+	return Response{
+		StatusCode: 202,
+		Headers:    commonHeaders(),
+		Body:       fmt.Sprintf(`{"message":"Accepted","id":%d,"status":%q}`, id, status),
 	}
+}
 
-	b, err := json.Marshal(res)
-	if err != nil {
-		return Response500(err)
+// Response201Created は作成したリソースの ID のほかに返すものがあるときに使う
+func Response201Created(body interface{}) Response {
+	res := Response200(body)
+	if res.StatusCode == 200 {
+		res.StatusCode = 201
 	}
+	return res
+}
 
-	return events.APIGatewayProxyResponse{
-		StatusCode: 400,
-		Headers:    commonHeaders(),
+// RenderError は err をエラーレスポンスに変換する。Accept ヘッダが application/problem+json を
+// 求めていれば RFC 7807 の形式で、そうでなければ従来の形式で返す。
+// 500 のエラーは AccessLog を通っていなければここでログに書く
+func RenderError(request Request, err error) Response {
+	l := localizerFor(request)
+	p := asHTTPError(err).Problem(l)
+	p.Instance = requestIDOf(request)
+
+	if p.Status >= 500 && !accessLogged(request.Context()) {
+		logging.FromContext(request.Context()).WithError(err).Error("request failed")
+	}
+
+	headers := errorHeaders(l)
+
+	var body interface{} = legacyErrorBody(p)
+	if acceptsProblem(request.Header("Accept")) {
+		headers["Content-Type"] = contentTypeProblem
+		body = p
+	}
+
+	b, merr := json.Marshal(body)
+	if merr != nil {
+		return RenderError(Request{}, merr)
+	}
+
+	return Response{
+		StatusCode: p.Status,
+		Headers:    headers,
 		Body:       string(b),
+		err:        err,
 	}
 }
 
-func Response404() events.APIGatewayProxyResponse {
-	return events.APIGatewayProxyResponse{
-		StatusCode: 404,
-		Headers:    commonHeaders(),
-		Body:       `{"message":"結果が見つかりません。"}`,
+func legacyErrorBody(p *Problem) interface{} {
+	if p.Errors == nil {
+		return &ResponseMessageBody{
+			Message: p.Detail,
+		}
+	}
+
+	messages := map[string]string{}
+	for name, errs := range p.Errors {
+		messages[name] = errs[0].Message
+	}
+
+	return &Response400Body{
+		Message: p.Detail,
+		Errors:  messages,
+		Details: p.Errors,
 	}
 }
 
-func Response500(err error) events.APIGatewayProxyResponse {
-	glog.Errorf("%+v\n", err)
-	return events.APIGatewayProxyResponse{
-		StatusCode: 500,
-		Headers:    commonHeaders(),
-		Body:       `{"message":"サーバエラーが発生しました。"}`,
+func requestIDOf(request Request) string {
+	if id := RequestIDFromContext(request.Context()); id != "" {
+		return id
+	}
+	return request.RequestID
+}
+
+// acceptsProblem は Accept ヘッダで application/problem+json が application/json と同等以上に
+// 好まれているかを返す。*/* や指定なしは従来の形式とする
+func acceptsProblem(accept string) bool {
+	problemQ, jsonQ := 0.0, 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+		}
+
+		switch mediaType {
+		case contentTypeProblem:
+			problemQ = q
+		case contentTypeJSON:
+			jsonQ = q
+		}
 	}
+
+	return problemQ > 0 && problemQ >= jsonQ
 }
@@ -0,0 +1,56 @@
+package controllers
+
+import (
+	"sam-book-sample/models"
+	"time"
+)
+
+// ResponseRevision の content は revision 版目の編集で書き換えられる前の本文
+type ResponseRevision struct {
+	Revision   int64     `json:"revision"`
+	Content    string    `json:"content"`
+	WrittenAt  time.Time `json:"written_at"`
+	ReplacedAt time.Time `json:"replaced_at"`
+}
+
+// ResponseRevisions は編集前の本文の 1 ページ分で、古い順に並ぶ。next_cursor を cursor= に渡すと続きを読める
+type ResponseRevisions struct {
+	Revisions  []*ResponseRevision `json:"revisions"`
+	NextCursor string              `json:"next_cursor,omitempty"`
+}
+
+func GetRevisions(request Request) Response {
+	page, pageErr := ParsePage(request.QueryStringParameters)
+	validErr := MergeErrors(
+		ValidateParams(request.PathParameters, ValidateMicropostPathSettings),
+		pageErr,
+	)
+	if validErr != nil {
+		return RenderError(request, NewValidationError(*validErr))
+	}
+
+	userID, micropostID, err := micropostPathParams(request)
+	if err != nil {
+		return RenderError(request, err)
+	}
+
+	revisions, next, err := models.ListRevisions(userID, micropostID, page)
+	if err != nil {
+		return RenderError(request, err)
+	}
+
+	res := make([]*ResponseRevision, len(revisions))
+	for i, r := range revisions {
+		res[i] = &ResponseRevision{
+			Revision:   r.Revision,
+			Content:    r.Content,
+			WrittenAt:  r.WrittenAt,
+			ReplacedAt: r.ReplacedAt,
+		}
+	}
+
+	return Response200(&ResponseRevisions{
+		Revisions:  res,
+		NextCursor: next,
+	})
+}
@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sam-book-sample/db"
+	"sam-book-sample/mocks"
+	"sam-book-sample/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func editMicropost(a testAdapter, m *models.Micropost, method, content string) Response {
+	h := PutMicropost
+	if method == "PATCH" {
+		h = PatchMicropost
+	}
+
+	return a.Invoke(h, RouteMicropost, Request{
+		Method: method,
+		Body:   fmt.Sprintf(`{"content":%q}`, content),
+		PathParameters: map[string]string{
+			"user_id":      fmt.Sprintf("%d", m.UserID),
+			"micropost_id": fmt.Sprintf("%d", m.ID),
+		},
+	})
+}
+
+func TestGetRevisions(t *testing.T) {
+	withDefaultAdapter(t, func(t *testing.T, a testAdapter) {
+		mocks.SetupDB(t)
+		defer db.DropTable()
+
+		u := mocks.User().Multi(1, mocks.E)[0].(*models.User)
+
+		m := &models.Micropost{UserID: u.ID, Content: "first"}
+		assert.NoError(t, m.Create())
+
+		assert.Equal(t, 200, editMicropost(a, m, "PUT", "second").StatusCode)
+		// 本文が変わらなければ履歴は増えない
+		assert.Equal(t, 200, editMicropost(a, m, "PUT", "second").StatusCode)
+		assert.Equal(t, 200, editMicropost(a, m, "PATCH", "third").StatusCode)
+
+		got := getLikedMicropost(t, a, m, nil)
+		assert.Equal(t, "third", got["content"])
+		assert.Equal(t, float64(2), got["revision_count"])
+		assert.NotEmpty(t, got["edited_at"])
+
+		res := a.Invoke(GetRevisions, RouteRevisions, Request{
+			Method:                "GET",
+			QueryStringParameters: map[string]string{"limit": "1"},
+			PathParameters: map[string]string{
+				"user_id":      fmt.Sprintf("%d", u.ID),
+				"micropost_id": fmt.Sprintf("%d", m.ID),
+			},
+		})
+		assert.Equal(t, 200, res.StatusCode)
+
+		var page ResponseRevisions
+		assert.NoError(t, json.Unmarshal([]byte(res.Body), &page))
+		if assert.Len(t, page.Revisions, 1) {
+			assert.Equal(t, int64(1), page.Revisions[0].Revision)
+			assert.Equal(t, "first", page.Revisions[0].Content)
+		}
+		assert.NotEmpty(t, page.NextCursor)
+
+		res = a.Invoke(GetRevisions, RouteRevisions, Request{
+			Method:                "GET",
+			QueryStringParameters: map[string]string{"cursor": page.NextCursor},
+			PathParameters: map[string]string{
+				"user_id":      fmt.Sprintf("%d", u.ID),
+				"micropost_id": fmt.Sprintf("%d", m.ID),
+			},
+		})
+		assert.Equal(t, 200, res.StatusCode)
+		assert.NoError(t, json.Unmarshal([]byte(res.Body), &page))
+		if assert.Len(t, page.Revisions, 1) {
+			assert.Equal(t, int64(2), page.Revisions[0].Revision)
+			assert.Equal(t, "second", page.Revisions[0].Content)
+		}
+
+		// 他のユーザーの Micropost としては読めない
+		res = a.Invoke(GetRevisions, RouteRevisions, Request{
+			Method: "GET",
+			PathParameters: map[string]string{
+				"user_id":      fmt.Sprintf("%d", u.ID+1),
+				"micropost_id": fmt.Sprintf("%d", m.ID),
+			},
+		})
+		assert.Equal(t, 404, res.StatusCode)
+	})
+}
+
+func TestPutMicropost_editWindow(t *testing.T) {
+	withDefaultAdapter(t, func(t *testing.T, a testAdapter) {
+		mocks.SetupDB(t)
+		defer db.DropTable()
+
+		u := mocks.User().Multi(1, mocks.E)[0].(*models.User)
+
+		m := &models.Micropost{UserID: u.ID, Content: "old"}
+		assert.NoError(t, m.Create())
+
+		table, err := db.Table()
+		assert.NoError(t, err)
+		err = table.
+			Update(db.PKName, m.PK()).
+			Range(db.SKName, m.SK()).
+			Set("CreatedAt", time.Now().UTC().Truncate(time.Second).Add(-2*time.Hour)).
+			Run()
+		assert.NoError(t, err)
+
+		res := editMicropost(a, m, "PUT", "new")
+		assert.Equal(t, 403, res.StatusCode)
+		res = editMicropost(a, m, "PATCH", "new")
+		assert.Equal(t, 403, res.StatusCode)
+
+		got, err := models.GetMicropostByID(m.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "old", got.Content)
+		assert.Zero(t, got.RevisionCount)
+	})
+}
@@ -1 +1,60 @@
 package controllers
+
+import (
+	"strings"
+)
+
+const (
+	RouteUsers      = "/v1/users"
+	RouteUser       = "/v1/users/{user_id}"
+	RouteMicroposts = "/v1/users/{user_id}/microposts"
+	RouteMicropost  = "/v1/users/{user_id}/microposts/{micropost_id}"
+	RouteLikes      = "/v1/users/{user_id}/microposts/{micropost_id}/likes"
+	RouteReplies    = "/v1/users/{user_id}/microposts/{micropost_id}/replies"
+	RouteRevisions  = "/v1/users/{user_id}/microposts/{micropost_id}/revisions"
+
+	RouteScheduledMicropost = "/v1/users/{user_id}/scheduled_microposts/{scheduled_id}"
+
+	RouteMicropostSearch = "/v1/microposts/search"
+
+	RouteFollowing = "/v1/users/{user_id}/following"
+	RouteFollowee  = "/v1/users/{user_id}/following/{followee_id}"
+	RouteFollowers = "/v1/users/{user_id}/followers"
+
+	RouteFeed = "/v1/users/{user_id}/feed"
+
+	RouteHashtagMicroposts = "/v1/hashtags/{tag}/microposts"
+	RouteMentions          = "/v1/users/{user_id}/mentions"
+
+	RouteAttachments = "/v1/users/{user_id}/attachments"
+
+	RouteHeldMicroposts       = "/v1/admin/held_microposts"
+	RouteHeldMicropostApprove = "/v1/admin/held_microposts/{held_id}/approve"
+	RouteHeldMicropostReject  = "/v1/admin/held_microposts/{held_id}/reject"
+)
+
+func splitPath(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
+
+// matchRoute は route の {name} 部分を path から取り出す
+func matchRoute(route, path string) (map[string]string, bool) {
+	routeParts := splitPath(route)
+	pathParts := splitPath(path)
+	if len(routeParts) != len(pathParts) {
+		return nil, false
+	}
+
+	params := map[string]string{}
+	for i, part := range routeParts {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			params[strings.Trim(part, "{}")] = pathParts[i]
+			continue
+		}
+		if part != pathParts[i] {
+			return nil, false
+		}
+	}
+
+	return params, true
+}
@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"sam-book-sample/models"
+	"sam-book-sample/utils"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/validator.v2"
+)
+
+var ErrPublishAt = validator.TextErr{Err: errors.New("publish_at must be in the future")}
+
+var ValidateScheduledMicropostPathSettings = []*ValidatorSetting{
+	{ArgName: "user_id", ValidateTags: "required,uint"},
+	{ArgName: "scheduled_id", ValidateTags: "required,uint"},
+}
+
+type RequestPutScheduledMicropost struct {
+	PublishAt *time.Time `json:"publish_at" validate:"required"`
+}
+
+type ResponseScheduledMicropost struct {
+	ID          uint64                `json:"id"`
+	UserID      uint64                `json:"user_id"`
+	Content     string                `json:"content"`
+	InReplyToID uint64                `json:"in_reply_to_id,omitempty"`
+	Attachments []*ResponseAttachment `json:"attachments,omitempty"`
+	PublishAt   time.Time             `json:"publish_at"`
+}
+
+// validatePublishAt は publish_at が未来の日時かを検証する。指定がなければ何もしない
+func validatePublishAt(publishAt *time.Time) *map[string]error {
+	if publishAt == nil || publishAt.After(time.Now()) {
+		return nil
+	}
+
+	return &map[string]error{
+		"publish_at": ErrPublishAt,
+	}
+}
+
+// scheduledMicropostPathParams はパスの user_id と scheduled_id を返す
+func scheduledMicropostPathParams(request Request) (uint64, uint64, error) {
+	userID, err := utils.ParseUint(request.PathParameters["user_id"])
+	if err != nil {
+		return 0, 0, errors.WithStack(err)
+	}
+
+	id, err := utils.ParseUint(request.PathParameters["scheduled_id"])
+	if err != nil {
+		return 0, 0, errors.WithStack(err)
+	}
+
+	return userID, id, nil
+}
+
+func newResponseScheduledMicropost(s *models.ScheduledMicropost) *ResponseScheduledMicropost {
+	return &ResponseScheduledMicropost{
+		ID:          s.ID,
+		UserID:      s.AuthorID,
+		Content:     s.Content,
+		InReplyToID: s.InReplyToID,
+		Attachments: newResponseAttachments(s.Attachments),
+		PublishAt:   s.PublishAt,
+	}
+}
+
+func GetScheduledMicropost(request Request) Response {
+	validErr := ValidateParams(request.PathParameters, ValidateScheduledMicropostPathSettings)
+	if validErr != nil {
+		return RenderError(request, NewValidationError(*validErr))
+	}
+
+	userID, id, err := scheduledMicropostPathParams(request)
+	if err != nil {
+		return RenderError(request, err)
+	}
+
+	scheduled, err := models.GetScheduledMicropost(userID, id)
+	if err != nil {
+		return RenderError(request, err)
+	}
+
+	return Response200(newResponseScheduledMicropost(scheduled))
+}
+
+// PutScheduledMicropost は予約投稿を公開する日時を変える
+func PutScheduledMicropost(request Request) Response {
+	var req RequestPutScheduledMicropost
+	validErr := MergeErrors(
+		ValidateParams(request.PathParameters, ValidateScheduledMicropostPathSettings),
+		DecodeBody(request.Body, &req),
+		validatePublishAt(req.PublishAt),
+	)
+	if validErr != nil {
+		return RenderError(request, NewValidationError(*validErr))
+	}
+
+	userID, id, err := scheduledMicropostPathParams(request)
+	if err != nil {
+		return RenderError(request, err)
+	}
+
+	scheduled, err := models.RescheduleMicropost(userID, id, *req.PublishAt)
+	if err != nil {
+		return RenderError(request, err)
+	}
+
+	return Response200(newResponseScheduledMicropost(scheduled))
+}
+
+// DeleteScheduledMicropost は予約投稿を公開せずに取り消す
+func DeleteScheduledMicropost(request Request) Response {
+	validErr := ValidateParams(request.PathParameters, ValidateScheduledMicropostPathSettings)
+	if validErr != nil {
+		return RenderError(request, NewValidationError(*validErr))
+	}
+
+	userID, id, err := scheduledMicropostPathParams(request)
+	if err != nil {
+		return RenderError(request, err)
+	}
+
+	err = models.CancelScheduledMicropost(userID, id)
+	if err != nil {
+		return RenderError(request, err)
+	}
+
+	return Response200OK()
+}
@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sam-book-sample/db"
+	"sam-book-sample/mocks"
+	"sam-book-sample/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func scheduleMicropost(a testAdapter, userID uint64, content string, publishAt time.Time) Response {
+	return a.Invoke(PostMicroposts, RouteMicroposts, Request{
+		Method:         "POST",
+		Body:           fmt.Sprintf(`{"content":%q,"publish_at":%q}`, content, publishAt.Format(time.RFC3339)),
+		PathParameters: map[string]string{"user_id": fmt.Sprintf("%d", userID)},
+	})
+}
+
+func scheduledMicropostRequest(method string, userID, id uint64, body string) Request {
+	return Request{
+		Method: method,
+		Body:   body,
+		PathParameters: map[string]string{
+			"user_id":      fmt.Sprintf("%d", userID),
+			"scheduled_id": fmt.Sprintf("%d", id),
+		},
+	}
+}
+
+func TestScheduledMicroposts(t *testing.T) {
+	withDefaultAdapter(t, func(t *testing.T, a testAdapter) {
+		mocks.SetupDB(t)
+		defer db.DropTable()
+
+		u := mocks.User().Multi(1, mocks.E)[0].(*models.User)
+		start := time.Now().UTC().Truncate(time.Second)
+
+		res := scheduleMicropost(a, u.ID, "past", start.Add(-time.Minute))
+		assert.Equal(t, 400, res.StatusCode)
+		assert.Contains(t, res.Body, `"publish_at"`)
+
+		res = scheduleMicropost(a, u.ID, "soon", start.Add(10*time.Minute))
+		assert.Equal(t, 202, res.StatusCode)
+		assert.Contains(t, res.Body, `"status":"scheduled"`)
+
+		var soon Response201Body
+		assert.NoError(t, json.Unmarshal([]byte(res.Body), &soon))
+
+		res = scheduleMicropost(a, u.ID, "later", start.Add(3*time.Hour))
+		assert.Equal(t, 202, res.StatusCode)
+
+		var later Response201Body
+		assert.NoError(t, json.Unmarshal([]byte(res.Body), &later))
+
+		res = scheduleMicropost(a, u.ID, "cancelled", start.Add(20*time.Minute))
+		assert.Equal(t, 202, res.StatusCode)
+
+		var cancelled Response201Body
+		assert.NoError(t, json.Unmarshal([]byte(res.Body), &cancelled))
+
+		// 公開するまでは一覧に出ない
+		microposts, err := models.GetMicropostsByUserID(u.ID)
+		assert.NoError(t, err)
+		assert.Len(t, microposts, 0)
+
+		res = a.Invoke(GetScheduledMicropost, RouteScheduledMicropost, scheduledMicropostRequest("GET", u.ID, soon.ID, ""))
+		assert.Equal(t, 200, res.StatusCode)
+		assert.Contains(t, res.Body, `"content":"soon"`)
+
+		res = a.Invoke(GetScheduledMicropost, RouteScheduledMicropost, scheduledMicropostRequest("GET", u.ID+1, soon.ID, ""))
+		assert.Equal(t, 404, res.StatusCode)
+
+		res = a.Invoke(DeleteScheduledMicropost, RouteScheduledMicropost, scheduledMicropostRequest("DELETE", u.ID, cancelled.ID, ""))
+		assert.Equal(t, 200, res.StatusCode)
+		res = a.Invoke(DeleteScheduledMicropost, RouteScheduledMicropost, scheduledMicropostRequest("DELETE", u.ID, cancelled.ID, ""))
+		assert.Equal(t, 404, res.StatusCode)
+
+		// 別の時間帯のパーティションへ移す
+		res = a.Invoke(PutScheduledMicropost, RouteScheduledMicropost, scheduledMicropostRequest("PUT", u.ID, later.ID,
+			fmt.Sprintf(`{"publish_at":%q}`, start.Add(30*time.Minute).Format(time.RFC3339))))
+		assert.Equal(t, 200, res.StatusCode)
+
+		publishAt := func(d time.Duration) int {
+			publisher := &models.ScheduledPublisher{
+				Now:      func() time.Time { return start.Add(d) },
+				Lookback: 24 * time.Hour,
+			}
+			n, err := publisher.Run()
+			assert.NoError(t, err)
+			return n
+		}
+
+		assert.Equal(t, 0, publishAt(5*time.Minute))
+		assert.Equal(t, 1, publishAt(15*time.Minute))
+		// 公開済みの予約は二重に公開しない
+		assert.Equal(t, 0, publishAt(15*time.Minute))
+		assert.Equal(t, 1, publishAt(time.Hour))
+
+		microposts, err = models.GetMicropostsByUserID(u.ID)
+		assert.NoError(t, err)
+		contents := []string{}
+		for _, m := range microposts {
+			contents = append(contents, m.Content)
+		}
+		assert.ElementsMatch(t, []string{"soon", "later"}, contents)
+
+		res = a.Invoke(GetScheduledMicropost, RouteScheduledMicropost, scheduledMicropostRequest("GET", u.ID, soon.ID, ""))
+		assert.Equal(t, 404, res.StatusCode)
+	})
+}
+
+func TestScheduledPublisher_sweep(t *testing.T) {
+	withDefaultAdapter(t, func(t *testing.T, a testAdapter) {
+		mocks.SetupDB(t)
+		defer db.DropTable()
+
+		u := mocks.User().Multi(1, mocks.E)[0].(*models.User)
+		start := time.Now().UTC().Truncate(time.Second)
+
+		res := scheduleMicropost(a, u.ID, "stale", start.Add(10*time.Minute))
+		assert.Equal(t, 202, res.StatusCode)
+
+		publishAt := func(d time.Duration) int {
+			publisher := &models.ScheduledPublisher{
+				Now:      func() time.Time { return start.Add(d) },
+				Lookback: time.Hour,
+			}
+			n, err := publisher.Run()
+			assert.NoError(t, err)
+			return n
+		}
+
+		assert.Equal(t, 0, publishAt(0))
+		// Lookback より長く止まっていても、読み終えた記録の続きから読んで公開する
+		assert.Equal(t, 1, publishAt(48*time.Hour))
+		assert.Equal(t, 0, publishAt(48*time.Hour))
+
+		microposts, err := models.GetMicropostsByUserID(u.ID)
+		assert.NoError(t, err)
+		if assert.Len(t, microposts, 1) {
+			assert.Equal(t, "stale", microposts[0].Content)
+		}
+	})
+}
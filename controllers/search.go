@@ -0,0 +1,50 @@
+package controllers
+
+import (
+	"sam-book-sample/models"
+)
+
+var ValidateSearchParamSettings = []*ValidatorSetting{
+	{ArgName: "q", ValidateTags: "required,max=140"},
+}
+
+// ResponseSearchMicropost は検索結果の Micropost。score が大きいほど検索語との関連が強い
+type ResponseSearchMicropost struct {
+	*ResponseMicropost
+	Score float64 `json:"score"`
+}
+
+// ResponseSearchMicroposts の next_cursor を cursor= に渡すと続きを読める。最後のページでは空になる
+type ResponseSearchMicroposts struct {
+	Microposts []*ResponseSearchMicropost `json:"microposts"`
+	NextCursor string                     `json:"next_cursor,omitempty"`
+}
+
+func SearchMicroposts(request Request) Response {
+	page, pageErr := ParsePage(request.QueryStringParameters)
+	validErr := MergeErrors(
+		ValidateParams(request.QueryStringParameters, ValidateSearchParamSettings),
+		pageErr,
+	)
+	if validErr != nil {
+		return RenderError(request, NewValidationError(*validErr))
+	}
+
+	results, next, err := models.SearchMicroposts(request.QueryStringParameters["q"], page)
+	if err != nil {
+		return RenderError(request, err)
+	}
+
+	resMicroposts := make([]*ResponseSearchMicropost, len(results))
+	for i, r := range results {
+		resMicroposts[i] = &ResponseSearchMicropost{
+			ResponseMicropost: newResponseMicropost(r.Micropost),
+			Score:             r.Score,
+		}
+	}
+
+	return Response200(&ResponseSearchMicroposts{
+		Microposts: resMicroposts,
+		NextCursor: next,
+	})
+}
@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sam-book-sample/db"
+	"sam-book-sample/mocks"
+	"sam-book-sample/models"
+	"testing"
+
+	"github.com/memememomo/dbmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func searchMicroposts(t *testing.T, a testAdapter, params map[string]string) *ResponseSearchMicroposts {
+	t.Helper()
+
+	res := a.Invoke(SearchMicroposts, RouteMicropostSearch, Request{
+		Method:                "GET",
+		QueryStringParameters: params,
+	})
+	assert.Equal(t, 200, res.StatusCode)
+
+	var body ResponseSearchMicroposts
+	err := json.Unmarshal([]byte(res.Body), &body)
+	assert.NoError(t, err)
+
+	return &body
+}
+
+func TestSearchMicroposts(t *testing.T) {
+	withDefaultAdapter(t, func(t *testing.T, a testAdapter) {
+		mocks.SetupDB(t)
+		defer db.DropTable()
+
+		contents := []string{"東京タワーに行った", "東京タワー、また東京タワー", "大阪城に行った"}
+		micropostMocks := mocks.Micropost().Multi(uint64(len(contents)), func(i uint64, mapper dbmock.DBMapper) dbmock.DBMapper {
+			m := mapper.(*models.Micropost)
+			m.Content = contents[i]
+			return m
+		})
+		first := micropostMocks[0].(*models.Micropost)
+		second := micropostMocks[1].(*models.Micropost)
+
+		// 検索語が多く出てくるほうが先になる
+		body := searchMicroposts(t, a, map[string]string{"q": "東京タワー", "limit": "1"})
+		if assert.Len(t, body.Microposts, 1) {
+			assert.Equal(t, second.ID, body.Microposts[0].ID)
+		}
+		assert.NotEmpty(t, body.NextCursor)
+
+		// 別の検索語にはカーソルを使えない
+		res := a.Invoke(SearchMicroposts, RouteMicropostSearch, Request{
+			Method:                "GET",
+			QueryStringParameters: map[string]string{"q": "大阪城", "cursor": body.NextCursor},
+		})
+		assert.Equal(t, 400, res.StatusCode)
+
+		body = searchMicroposts(t, a, map[string]string{"q": "東京タワー", "limit": "1", "cursor": body.NextCursor})
+		if assert.Len(t, body.Microposts, 1) {
+			assert.Equal(t, first.ID, body.Microposts[0].ID)
+		}
+		assert.Empty(t, body.NextCursor)
+
+		// 本文を変えると古いトークンでは見つからない
+		first.Content = "京都に行った"
+		assert.NoError(t, first.Update())
+
+		body = searchMicroposts(t, a, map[string]string{"q": "東京タワー"})
+		if assert.Len(t, body.Microposts, 1) {
+			assert.Equal(t, second.ID, body.Microposts[0].ID)
+		}
+
+		body = searchMicroposts(t, a, map[string]string{"q": "行った"})
+		assert.Len(t, body.Microposts, 2)
+
+		assert.NoError(t, models.DeleteMicropost(second.ID))
+
+		body = searchMicroposts(t, a, map[string]string{"q": "東京タワー"})
+		assert.Len(t, body.Microposts, 0)
+	})
+}
+
+func TestSearchMicroposts_400(t *testing.T) {
+	withDefaultAdapter(t, func(t *testing.T, a testAdapter) {
+		cases := []struct {
+			Params   map[string]string
+			Expected string
+		}{
+			{Params: map[string]string{}, Expected: "q"},
+			{Params: map[string]string{"q": "東京", "limit": "1000"}, Expected: "limit"},
+			{Params: map[string]string{"q": "東京", "cursor": "!!"}, Expected: "cursor"},
+		}
+
+		for i, c := range cases {
+			msg := fmt.Sprintf("Case:%d", i+1)
+
+			res := a.Invoke(SearchMicroposts, RouteMicropostSearch, Request{
+				Method:                "GET",
+				QueryStringParameters: c.Params,
+			})
+			assert.Equal(t, 400, res.StatusCode, msg)
+
+			var body Response400Body
+			err := json.Unmarshal([]byte(res.Body), &body)
+			assert.NoError(t, err, msg)
+			assert.Contains(t, body.Details, c.Expected, msg)
+		}
+	})
+}
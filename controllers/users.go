@@ -1,33 +1,30 @@
 package controllers
 
 import (
-	"encoding/json"
 	"sam-book-sample/models"
 	"sam-book-sample/utils"
 
 	"github.com/pkg/errors"
-
-	"github.com/aws/aws-lambda-go/events"
 )
 
-var ValidateUserSettings = []*ValidatorSetting{
-	{ArgName: "user_name", ValidateTags: "required"},
-	{ArgName: "email", ValidateTags: "required,email"},
+var ValidateUserPathSettings = []*ValidatorSetting{
+	{ArgName: "user_id", ValidateTags: "required,uint"},
 }
 
 type RequestPutUser struct {
-	Name  string `json:"user_name"`
-	Email string `json:"email"`
+	Name  string `json:"user_name" validate:"required"`
+	Email string `json:"email" validate:"required,email"`
 }
 
-var ValidatorPostSetting = []*ValidatorSetting{
-	{ArgName: "user_name", ValidateTags: "required"},
-	{ArgName: "email", ValidateTags: "required,email"},
+type RequestPostUser struct {
+	Name  string `json:"user_name" validate:"required"`
+	Email string `json:"email" validate:"required,email"`
 }
 
-type RequestPostUser struct {
-	Name  string `json:"user_name"`
-	Email string `json:"email"`
+// RequestPatchUser は merge patch の body。含まれていない項目は nil になる
+type RequestPatchUser struct {
+	Name  *string `json:"user_name" validate:"required"`
+	Email *string `json:"email" validate:"required,email"`
 }
 
 type UserResponse struct {
@@ -36,151 +33,210 @@ type UserResponse struct {
 	Email string `json:"email"`
 }
 
+// UsersResponse の要素は fields= で項目を絞った UserResponse
 type UsersResponse struct {
-	Users []*UserResponse `json:"users"`
+	Users []interface{}    `json:"users"`
+	Meta  *models.ListMeta `json:"meta"`
 }
 
-func isUniqueEmail(email string, exceptID uint64) (bool, error) {
-	user, err := models.GetUserByEmail(email)
-	if err != nil {
-		return false, errors.WithStack(err)
+func newUserResponse(u *models.User) *UserResponse {
+	return &UserResponse{
+		ID:    u.ID,
+		Name:  u.Name,
+		Email: u.Email,
 	}
-
-	return user == nil || user.ID == exceptID, nil
 }
 
-func PostUsers(request events.APIGatewayProxyRequest) events.APIGatewayProxyResponse {
-	validErr := ValidateBody(request.Body, ValidatorPostSetting)
-	if validErr != nil {
-		return Response400(*validErr)
-	}
-
+func PostUsers(request Request) Response {
 	var req RequestPostUser
-	err := json.Unmarshal([]byte(request.Body), &req)
-	if err != nil {
-		return Response500(err)
-	}
-
-	isUniq, err := isUniqueEmail(req.Email, 0)
-	if err != nil {
-		return Response500(err)
-	}
-	if !isUniq {
-		return Response400(map[string]error{
-			"email": ErrUniq,
-		})
+	validErr := DecodeBody(request.Body, &req)
+	if validErr != nil {
+		return RenderError(request, NewValidationError(*validErr))
 	}
 
+	// メールアドレスの一意性はトランザクションの条件で保証する。重複は models.ErrDuplicateEmail で返る
 	user := &models.User{
 		Name:  req.Name,
 		Email: req.Email,
 	}
-	err = user.Create()
+	err := user.Create()
 	if err != nil {
-		return Response500(err)
+		return RenderError(request, err)
 	}
 
 	return Response201(user.ID)
 }
 
-func PutUser(request events.APIGatewayProxyRequest) events.APIGatewayProxyResponse {
-	validErr := ValidateBody(request.Body, ValidateUserSettings)
+func PutUser(request Request) Response {
+	var req RequestPutUser
+	validErr := MergeErrors(
+		ValidateParams(request.PathParameters, ValidateUserPathSettings),
+		DecodeBody(request.Body, &req),
+	)
 	if validErr != nil {
-		return Response400(*validErr)
+		return RenderError(request, NewValidationError(*validErr))
 	}
 
-	var req RequestPutUser
-	err := json.Unmarshal([]byte(request.Body), &req)
+	id, err := utils.ParseUint(request.PathParameters["user_id"])
 	if err != nil {
-		return Response500(err)
+		return RenderError(request, err)
 	}
 
-	id, err := utils.ParseUint(request.PathParameters["user_id"])
+	user, err := models.GetUserByID(id)
 	if err != nil {
-		return Response500(err)
+		return RenderError(request, err)
 	}
 
-	isUniq, err := isUniqueEmail(req.Email, id)
+	user.Email = req.Email
+	user.Name = req.Name
+
+	err = user.Update()
 	if err != nil {
-		return Response500(err)
+		return RenderError(request, err)
 	}
-	if !isUniq {
-		return Response400(map[string]error{
-			"email": ErrUniq,
-		})
+
+	return Response200OK()
+}
+
+func PatchUser(request Request) Response {
+	var req RequestPatchUser
+	validErr := MergeErrors(
+		ValidateParams(request.PathParameters, ValidateUserPathSettings),
+		DecodePatch(request.Body, &req),
+	)
+	if validErr != nil {
+		return RenderError(request, NewValidationError(*validErr))
 	}
 
-	user, err := models.GetUserByID(id)
+	id, err := utils.ParseUint(request.PathParameters["user_id"])
 	if err != nil {
-		return Response500(err)
+		return RenderError(request, err)
 	}
-	if user == nil {
-		return Response404()
+
+	err = models.PatchUser(id, &models.UserPatch{
+		Name:  req.Name,
+		Email: req.Email,
+	})
+	if err != nil {
+		return RenderError(request, err)
 	}
 
-	user.Email = req.Email
-	user.Name = req.Name
+	return Response200OK()
+}
 
-	err = user.Update()
+// loadUserIncludes は include= の関連リソースをユーザーの ID ごとに読む
+func loadUserIncludes(users []*models.User, includes Includes) (map[uint64]map[string]interface{}, error) {
+	embedded := map[uint64]map[string]interface{}{}
+	if !includes["microposts"] {
+		return embedded, nil
+	}
+
+	ids := make([]uint64, len(users))
+	for i, u := range users {
+		ids[i] = u.ID
+	}
+
+	microposts, err := models.GetLatestMicropostsByUserIDs(ids, includedMicropostsLimit)
 	if err != nil {
-		return Response500(err)
+		return nil, errors.WithStack(err)
 	}
 
-	return Response200OK()
+	for _, u := range users {
+		resMicroposts := make([]*ResponseMicropost, len(microposts[u.ID]))
+		for i, m := range microposts[u.ID] {
+			resMicroposts[i] = newResponseMicropost(m)
+		}
+		embedded[u.ID] = map[string]interface{}{
+			"microposts": resMicroposts,
+		}
+	}
+
+	return embedded, nil
 }
 
-func GetUsers(request events.APIGatewayProxyRequest) events.APIGatewayProxyResponse {
-	users, err := models.GetUsers()
+func GetUsers(request Request) Response {
+	fields, fieldsErr := ParseFields(request.QueryStringParameters, UserFieldsSetting)
+	includes, includeErr := ParseIncludes(request.QueryStringParameters, UserIncludeSetting)
+	opts, listErr := ParseListOptions(request.QueryStringParameters, UserListSetting)
+	validErr := MergeErrors(fieldsErr, includeErr, listErr)
+	if validErr != nil {
+		return RenderError(request, NewValidationError(*validErr))
+	}
+
+	extra := append(includes.Attributes(UserIncludeSetting), listAttributes(opts)...)
+	users, meta, err := models.ListUsers(opts, fields.Attributes(UserFieldsSetting, extra...)...)
 	if err != nil {
-		return Response500(err)
+		return RenderError(request, err)
 	}
 
-	var resUsers = make([]*UserResponse, len(users))
+	embedded, err := loadUserIncludes(users, includes)
+	if err != nil {
+		return RenderError(request, err)
+	}
+
+	var resUsers = make([]interface{}, len(users))
 	for i, u := range users {
-		resUsers[i] = &UserResponse{
-			ID:    u.ID,
-			Name:  u.Name,
-			Email: u.Email,
+		resUsers[i], err = fields.Select(newUserResponse(u), embedded[u.ID])
+		if err != nil {
+			return RenderError(request, err)
 		}
 	}
 
 	return Response200(&UsersResponse{
 		Users: resUsers,
+		Meta:  meta,
 	})
 }
 
-func GetUser(request events.APIGatewayProxyRequest) events.APIGatewayProxyResponse {
+func GetUser(request Request) Response {
+	fields, fieldsErr := ParseFields(request.QueryStringParameters, UserFieldsSetting)
+	includes, includeErr := ParseIncludes(request.QueryStringParameters, UserIncludeSetting)
+	validErr := MergeErrors(
+		ValidateParams(request.PathParameters, ValidateUserPathSettings),
+		fieldsErr,
+		includeErr,
+	)
+	if validErr != nil {
+		return RenderError(request, NewValidationError(*validErr))
+	}
+
 	userID, err := utils.ParseUint(request.PathParameters["user_id"])
 	if err != nil {
-		return Response500(err)
+		return RenderError(request, err)
 	}
 
-	user, err := models.GetUserByID(userID)
+	user, err := models.GetUserByID(userID, fields.Attributes(UserFieldsSetting, includes.Attributes(UserIncludeSetting)...)...)
 	if err != nil {
-		return Response500(err)
+		return RenderError(request, err)
 	}
-	if user == nil {
-		return Response404()
+
+	embedded, err := loadUserIncludes([]*models.User{user}, includes)
+	if err != nil {
+		return RenderError(request, err)
 	}
 
-	res := &UserResponse{
-		ID:    user.ID,
-		Name:  user.Name,
-		Email: user.Email,
+	res, err := fields.Select(newUserResponse(user), embedded[user.ID])
+	if err != nil {
+		return RenderError(request, err)
 	}
 
 	return Response200(res)
 }
 
-func DeleteUser(request events.APIGatewayProxyRequest) events.APIGatewayProxyResponse {
+func DeleteUser(request Request) Response {
+	validErr := ValidateParams(request.PathParameters, ValidateUserPathSettings)
+	if validErr != nil {
+		return RenderError(request, NewValidationError(*validErr))
+	}
+
 	id, err := utils.ParseUint(request.PathParameters["user_id"])
 	if err != nil {
-		return Response500(err)
+		return RenderError(request, err)
 	}
 
 	err = models.DeleteUser(id)
 	if err != nil {
-		return Response500(err)
+		return RenderError(request, err)
 	}
 
 	return Response200OK()
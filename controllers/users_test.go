@@ -6,308 +6,781 @@ import (
 	"sam-book-sample/db"
 	"sam-book-sample/mocks"
 	"sam-book-sample/models"
+	"sync"
 	"testing"
 
-	"github.com/aws/aws-lambda-go/events"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestPostUsers_201(t *testing.T) {
-	mocks.SetupDB(t)
-	defer db.DropTable()
+	forEachAdapter(t, func(t *testing.T, a testAdapter) {
+		mocks.SetupDB(t)
+		defer db.DropTable()
+
+		body := map[string]interface{}{
+			"user_name": "テスト名前",
+			"email":     "test@example.com",
+		}
+		bodyStr, err := json.Marshal(body)
+		assert.NoError(t, err)
 
-	body := map[string]interface{}{
-		"user_name": "テスト名前",
-		"email":     "test@example.com",
-	}
-	bodyStr, err := json.Marshal(body)
-	assert.NoError(t, err)
+		res := a.Invoke(PostUsers, RouteUsers, Request{
+			Method: "POST",
+			Body:   string(bodyStr),
+		})
+
+		assert.Equal(t, 201, res.StatusCode)
+
+		var resBody map[string]interface{}
+		err = json.Unmarshal([]byte(res.Body), &resBody)
+		assert.NoError(t, err)
 
-	res := PostUsers(events.APIGatewayProxyRequest{
-		Body: string(bodyStr),
+		id := uint64(resBody["id"].(float64))
+		assert.Equal(t, uint64(1), id)
+
+		user, err := models.GetUserByID(id)
+		assert.NoError(t, err)
+		assert.Equal(t, body["user_name"].(string), user.Name)
+		assert.Equal(t, body["email"].(string), user.Email)
 	})
+}
 
-	assert.Equal(t, 201, res.StatusCode)
+func TestPostUsers_400(t *testing.T) {
+	forEachAdapter(t, func(t *testing.T, a testAdapter) {
+		mocks.SetupDB(t)
+		defer db.DropTable()
+
+		userGen := mocks.User()
+		userMock := userGen.Single(0, mocks.E).(*models.User)
+
+		cases := []struct {
+			Request  map[string]interface{}
+			Expected map[string]interface{}
+		}{
+			{
+				Request: map[string]interface{}{
+					"user_name": "",
+					"email":     "",
+				},
+				Expected: map[string]interface{}{
+					"user_name": "ユーザー名を入力してください。",
+					"email":     "メールアドレスを入力してください。",
+				},
+			},
+			{
+				Request: map[string]interface{}{
+					"user_name": "hoge",
+					"email":     "test@",
+				},
+				Expected: map[string]interface{}{
+					"email": "メールアドレスの形式が不正です。",
+				},
+			},
+			{
+				Request: map[string]interface{}{
+					"user_name": "dup",
+					"email":     userMock.Email,
+				},
+				Expected: map[string]interface{}{
+					"email": "すでに登録されているメールアドレスです。",
+				},
+			},
+		}
 
-	var resBody map[string]interface{}
-	err = json.Unmarshal([]byte(res.Body), &resBody)
-	assert.NoError(t, err)
+		for i, c := range cases {
+			msg := fmt.Sprintf("Case:%d", i+1)
 
-	id := uint64(resBody["id"].(float64))
-	assert.Equal(t, uint64(1), id)
+			body := c.Request
+			bodyStr, err := json.Marshal(body)
+			assert.NoError(t, err)
 
-	user, err := models.GetUserByID(id)
-	assert.NoError(t, err)
-	assert.Equal(t, body["user_name"].(string), user.Name)
-	assert.Equal(t, body["email"].(string), user.Email)
+			res := a.Invoke(PostUsers, RouteUsers, Request{
+				Method: "POST",
+				Body:   string(bodyStr),
+			})
+
+			var resBody map[string]interface{}
+			err = json.Unmarshal([]byte(res.Body), &resBody)
+			assert.NoError(t, err)
+
+			errors := resBody["errors"].(map[string]interface{})
+
+			assert.Equal(t, 400, res.StatusCode, msg)
+			assert.Equal(t, c.Expected, errors)
+		}
+	})
 }
 
-func TestPostUsers_400(t *testing.T) {
-	mocks.SetupDB(t)
-	defer db.DropTable()
+func TestPutUser_200(t *testing.T) {
+	forEachAdapter(t, func(t *testing.T, a testAdapter) {
+		mocks.SetupDB(t)
+		defer db.DropTable()
 
-	userGen := mocks.User()
-	userMock := userGen.Single(0, mocks.E).(*models.User)
+		userGen := mocks.User()
+		userMock := userGen.Single(0, mocks.E).(*models.User)
+
+		body := map[string]interface{}{
+			"user_name": "テスト名前更新",
+			"email":     "test_update@example.com",
+		}
+		bodyStr, err := json.Marshal(body)
+		assert.NoError(t, err)
 
-	cases := []struct {
-		Request  map[string]interface{}
-		Expected map[string]interface{}
-	}{
-		{
-			Request: map[string]interface{}{
-				"user_name": "",
-				"email":     "",
+		res := a.Invoke(PutUser, RouteUser, Request{
+			Method: "PUT",
+			Body:   string(bodyStr),
+			PathParameters: map[string]string{
+				"user_id": fmt.Sprintf("%d", userMock.ID),
 			},
-			Expected: map[string]interface{}{
-				"user_name": "ユーザー名を入力してください。",
-				"email":     "メールアドレスを入力してください。",
+		})
+
+		assert.Equal(t, 200, res.StatusCode)
+
+		var resBody map[string]interface{}
+		err = json.Unmarshal([]byte(res.Body), &resBody)
+		assert.NoError(t, err)
+
+		user, err := models.GetUserByID(userMock.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, body["user_name"].(string), user.Name)
+		assert.Equal(t, body["email"].(string), user.Email)
+	})
+}
+
+func TestPutUser_200_dup(t *testing.T) {
+	forEachAdapter(t, func(t *testing.T, a testAdapter) {
+		mocks.SetupDB(t)
+		defer db.DropTable()
+
+		userGen := mocks.User()
+		userMock := userGen.Single(0, mocks.E).(*models.User)
+
+		body := map[string]interface{}{
+			"user_name": "テスト名前更新",
+			"email":     userMock.Email,
+		}
+		bodyStr, err := json.Marshal(body)
+		assert.NoError(t, err)
+
+		res := a.Invoke(PutUser, RouteUser, Request{
+			Method: "PUT",
+			Body:   string(bodyStr),
+			PathParameters: map[string]string{
+				"user_id": fmt.Sprintf("%d", userMock.ID),
 			},
-		},
-		{
-			Request: map[string]interface{}{
-				"user_name": "hoge",
-				"email":     "test@",
+		})
+
+		assert.Equal(t, 200, res.StatusCode)
+
+		var resBody map[string]interface{}
+		err = json.Unmarshal([]byte(res.Body), &resBody)
+		assert.NoError(t, err)
+
+		user, err := models.GetUserByID(userMock.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, body["user_name"].(string), user.Name)
+		assert.Equal(t, body["email"].(string), user.Email)
+	})
+}
+
+func TestPutUser_400(t *testing.T) {
+	forEachAdapter(t, func(t *testing.T, a testAdapter) {
+		mocks.SetupDB(t)
+		defer db.DropTable()
+
+		userGen := mocks.User()
+		userMock := userGen.Single(0, mocks.E).(*models.User)
+
+		dupUserMock := userGen.Single(1, mocks.E).(*models.User)
+
+		cases := []struct {
+			Request  map[string]interface{}
+			Expected map[string]interface{}
+		}{
+			{
+				Request: map[string]interface{}{
+					"user_name": "",
+					"email":     "",
+				},
+				Expected: map[string]interface{}{
+					"user_name": "ユーザー名を入力してください。",
+					"email":     "メールアドレスを入力してください。",
+				},
 			},
-			Expected: map[string]interface{}{
-				"email": "メールアドレスの形式が不正です。",
+			{
+				Request: map[string]interface{}{
+					"user_name": "hoge",
+					"email":     "test@",
+				},
+				Expected: map[string]interface{}{
+					"email": "メールアドレスの形式が不正です。",
+				},
 			},
-		},
-		{
-			Request: map[string]interface{}{
-				"user_name": "dup",
-				"email":     userMock.Email,
+			{
+				Request: map[string]interface{}{
+					"user_name": "hoge",
+					"email":     dupUserMock.Email,
+				},
+				Expected: map[string]interface{}{
+					"email": "すでに登録されているメールアドレスです。",
+				},
 			},
-			Expected: map[string]interface{}{
-				"email": "すでに登録されているメールアドレスです。",
+		}
+
+		for i, c := range cases {
+			msg := fmt.Sprintf("Case:%d", i+1)
+
+			body := c.Request
+			bodyStr, err := json.Marshal(body)
+			assert.NoError(t, err)
+
+			res := a.Invoke(PutUser, RouteUser, Request{
+				Method: "PUT",
+				Body:   string(bodyStr),
+				PathParameters: map[string]string{
+					"user_id": fmt.Sprintf("%d", userMock.ID),
+				},
+			})
+
+			var resBody map[string]interface{}
+			err = json.Unmarshal([]byte(res.Body), &resBody)
+			assert.NoError(t, err)
+
+			errors := resBody["errors"].(map[string]interface{})
+
+			assert.Equal(t, 400, res.StatusCode, msg)
+			assert.Equal(t, c.Expected, errors)
+		}
+	})
+}
+
+func TestGetUser(t *testing.T) {
+	forEachAdapter(t, func(t *testing.T, a testAdapter) {
+		mocks.SetupDB(t)
+		defer db.DropTable()
+
+		userGen := mocks.User()
+		userMock := userGen.Single(0, mocks.E).(*models.User)
+
+		res := a.Invoke(GetUser, RouteUser, Request{
+			Method: "GET",
+			PathParameters: map[string]string{
+				"user_id": fmt.Sprintf("%d", userMock.ID),
 			},
-		},
-	}
+		})
 
-	for i, c := range cases {
-		msg := fmt.Sprintf("Case:%d", i+1)
+		assert.Equal(t, 200, res.StatusCode)
 
-		body := c.Request
-		bodyStr, err := json.Marshal(body)
+		var body map[string]interface{}
+		err := json.Unmarshal([]byte(res.Body), &body)
 		assert.NoError(t, err)
+		assert.Equal(t, float64(userMock.ID), body["id"])
+		assert.Equal(t, userMock.Name, body["user_name"])
+		assert.Equal(t, userMock.Email, body["email"])
+	})
+}
+
+func TestGetUsers(t *testing.T) {
+	forEachAdapter(t, func(t *testing.T, a testAdapter) {
+		mocks.SetupDB(t)
+		defer db.DropTable()
+
+		userGen := mocks.User()
+		userMocks := userGen.Multi(2, mocks.E)
+
+		res := a.Invoke(GetUsers, RouteUsers, Request{Method: "GET"})
+
+		assert.Equal(t, 200, res.StatusCode)
+
+		var body map[string]interface{}
+		err := json.Unmarshal([]byte(res.Body), &body)
+		assert.NoError(t, err)
+
+		actualUsers := body["users"].([]interface{})
+
+		expected1 := userMocks[1].(*models.User)
+		actual1 := actualUsers[0].(map[string]interface{})
+		assert.Equal(t, float64(expected1.ID), actual1["id"])
+		assert.Equal(t, expected1.Name, actual1["user_name"])
+		assert.Equal(t, expected1.Email, actual1["email"])
+
+		expected2 := userMocks[0].(*models.User)
+		actual2 := actualUsers[1].(map[string]interface{})
+		assert.Equal(t, float64(expected2.ID), actual2["id"])
+		assert.Equal(t, expected2.Name, actual2["user_name"])
+		assert.Equal(t, expected2.Email, actual2["email"])
+	})
+}
+
+func TestDeleteUser(t *testing.T) {
+	forEachAdapter(t, func(t *testing.T, a testAdapter) {
+		mocks.SetupDB(t)
+		defer db.DropTable()
 
-		res := PostUsers(events.APIGatewayProxyRequest{
-			Body: string(bodyStr),
+		userGen := mocks.User()
+		userMock := userGen.Single(0, mocks.E).(*models.User)
+
+		res := a.Invoke(DeleteUser, RouteUser, Request{
+			Method: "DELETE",
+			PathParameters: map[string]string{
+				"user_id": fmt.Sprintf("%d", userMock.ID),
+			},
+		})
+
+		assert.Equal(t, 200, res.StatusCode)
+
+		users, err := models.GetUsers()
+		assert.NoError(t, err)
+		assert.Len(t, users, 0)
+	})
+}
+
+func TestPostUsers_400_body(t *testing.T) {
+	withDefaultAdapter(t, func(t *testing.T, a testAdapter) {
+		mocks.SetupDB(t)
+		defer db.DropTable()
+
+		cases := []string{
+			`{"user_name":`,
+			`[]`,
+		}
+
+		for i, body := range cases {
+			msg := fmt.Sprintf("Case:%d", i+1)
+
+			res := a.Invoke(PostUsers, RouteUsers, Request{
+				Method: "POST",
+				Body:   body,
+			})
+
+			var resBody map[string]interface{}
+			err := json.Unmarshal([]byte(res.Body), &resBody)
+			assert.NoError(t, err, msg)
+
+			errors := resBody["errors"].(map[string]interface{})
+
+			assert.Equal(t, 400, res.StatusCode, msg)
+			assert.Equal(t, "リクエストボディの形式が不正です。", errors["body"], msg)
+		}
+	})
+}
+
+func TestGetUser_400(t *testing.T) {
+	withDefaultAdapter(t, func(t *testing.T, a testAdapter) {
+		for _, userID := range []string{"abc", "-1", "1.5"} {
+			res := a.Invoke(GetUser, RouteUser, Request{
+				Method: "GET",
+				PathParameters: map[string]string{
+					"user_id": userID,
+				},
+			})
+
+			var resBody map[string]interface{}
+			err := json.Unmarshal([]byte(res.Body), &resBody)
+			assert.NoError(t, err, userID)
+
+			errors := resBody["errors"].(map[string]interface{})
+
+			assert.Equal(t, 400, res.StatusCode, userID)
+			assert.Equal(t, map[string]interface{}{
+				"user_id": "ユーザーIDは0以上の数値を入力してください。",
+			}, errors, userID)
+			assert.Equal(t, map[string]interface{}{
+				"user_id": []interface{}{
+					map[string]interface{}{
+						"code":    "uint",
+						"message": "ユーザーIDは0以上の数値を入力してください。",
+					},
+				},
+			}, resBody["details"], userID)
+		}
+	})
+}
+
+func TestGetUser_400_en(t *testing.T) {
+	withDefaultAdapter(t, func(t *testing.T, a testAdapter) {
+		res := a.Invoke(GetUser, RouteUser, Request{
+			Method: "GET",
+			Headers: map[string]string{
+				"Accept-Language": "en-US,en;q=0.9,ja;q=0.5",
+			},
+			PathParameters: map[string]string{
+				"user_id": "abc",
+			},
 		})
 
 		var resBody map[string]interface{}
-		err = json.Unmarshal([]byte(res.Body), &resBody)
+		err := json.Unmarshal([]byte(res.Body), &resBody)
 		assert.NoError(t, err)
 
-		errors := resBody["errors"].(map[string]interface{})
+		assert.Equal(t, 400, res.StatusCode)
+		assert.Equal(t, "en", res.Headers["Content-Language"])
+		assert.Equal(t, "1 field is invalid.", resBody["message"])
+		assert.Equal(t, map[string]interface{}{
+			"user_id": "User ID must be a non-negative integer.",
+		}, resBody["errors"])
+	})
+}
 
-		assert.Equal(t, 400, res.StatusCode, msg)
-		assert.Equal(t, c.Expected, errors)
-	}
+func TestGetUser_400_problem(t *testing.T) {
+	withDefaultAdapter(t, func(t *testing.T, a testAdapter) {
+		res := a.Invoke(Chain(GetUser, RequestID), RouteUser, Request{
+			Method: "GET",
+			Headers: map[string]string{
+				"Accept":       "application/problem+json",
+				"X-Request-Id": "req-1",
+			},
+			PathParameters: map[string]string{
+				"user_id": "abc",
+			},
+		})
+
+		var resBody map[string]interface{}
+		err := json.Unmarshal([]byte(res.Body), &resBody)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 400, res.StatusCode)
+		assert.Equal(t, "application/problem+json", res.Headers["Content-Type"])
+		assert.Equal(t, "/problems/validation-error", resBody["type"])
+		assert.Equal(t, float64(400), resBody["status"])
+		assert.Equal(t, "req-1", resBody["instance"])
+		assert.Equal(t, map[string]interface{}{
+			"user_id": []interface{}{
+				map[string]interface{}{
+					"code":    "uint",
+					"message": "ユーザーIDは0以上の数値を入力してください。",
+				},
+			},
+		}, resBody["errors"])
+	})
 }
 
-func TestPutUser_200(t *testing.T) {
+func TestPostUsers_concurrent(t *testing.T) {
 	mocks.SetupDB(t)
 	defer db.DropTable()
 
-	userGen := mocks.User()
-	userMock := userGen.Single(0, mocks.E).(*models.User)
-
-	body := map[string]interface{}{
-		"user_name": "テスト名前更新",
-		"email":     "test_update@example.com",
+	const n = 10
+
+	var wg sync.WaitGroup
+	responses := make([]Response, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			responses[i] = PostUsers(Request{
+				Method: "POST",
+				Body:   fmt.Sprintf(`{"user_name":"name_%d","email":"same@example.com"}`, i),
+			})
+		}(i)
 	}
-	bodyStr, err := json.Marshal(body)
-	assert.NoError(t, err)
+	wg.Wait()
 
-	res := PutUser(events.APIGatewayProxyRequest{
-		Body: string(bodyStr),
-		PathParameters: map[string]string{
-			"user_id": fmt.Sprintf("%d", userMock.ID),
-		},
-	})
+	created := 0
+	for i, res := range responses {
+		msg := fmt.Sprintf("Request:%d", i)
+		if res.StatusCode == 201 {
+			created++
+			continue
+		}
 
-	assert.Equal(t, 200, res.StatusCode)
+		var resBody map[string]interface{}
+		err := json.Unmarshal([]byte(res.Body), &resBody)
+		assert.NoError(t, err, msg)
 
-	var resBody map[string]interface{}
-	err = json.Unmarshal([]byte(res.Body), &resBody)
-	assert.NoError(t, err)
+		assert.Equal(t, 400, res.StatusCode, msg)
+		assert.Equal(t, map[string]interface{}{
+			"email": "すでに登録されているメールアドレスです。",
+		}, resBody["errors"], msg)
+	}
+	assert.Equal(t, 1, created)
 
-	user, err := models.GetUserByID(userMock.ID)
+	users, err := models.GetUsers()
 	assert.NoError(t, err)
-	assert.Equal(t, body["user_name"].(string), user.Name)
-	assert.Equal(t, body["email"].(string), user.Email)
+	assert.Len(t, users, 1)
 }
 
-func TestPutUser_200_dup(t *testing.T) {
+func TestPutUser_releaseEmail(t *testing.T) {
 	mocks.SetupDB(t)
 	defer db.DropTable()
 
 	userGen := mocks.User()
 	userMock := userGen.Single(0, mocks.E).(*models.User)
+	oldEmail := userMock.Email
 
-	body := map[string]interface{}{
-		"user_name": "テスト名前更新",
-		"email":     userMock.Email,
-	}
-	bodyStr, err := json.Marshal(body)
-	assert.NoError(t, err)
-
-	res := PutUser(events.APIGatewayProxyRequest{
-		Body: string(bodyStr),
+	res := PutUser(Request{
+		Method: "PUT",
+		Body:   `{"user_name":"hoge","email":"new@example.com"}`,
 		PathParameters: map[string]string{
 			"user_id": fmt.Sprintf("%d", userMock.ID),
 		},
 	})
-
 	assert.Equal(t, 200, res.StatusCode)
 
-	var resBody map[string]interface{}
-	err = json.Unmarshal([]byte(res.Body), &resBody)
-	assert.NoError(t, err)
+	res = PostUsers(Request{
+		Method: "POST",
+		Body:   fmt.Sprintf(`{"user_name":"fuga","email":"%s"}`, oldEmail),
+	})
+	assert.Equal(t, 201, res.StatusCode)
 
-	user, err := models.GetUserByID(userMock.ID)
-	assert.NoError(t, err)
-	assert.Equal(t, body["user_name"].(string), user.Name)
-	assert.Equal(t, body["email"].(string), user.Email)
+	res = PostUsers(Request{
+		Method: "POST",
+		Body:   `{"user_name":"piyo","email":"new@example.com"}`,
+	})
+	assert.Equal(t, 400, res.StatusCode)
 }
 
-func TestPutUser_400(t *testing.T) {
+func TestPatchUser(t *testing.T) {
+	withDefaultAdapter(t, func(t *testing.T, a testAdapter) {
+		mocks.SetupDB(t)
+		defer db.DropTable()
+
+		userGen := mocks.User()
+		userMock := userGen.Single(0, mocks.E).(*models.User)
+
+		res := a.Invoke(PatchUser, RouteUser, Request{
+			Method: "PATCH",
+			Body:   `{"user_name":"renamed"}`,
+			PathParameters: map[string]string{
+				"user_id": fmt.Sprintf("%d", userMock.ID),
+			},
+		})
+
+		assert.Equal(t, 200, res.StatusCode)
+
+		user, err := models.GetUserByID(userMock.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "renamed", user.Name)
+		assert.Equal(t, userMock.Email, user.Email)
+		assert.Equal(t, userMock.Version+1, user.Version)
+	})
+}
+
+func TestPatchUser_email(t *testing.T) {
 	mocks.SetupDB(t)
 	defer db.DropTable()
 
 	userGen := mocks.User()
 	userMock := userGen.Single(0, mocks.E).(*models.User)
-
 	dupUserMock := userGen.Single(1, mocks.E).(*models.User)
 
-	cases := []struct {
-		Request  map[string]interface{}
-		Expected map[string]interface{}
-	}{
-		{
-			Request: map[string]interface{}{
-				"user_name": "",
-				"email":     "",
-			},
-			Expected: map[string]interface{}{
-				"user_name": "ユーザー名を入力してください。",
-				"email":     "メールアドレスを入力してください。",
-			},
-		},
-		{
-			Request: map[string]interface{}{
-				"user_name": "hoge",
-				"email":     "test@",
-			},
-			Expected: map[string]interface{}{
-				"email": "メールアドレスの形式が不正です。",
-			},
-		},
-		{
-			Request: map[string]interface{}{
-				"user_name": "hoge",
-				"email":     dupUserMock.Email,
-			},
-			Expected: map[string]interface{}{
-				"email": "すでに登録されているメールアドレスです。",
+	patch := func(email string) Response {
+		return PatchUser(Request{
+			Method: "PATCH",
+			Body:   fmt.Sprintf(`{"email":"%s"}`, email),
+			PathParameters: map[string]string{
+				"user_id": fmt.Sprintf("%d", userMock.ID),
 			},
-		},
+		})
 	}
 
-	for i, c := range cases {
-		msg := fmt.Sprintf("Case:%d", i+1)
+	res := patch(dupUserMock.Email)
+	assert.Equal(t, 400, res.StatusCode)
 
-		body := c.Request
-		bodyStr, err := json.Marshal(body)
-		assert.NoError(t, err)
+	res = patch("new@example.com")
+	assert.Equal(t, 200, res.StatusCode)
+
+	user, err := models.GetUserByID(userMock.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "new@example.com", user.Email)
+	assert.Equal(t, userMock.Name, user.Name)
+
+	res = PostUsers(Request{
+		Method: "POST",
+		Body:   fmt.Sprintf(`{"user_name":"fuga","email":"%s"}`, userMock.Email),
+	})
+	assert.Equal(t, 201, res.StatusCode)
+}
 
-		res := PutUser(events.APIGatewayProxyRequest{
-			Body: string(bodyStr),
+func TestPatchUser_400(t *testing.T) {
+	withDefaultAdapter(t, func(t *testing.T, a testAdapter) {
+		res := a.Invoke(PatchUser, RouteUser, Request{
+			Method: "PATCH",
+			Body:   `{"user_name":null,"email":"test@"}`,
 			PathParameters: map[string]string{
-				"user_id": fmt.Sprintf("%d", userMock.ID),
+				"user_id": "1",
 			},
 		})
 
 		var resBody map[string]interface{}
-		err = json.Unmarshal([]byte(res.Body), &resBody)
+		err := json.Unmarshal([]byte(res.Body), &resBody)
 		assert.NoError(t, err)
 
-		errors := resBody["errors"].(map[string]interface{})
-
-		assert.Equal(t, 400, res.StatusCode, msg)
-		assert.Equal(t, c.Expected, errors)
-	}
+		assert.Equal(t, 400, res.StatusCode)
+		assert.Equal(t, map[string]interface{}{
+			"user_name": "ユーザー名を入力してください。",
+			"email":     "メールアドレスの形式が不正です。",
+		}, resBody["errors"])
+	})
 }
 
-func TestGetUser(t *testing.T) {
-	mocks.SetupDB(t)
-	defer db.DropTable()
+func TestPatchUser_404(t *testing.T) {
+	withDefaultAdapter(t, func(t *testing.T, a testAdapter) {
+		mocks.SetupDB(t)
+		defer db.DropTable()
 
-	userGen := mocks.User()
-	userMock := userGen.Single(0, mocks.E).(*models.User)
+		res := a.Invoke(PatchUser, RouteUser, Request{
+			Method: "PATCH",
+			Body:   `{"user_name":"hoge"}`,
+			PathParameters: map[string]string{
+				"user_id": "1",
+			},
+		})
 
-	res := GetUser(events.APIGatewayProxyRequest{
-		PathParameters: map[string]string{
-			"user_id": fmt.Sprintf("%d", userMock.ID),
-		},
+		assert.Equal(t, 404, res.StatusCode)
 	})
+}
 
-	assert.Equal(t, 200, res.StatusCode)
+func TestGetUsers_fields(t *testing.T) {
+	withDefaultAdapter(t, func(t *testing.T, a testAdapter) {
+		mocks.SetupDB(t)
+		defer db.DropTable()
 
-	var body map[string]interface{}
-	err := json.Unmarshal([]byte(res.Body), &body)
-	assert.NoError(t, err)
-	assert.Equal(t, float64(userMock.ID), body["id"])
-	assert.Equal(t, userMock.Name, body["user_name"])
-	assert.Equal(t, userMock.Email, body["email"])
+		userGen := mocks.User()
+		userMocks := userGen.Multi(2, mocks.E)
+
+		res := a.Invoke(GetUsers, RouteUsers, Request{
+			Method: "GET",
+			QueryStringParameters: map[string]string{
+				"fields": "id,user_name",
+			},
+		})
+
+		assert.Equal(t, 200, res.StatusCode)
+
+		var body map[string]interface{}
+		err := json.Unmarshal([]byte(res.Body), &body)
+		assert.NoError(t, err)
+
+		expected := userMocks[1].(*models.User)
+		assert.Equal(t, map[string]interface{}{
+			"id":        float64(expected.ID),
+			"user_name": expected.Name,
+		}, body["users"].([]interface{})[0])
+	})
 }
 
-func TestGetUsers(t *testing.T) {
-	mocks.SetupDB(t)
-	defer db.DropTable()
+func TestGetUsers_sort(t *testing.T) {
+	withDefaultAdapter(t, func(t *testing.T, a testAdapter) {
+		mocks.SetupDB(t)
+		defer db.DropTable()
 
-	userGen := mocks.User()
-	userMocks := userGen.Multi(2, mocks.E)
+		userGen := mocks.User()
+		userMocks := userGen.Multi(3, mocks.E)
+
+		res := a.Invoke(GetUsers, RouteUsers, Request{
+			Method: "GET",
+			QueryStringParameters: map[string]string{
+				"sort":         "-id",
+				"fields":       "user_name",
+				"email_domain": "example.com",
+			},
+		})
 
-	res := GetUsers(events.APIGatewayProxyRequest{})
+		assert.Equal(t, 200, res.StatusCode)
 
-	assert.Equal(t, 200, res.StatusCode)
+		var body struct {
+			Users []map[string]interface{} `json:"users"`
+			Meta  *models.ListMeta         `json:"meta"`
+		}
+		err := json.Unmarshal([]byte(res.Body), &body)
+		assert.NoError(t, err)
 
-	var body map[string]interface{}
-	err := json.Unmarshal([]byte(res.Body), &body)
-	assert.NoError(t, err)
+		if assert.Len(t, body.Users, 3) {
+			for i := range body.Users {
+				expected := userMocks[2-i].(*models.User)
+				assert.Equal(t, map[string]interface{}{"user_name": expected.Name}, body.Users[i])
+			}
+		}
+		assert.True(t, body.Meta.Scan)
+		assert.Equal(t, []string{"email_domain"}, body.Meta.ScanFilters)
+	})
+}
 
-	actualUsers := body["users"].([]interface{})
+func TestGetUsers_sort_400(t *testing.T) {
+	withDefaultAdapter(t, func(t *testing.T, a testAdapter) {
+		res := a.Invoke(GetUsers, RouteUsers, Request{
+			Method: "GET",
+			QueryStringParameters: map[string]string{
+				"sort":          "password",
+				"created_after": "yesterday",
+			},
+		})
 
-	expected1 := userMocks[1].(*models.User)
-	actual1 := actualUsers[0].(map[string]interface{})
-	assert.Equal(t, float64(expected1.ID), actual1["id"])
-	assert.Equal(t, expected1.Name, actual1["user_name"])
-	assert.Equal(t, expected1.Email, actual1["email"])
+		assert.Equal(t, 400, res.StatusCode)
 
-	expected2 := userMocks[0].(*models.User)
-	actual2 := actualUsers[1].(map[string]interface{})
-	assert.Equal(t, float64(expected2.ID), actual2["id"])
-	assert.Equal(t, expected2.Name, actual2["user_name"])
-	assert.Equal(t, expected2.Email, actual2["email"])
+		var body Response400Body
+		err := json.Unmarshal([]byte(res.Body), &body)
+		assert.NoError(t, err)
+		assert.Equal(t, "sort", body.Details["sort"][0].Code)
+		assert.Equal(t, "datetime", body.Details["created_after"][0].Code)
+	})
 }
 
-func TestDeleteUser(t *testing.T) {
-	mocks.SetupDB(t)
-	defer db.DropTable()
+func TestGetUser_fields_400(t *testing.T) {
+	withDefaultAdapter(t, func(t *testing.T, a testAdapter) {
+		res := a.Invoke(GetUser, RouteUser, Request{
+			Method: "GET",
+			QueryStringParameters: map[string]string{
+				"fields": "id,password",
+			},
+			PathParameters: map[string]string{
+				"user_id": "1",
+			},
+		})
 
-	userGen := mocks.User()
-	userMock := userGen.Single(0, mocks.E).(*models.User)
+		var resBody map[string]interface{}
+		err := json.Unmarshal([]byte(res.Body), &resBody)
+		assert.NoError(t, err)
 
-	res := DeleteUser(events.APIGatewayProxyRequest{
-		PathParameters: map[string]string{
-			"user_id": fmt.Sprintf("%d", userMock.ID),
-		},
+		assert.Equal(t, 400, res.StatusCode)
+		assert.Equal(t, map[string]interface{}{
+			"fields": "取得する項目に指定できない項目があります: password",
+		}, resBody["errors"])
 	})
+}
 
-	assert.Equal(t, 200, res.StatusCode)
+func TestGetUsers_include(t *testing.T) {
+	withDefaultAdapter(t, func(t *testing.T, a testAdapter) {
+		mocks.SetupDB(t)
+		defer db.DropTable()
+
+		userMocks := mocks.User().Multi(2, mocks.E)
+		user := userMocks[0].(*models.User)
+
+		for i := 0; i < includedMicropostsLimit+1; i++ {
+			micropost := &models.Micropost{
+				UserID:  user.ID,
+				Content: fmt.Sprintf("content_%d", i),
+			}
+			assert.NoError(t, micropost.Create())
+		}
+
+		res := a.Invoke(GetUsers, RouteUsers, Request{
+			Method: "GET",
+			QueryStringParameters: map[string]string{
+				"include": "microposts",
+			},
+		})
 
-	users, err := models.GetUsers()
-	assert.NoError(t, err)
-	assert.Len(t, users, 0)
+		assert.Equal(t, 200, res.StatusCode)
+
+		var body struct {
+			Users []struct {
+				ID         uint64               `json:"id"`
+				Microposts []*ResponseMicropost `json:"microposts"`
+			} `json:"users"`
+		}
+		err := json.Unmarshal([]byte(res.Body), &body)
+		assert.NoError(t, err)
+
+		for _, u := range body.Users {
+			if u.ID != user.ID {
+				assert.Len(t, u.Microposts, 0)
+				continue
+			}
+			if assert.Len(t, u.Microposts, includedMicropostsLimit) {
+				assert.Equal(t, fmt.Sprintf("content_%d", includedMicropostsLimit), u.Microposts[0].Content)
+			}
+		}
+	})
 }
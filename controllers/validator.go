@@ -2,11 +2,12 @@ package controllers
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/mail"
 	"reflect"
+	"sam-book-sample/logging"
 	"strconv"
-
-	"github.com/golang/glog"
+	"strings"
 
 	"github.com/pkg/errors"
 
@@ -18,8 +19,27 @@ var (
 	ErrUint     = validator.TextErr{Err: errors.New("invalid uint")}
 	ErrEmail    = validator.TextErr{Err: errors.New("invalid email")}
 	ErrUniq     = validator.TextErr{Err: errors.New("unique email")}
+	ErrBody     = validator.TextErr{Err: errors.New("invalid body")}
+	ErrType     = validator.TextErr{Err: errors.New("invalid type")}
+
+	ErrUnknownField = validator.TextErr{Err: errors.New("unknown field")}
 )
 
+// ParamError は max=140 のようにパラメータを持つタグの検証エラー
+type ParamError struct {
+	Err   error
+	Tag   string
+	Param string
+}
+
+func (e *ParamError) Error() string {
+	return fmt.Sprintf("%s (%s=%s)", e.Err.Error(), e.Tag, e.Param)
+}
+
+func (e *ParamError) Cause() error {
+	return e.Err
+}
+
 type ValidatorSetting struct {
 	ArgName      string
 	ValidateTags string
@@ -29,6 +49,7 @@ func initValidator() {
 	validator.SetValidationFunc("required", requiredValidator)
 	validator.SetValidationFunc("uint", uintValidator)
 	validator.SetValidationFunc("email", emailValidator)
+	validator.SetValidationFunc("datetime", datetimeValidator)
 }
 
 func Validate(params map[string]interface{}, settings []*ValidatorSetting) *map[string]error {
@@ -36,10 +57,74 @@ func Validate(params map[string]interface{}, settings []*ValidatorSetting) *map[
 
 	errs := map[string]error{}
 	for _, setting := range settings {
-		err := validator.Valid(params[setting.ArgName], setting.ValidateTags)
+		err := validateValue(params[setting.ArgName], setting.ValidateTags)
 		if err != nil {
-			arr := err.(validator.ErrorArray)
-			errs[setting.ArgName] = arr[0]
+			errs[setting.ArgName] = err
+		}
+	}
+
+	if len(errs) > 0 {
+		return &errs
+	}
+
+	return nil
+}
+
+// validateValue は tags をすべて検証する。失敗がひとつならそのエラーを、
+// 複数なら validator.ErrorArray を返す
+func validateValue(v interface{}, tags string) error {
+	// nil のポインタは値がないものとして検証する
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr && rv.IsNil() {
+		v = nil
+	}
+
+	var errs validator.ErrorArray
+	for _, tag := range strings.Split(tags, ",") {
+		err := validator.Valid(v, tag)
+		if err == nil {
+			continue
+		}
+
+		arr, ok := err.(validator.ErrorArray)
+		if !ok {
+			return errors.WithStack(err)
+		}
+
+		kv := strings.SplitN(tag, "=", 2)
+		if len(kv) == 2 {
+			errs = append(errs, &ParamError{Err: arr[0], Tag: kv[0], Param: kv[1]})
+		} else {
+			errs = append(errs, arr[0])
+		}
+	}
+
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		return errs
+	}
+}
+
+// errorList は validateValue の結果を個々のエラーに分ける
+func errorList(err error) []error {
+	if arr, ok := err.(validator.ErrorArray); ok {
+		return arr
+	}
+	return []error{err}
+}
+
+// MergeErrors は複数の検証結果をひとつにまとめる
+func MergeErrors(results ...*map[string]error) *map[string]error {
+	errs := map[string]error{}
+	for _, r := range results {
+		if r == nil {
+			continue
+		}
+		for k, v := range *r {
+			errs[k] = v
 		}
 	}
 
@@ -58,13 +143,186 @@ func ValidateParams(params map[string]string, settings []*ValidatorSetting) *map
 	return Validate(p, settings)
 }
 
-func ValidateBody(body string, settings []*ValidatorSetting) *map[string]error {
-	var b map[string]interface{}
-	err := json.Unmarshal([]byte(body), &b)
-	if err != nil {
-		return &map[string]error{}
+const (
+	validateTagName = "validate"
+	// 配列の各要素に適用するタグ
+	eachTagName = "each"
+)
+
+type bodyField struct {
+	Name  string
+	Index []int
+	Tags  string
+	Each  string
+}
+
+// bodyFields は json タグの名前と validate タグを埋め込み構造体も含めて取り出す
+func bodyFields(t reflect.Type) []bodyField {
+	var fields []bodyField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			for _, ef := range bodyFields(f.Type) {
+				ef.Index = append([]int{i}, ef.Index...)
+				fields = append(fields, ef)
+			}
+			continue
+		}
+
+		if f.PkgPath != "" {
+			continue
+		}
+
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		fields = append(fields, bodyField{
+			Name:  name,
+			Index: []int{i},
+			Tags:  f.Tag.Get(validateTagName),
+			Each:  f.Tag.Get(eachTagName),
+		})
 	}
-	return Validate(b, settings)
+	return fields
+}
+
+// DecodeBody は body を構造体へのポインタ v にデコードし、validate タグで検証する。
+// 未知の項目、型の誤り、検証エラーは "profile.name" や "tags[2]" のような項目のパスをキーにして返す
+func DecodeBody(body string, v interface{}) *map[string]error {
+	return decodeRequestBody(body, v, false)
+}
+
+// DecodePatch は RFC 7396 の merge patch を v にデコードし、body に含まれている項目だけを検証する。
+// v の項目をポインタにしておくと、含まれていない項目は nil のまま残る
+func DecodePatch(body string, v interface{}) *map[string]error {
+	return decodeRequestBody(body, v, true)
+}
+
+func decodeRequestBody(body string, v interface{}, partial bool) *map[string]error {
+	initValidator()
+
+	d := &bodyDecoder{
+		errs:    map[string]error{},
+		partial: partial,
+	}
+	if !d.decodeObject(json.RawMessage(body), reflect.ValueOf(v).Elem(), "") {
+		d.errs = map[string]error{
+			"body": ErrBody,
+		}
+	}
+
+	if len(d.errs) > 0 {
+		return &d.errs
+	}
+
+	return nil
+}
+
+type bodyDecoder struct {
+	errs map[string]error
+	// partial なら含まれていない項目を検証しない
+	partial bool
+}
+
+func (d *bodyDecoder) decodeObject(raw json.RawMessage, rv reflect.Value, prefix string) bool {
+	var obj map[string]json.RawMessage
+	err := json.Unmarshal(raw, &obj)
+	if err != nil || obj == nil {
+		return false
+	}
+
+	known := map[string]bool{}
+	for _, f := range bodyFields(rv.Type()) {
+		known[f.Name] = true
+		path := prefix + f.Name
+
+		fv := rv.FieldByIndex(f.Index)
+		r, ok := obj[f.Name]
+		if ok {
+			if !d.decodeValue(r, fv, path, f.Each) {
+				d.errs[path] = ErrType
+				continue
+			}
+		} else if d.partial {
+			continue
+		}
+
+		if f.Tags == "" {
+			continue
+		}
+
+		err := validateValue(fv.Interface(), f.Tags)
+		if err != nil {
+			d.errs[path] = err
+		}
+	}
+
+	for name := range obj {
+		if !known[name] {
+			d.errs[prefix+name] = ErrUnknownField
+		}
+	}
+
+	return true
+}
+
+func (d *bodyDecoder) decodeValue(raw json.RawMessage, fv reflect.Value, path, each string) bool {
+	if _, ok := fv.Addr().Interface().(json.Unmarshaler); ok {
+		return json.Unmarshal(raw, fv.Addr().Interface()) == nil
+	}
+
+	if string(raw) == "null" {
+		fv.Set(reflect.Zero(fv.Type()))
+		return true
+	}
+
+	switch fv.Kind() {
+	case reflect.Struct:
+		return d.decodeObject(raw, fv, path+".")
+	case reflect.Ptr:
+		if fv.Type().Elem().Kind() != reflect.Struct {
+			break
+		}
+		ptr := reflect.New(fv.Type().Elem())
+		if !d.decodeObject(raw, ptr.Elem(), path+".") {
+			return false
+		}
+		fv.Set(ptr)
+		return true
+	case reflect.Slice:
+		var items []json.RawMessage
+		err := json.Unmarshal(raw, &items)
+		if err != nil {
+			return false
+		}
+
+		slice := reflect.MakeSlice(fv.Type(), len(items), len(items))
+		for i, item := range items {
+			itemPath := fmt.Sprintf("%s[%d]", path, i)
+			ev := slice.Index(i)
+			if !d.decodeValue(item, ev, itemPath, "") {
+				d.errs[itemPath] = ErrType
+				continue
+			}
+			if each == "" {
+				continue
+			}
+			err := validateValue(ev.Interface(), each)
+			if err != nil {
+				d.errs[itemPath] = err
+			}
+		}
+		fv.Set(slice)
+		return true
+	}
+
+	return json.Unmarshal(raw, fv.Addr().Interface()) == nil
 }
 
 func requiredValidator(v interface{}, param string) error {
@@ -96,18 +354,17 @@ func uintValidator(v interface{}, param string) error {
 
 	switch st.Kind() {
 	case reflect.String:
-		n64, err := strconv.ParseInt(st.String(), 10, 64)
+		_, err := strconv.ParseUint(st.String(), 10, 64)
 		if err != nil {
-			glog.Warningf("%s:%s", param, err.Error())
-			return validator.ErrUnsupported
+			return ErrUint
 		}
-		n = int(n64)
+		return nil
 	case reflect.Int:
 		n = v.(int)
 	case reflect.Float64:
 		n = int(v.(float64))
 	default:
-		glog.Warningf("%s:%s", param, st.Kind())
+		logging.Default().Warnf("%s:%s", param, st.Kind())
 		return validator.ErrUnsupported
 	}
 
@@ -131,7 +388,7 @@ func emailValidator(v interface{}, param string) error {
 
 	_, err := mail.ParseAddress(st.String())
 	if err != nil {
-		glog.Warningf("failed to parse %s: %s", st.String(), err.Error())
+		logging.Default().WithError(err).Warn("failed to parse email")
 		return ErrEmail
 	}
 
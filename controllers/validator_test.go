@@ -0,0 +1,215 @@
+package controllers
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/validator.v2"
+)
+
+func TestDecodeBody(t *testing.T) {
+	var req RequestPostMicropost
+	validErr := DecodeBody(`{"content":"hello"}`, &req)
+
+	assert.Nil(t, validErr)
+	assert.Equal(t, "hello", req.Content)
+}
+
+func TestDecodeBody_400(t *testing.T) {
+	cases := []struct {
+		Body     string
+		Expected map[string]error
+	}{
+		{
+			Body:     `{"user_name":`,
+			Expected: map[string]error{"body": ErrBody},
+		},
+		{
+			Body:     `"text"`,
+			Expected: map[string]error{"body": ErrBody},
+		},
+		{
+			Body: `{}`,
+			Expected: map[string]error{
+				"user_name": ErrRequired,
+				"email":     ErrRequired,
+			},
+		},
+		{
+			Body: `{"user_name":1,"email":["test@example.com"]}`,
+			Expected: map[string]error{
+				"user_name": ErrType,
+				"email":     ErrType,
+			},
+		},
+		{
+			Body: `{"user_name":"hoge","email":"test@example.com","admin":true}`,
+			Expected: map[string]error{
+				"admin": ErrUnknownField,
+			},
+		},
+		{
+			Body: `{"user_name":null,"email":"test@"}`,
+			Expected: map[string]error{
+				"user_name": ErrRequired,
+				"email":     ErrEmail,
+			},
+		},
+	}
+
+	for i, c := range cases {
+		msg := fmt.Sprintf("Case:%d", i+1)
+
+		var req RequestPostUser
+		validErr := DecodeBody(c.Body, &req)
+
+		if assert.NotNil(t, validErr, msg) {
+			assert.Equal(t, c.Expected, *validErr, msg)
+		}
+	}
+}
+
+func TestDecodeBody_embedded(t *testing.T) {
+	var req RequestPutMicropost
+	validErr := DecodeBody(fmt.Sprintf(`{"content":"%s"}`, strings.Repeat("a", 141)), &req)
+
+	if assert.NotNil(t, validErr) {
+		assert.Equal(t, map[string]error{
+			"content": &ParamError{Err: validator.ErrMax, Tag: "max", Param: "140"},
+		}, *validErr)
+	}
+}
+
+type testProfile struct {
+	Name string `json:"name" validate:"required"`
+}
+
+type testNestedBody struct {
+	Email    string         `json:"email" validate:"min=10,email"`
+	Tags     []string       `json:"tags" validate:"max=3" each:"required,max=5"`
+	Profile  testProfile    `json:"profile"`
+	Profiles []*testProfile `json:"profiles"`
+}
+
+func TestDecodeBody_nested(t *testing.T) {
+	body := `{
+		"email": "a@",
+		"tags": ["go", "", "toolong", 1],
+		"profile": {"name": "", "age": 20},
+		"profiles": [{"name": "ok"}, {"name": ""}, "str"]
+	}`
+
+	var req testNestedBody
+	validErr := DecodeBody(body, &req)
+
+	if assert.NotNil(t, validErr) {
+		assert.Equal(t, map[string]error{
+			"email": validator.ErrorArray{
+				&ParamError{Err: validator.ErrMin, Tag: "min", Param: "10"},
+				ErrEmail,
+			},
+			"tags":             &ParamError{Err: validator.ErrMax, Tag: "max", Param: "3"},
+			"tags[1]":          ErrRequired,
+			"tags[2]":          &ParamError{Err: validator.ErrMax, Tag: "max", Param: "5"},
+			"tags[3]":          ErrType,
+			"profile.name":     ErrRequired,
+			"profile.age":      ErrUnknownField,
+			"profiles[1].name": ErrRequired,
+			"profiles[2]":      ErrType,
+		}, *validErr)
+	}
+
+	assert.Equal(t, "go", req.Tags[0])
+	assert.Equal(t, "ok", req.Profiles[0].Name)
+}
+
+func TestConvertErrorsToFieldErrors(t *testing.T) {
+	errs := map[string]error{
+		"email": validator.ErrorArray{
+			ErrRequired,
+			ErrUniq,
+		},
+		"content": &ParamError{Err: validator.ErrMax, Tag: "max", Param: "140"},
+		"tags[2]": ErrRequired,
+	}
+
+	l := localizerFor(Request{})
+
+	assert.Equal(t, map[string][]*FieldError{
+		"email": {
+			{Code: "required", Message: "メールアドレスを入力してください。"},
+			{Code: "unique", Message: "すでに登録されているメールアドレスです。"},
+		},
+		"content": {
+			{Code: "max", Message: "本文は140文字以内で入力してください。"},
+		},
+		"tags[2]": {
+			{Code: "required", Message: "tagsを入力してください。"},
+		},
+	}, ConvertErrorsToFieldErrors(l, errs))
+
+	assert.Equal(t, map[string]string{
+		"email":   "メールアドレスを入力してください。",
+		"content": "本文は140文字以内で入力してください。",
+		"tags[2]": "tagsを入力してください。",
+	}, ConvertErrorsToMessage(l, errs))
+}
+
+func TestDecodePatch(t *testing.T) {
+	cases := []struct {
+		Body     string
+		Name     *string
+		Email    *string
+		Expected map[string]error
+	}{
+		{
+			Body: `{}`,
+		},
+		{
+			Body: `{"user_name":"hoge"}`,
+			Name: stringPtr("hoge"),
+		},
+		{
+			Body: `{"email":"test@"}`,
+			Expected: map[string]error{
+				"email": ErrEmail,
+			},
+		},
+		{
+			Body: `{"user_name":null,"email":""}`,
+			Expected: map[string]error{
+				"user_name": ErrRequired,
+				"email":     ErrRequired,
+			},
+		},
+		{
+			Body: `null`,
+			Expected: map[string]error{
+				"body": ErrBody,
+			},
+		},
+	}
+
+	for i, c := range cases {
+		msg := fmt.Sprintf("Case:%d", i+1)
+
+		var req RequestPatchUser
+		validErr := DecodePatch(c.Body, &req)
+
+		if c.Expected == nil {
+			assert.Nil(t, validErr, msg)
+			assert.Equal(t, c.Name, req.Name, msg)
+			assert.Equal(t, c.Email, req.Email, msg)
+			continue
+		}
+		if assert.NotNil(t, validErr, msg) {
+			assert.Equal(t, c.Expected, *validErr, msg)
+		}
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
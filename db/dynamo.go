@@ -3,13 +3,12 @@ package db
 import (
 	"fmt"
 	"os"
+	"sam-book-sample/logging"
 	"sam-book-sample/settings"
 	"sam-book-sample/utils"
 
 	"github.com/aws/aws-sdk-go/aws/credentials"
 
-	"github.com/golang/glog"
-
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
@@ -20,6 +19,13 @@ import (
 const PKName = "PK"
 const SKName = "SK"
 
+// UserIDCreatedAtIndex はユーザーごとに作成日時順で読むための GSI。UserID と CreatedAt を持つ項目だけが入る
+// ユーザーの Micropost の一覧に混ざらないよう、他の項目はユーザーを OwnerID や AuthorID などの名前で持つ
+const UserIDCreatedAtIndex = "UserID-CreatedAt-index"
+
+// InvertedIndex は PK と SK を入れ替えた GSI。隣接リストの項目を逆向きにたどるために使う
+const InvertedIndex = "SK-PK-index"
+
 type MainTable struct {
 	PK string `dynamo:"PK,hash"`
 	SK string `dynamo:"SK,range"`
@@ -84,6 +90,25 @@ func MigrateForTest() error {
 	err = db.
 		CreateTable(settings.Env().DynamoTableName(), MainTable{}).
 		Provision(100, 100).
+		Index(dynamo.Index{
+			Name:           UserIDCreatedAtIndex,
+			HashKey:        "UserID",
+			HashKeyType:    dynamo.NumberType,
+			RangeKey:       "CreatedAt",
+			RangeKeyType:   dynamo.StringType,
+			ProjectionType: dynamo.AllProjection,
+			Throughput:     dynamo.Throughput{Read: 100, Write: 100},
+		}).
+		Index(dynamo.Index{
+			Name:              InvertedIndex,
+			HashKey:           SKName,
+			HashKeyType:       dynamo.StringType,
+			RangeKey:          PKName,
+			RangeKeyType:      dynamo.StringType,
+			ProjectionType:    dynamo.IncludeProjection,
+			ProjectionAttribs: []string{"FollowerID", "FolloweeID", "CreatedAt"},
+			Throughput:        dynamo.Throughput{Read: 100, Write: 100},
+		}).
 		Run()
 
 	if err != nil {
@@ -93,7 +118,7 @@ func MigrateForTest() error {
 	if settings.Env().IsDebug() {
 		err = DescribeTable()
 		if err != nil {
-			glog.Warningf("Failed to describe table: %s", err.Error())
+			logging.Default().WithError(err).Warn("Failed to describe table")
 		}
 	}
 
@@ -111,7 +136,7 @@ func DescribeTable() error {
 		return errors.WithStack(err)
 	}
 
-	glog.Infof("%#v", desc)
+	logging.Default().Infof("%#v", desc)
 
 	return nil
 }
@@ -3,15 +3,10 @@ package main
 import (
 	"sam-book-sample/controllers"
 
-	"github.com/aws/aws-lambda-go/events"
-
 	"github.com/aws/aws-lambda-go/lambda"
 )
 
-func handler(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-	return controllers.GetUser(request), nil
-}
-
 func main() {
-	lambda.Start(handler)
+	h := controllers.Chain(controllers.GetUser, controllers.DefaultMiddlewares()...)
+	lambda.Start(controllers.LambdaHandler(controllers.RouteUser, h))
 }
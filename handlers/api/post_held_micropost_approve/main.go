@@ -0,0 +1,12 @@
+package main
+
+import (
+	"sam-book-sample/controllers"
+
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+func main() {
+	h := controllers.Chain(controllers.PostHeldMicropostApprove, controllers.AdminMiddlewares()...)
+	lambda.Start(controllers.LambdaHandler(controllers.RouteHeldMicropostApprove, h))
+}
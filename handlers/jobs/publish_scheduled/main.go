@@ -0,0 +1,20 @@
+package main
+
+import (
+	"sam-book-sample/logging"
+	"sam-book-sample/models"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+// handler は毎分呼ばれ、期限の来た予約投稿を公開する
+func handler() error {
+	published, err := models.NewScheduledPublisher(time.Now).Run()
+	logging.Default().WithField("published", published).Info("published scheduled microposts")
+	return err
+}
+
+func main() {
+	lambda.Start(handler)
+}
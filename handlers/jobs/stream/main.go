@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"sam-book-sample/logging"
+	"sam-book-sample/models"
+	"sam-book-sample/streams"
+
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+// logSubscriber は受け取った変更をデバッグログに書く
+func logSubscriber(ctx context.Context, event *streams.Event) error {
+	logging.FromContext(ctx).
+		WithField("type", event.Type).
+		WithField("entity", event.Entity).
+		WithField("pk", event.Keys.PK).
+		WithField("sequence_number", event.SequenceNumber).
+		Debug("received stream event")
+	return nil
+}
+
+func main() {
+	d := streams.NewDispatcher()
+	d.Subscribe("", streams.SubscriberFunc(logSubscriber))
+	d.Subscribe((&models.Micropost{}).EntityName(), streams.SubscriberFunc(streams.FanOutFeed))
+	lambda.Start(d.Handle)
+}
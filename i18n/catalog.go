@@ -0,0 +1,67 @@
+package i18n
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"golang.org/x/text/language"
+)
+
+const DefaultLang = "ja"
+
+// Message は複数形ごとの文言。単一の文字列で書かれたものは "other" として扱う
+type Message map[string]string
+
+func (m *Message) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*m = Message{"other": s}
+		return nil
+	}
+
+	var forms map[string]string
+	if err := json.Unmarshal(b, &forms); err != nil {
+		return err
+	}
+	*m = Message(forms)
+	return nil
+}
+
+type Catalog struct {
+	Lang     string             `json:"-"`
+	Fields   map[string]string  `json:"fields"`
+	Messages map[string]Message `json:"messages"`
+}
+
+var catalogs = map[string]*Catalog{}
+
+// langs は Accept-Language と照合する順序。先頭が既定の言語
+var langs []string
+
+func register(lang string, data string) {
+	c := &Catalog{Lang: lang}
+	if err := json.Unmarshal([]byte(data), c); err != nil {
+		panic(fmt.Sprintf("i18n: invalid catalog %s: %s", lang, err.Error()))
+	}
+	catalogs[lang] = c
+	langs = append(langs, lang)
+}
+
+func init() {
+	register(DefaultLang, catalogJA)
+	register("en", catalogEN)
+	matcher = language.NewMatcher(supportedTags())
+}
+
+// pluralForm は CLDR の複数形カテゴリを返す
+func pluralForm(lang string, n int64) string {
+	switch lang {
+	case "ja":
+		return "other"
+	default:
+		if n == 1 {
+			return "one"
+		}
+		return "other"
+	}
+}
@@ -0,0 +1,86 @@
+package i18n
+
+const catalogEN = `{
+  "fields": {
+    "user_id": "User ID",
+    "user_name": "User name",
+    "micropost_id": "Micropost ID",
+    "email": "Email address",
+    "content": "Content",
+    "body": "Request body",
+    "fields": "Fields",
+    "include": "Include",
+    "sort": "Sort",
+    "name_prefix": "Name prefix",
+    "email_domain": "Email domain",
+    "content_contains": "Content contains",
+    "created_after": "Created after",
+    "q": "Search query",
+    "limit": "Limit",
+    "cursor": "Cursor",
+    "followee_id": "Followee ID",
+    "liker_id": "Liker ID",
+    "viewer_id": "Viewer ID",
+    "in_reply_to_id": "Replied micropost ID",
+    "tag": "Hashtag",
+    "content_type": "Content type",
+    "size": "Size",
+    "attachment_ids": "Attachment IDs",
+    "held_id": "Held micropost ID",
+    "publish_at": "Publish at",
+    "scheduled_id": "Scheduled micropost ID"
+  },
+  "messages": {
+    "response.bad_request": {
+      "one": "{count} field is invalid.",
+      "other": "{count} fields are invalid."
+    },
+    "response.not_found": "Not found.",
+    "response.server_error": "An internal server error occurred.",
+    "response.conflict": "The request conflicted with another update. Please try again.",
+    "response.precondition_failed": "The resource has been modified by another update. Please fetch the latest version and try again.",
+    "response.forbidden": "You are not allowed to perform this operation.",
+    "response.edit_window_expired": "This micropost can no longer be edited.",
+    "problem.validation-error": "Validation Failed",
+    "problem.not-found": "Not Found",
+    "problem.internal-error": "Internal Server Error",
+    "problem.conflict": "Conflict",
+    "problem.precondition-failed": "Precondition Failed",
+    "problem.forbidden": "Forbidden",
+    "problem.edit-window-expired": "Edit Window Expired",
+    "validation.unsupported": "{field} is invalid.",
+    "validation.required": "{field} is required.",
+    "validation.len": {
+      "one": "{field} must be exactly {len} character.",
+      "other": "{field} must be exactly {len} characters."
+    },
+    "validation.min": {
+      "one": "{field} must be at least {min} character.",
+      "other": "{field} must be at least {min} characters."
+    },
+    "validation.max": {
+      "one": "{field} must be at most {max} character.",
+      "other": "{field} must be at most {max} characters."
+    },
+    "validation.email": "{field} is not a valid email address.",
+    "validation.uint": "{field} must be a non-negative integer.",
+    "validation.unique": "{field} is already taken.",
+    "validation.body": "{field} is malformed.",
+    "validation.type": "{field} has an invalid type.",
+    "validation.unknown_field": "{field} is not a known field.",
+    "validation.fields": "{field} contains fields that cannot be selected: {fields}",
+    "validation.include": "{field} contains resources that cannot be embedded: {include}",
+    "validation.sort": "{field} cannot sort by: {sort}",
+    "validation.datetime": "{field} must be an RFC 3339 date-time.",
+    "validation.limit": "{field} must be a number between 1 and {max}.",
+    "validation.cursor": "{field} is invalid. Use the value returned with the previous page.",
+    "validation.self_follow": "You cannot follow yourself.",
+    "validation.in_reply_to": "{field} does not refer to an existing micropost.",
+    "validation.content_type": "{field} must be one of: {types}",
+    "validation.attachment_size": "{field} must be between 1 and {max} bytes.",
+    "validation.attachment_count": "{field} can contain at most {max} items.",
+    "validation.attachment": "{field} contains attachments that have not been uploaded.",
+    "validation.moderation": "{field} contains words or links that are not allowed.",
+    "validation.publish_at": "{field} must be a future date-time."
+  }
+}`
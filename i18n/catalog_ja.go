@@ -0,0 +1,74 @@
+package i18n
+
+const catalogJA = `{
+  "fields": {
+    "user_id": "ユーザーID",
+    "user_name": "ユーザー名",
+    "micropost_id": "マイクロポストID",
+    "email": "メールアドレス",
+    "content": "本文",
+    "body": "リクエストボディ",
+    "fields": "取得する項目",
+    "include": "埋め込む関連リソース",
+    "sort": "並び順",
+    "name_prefix": "ユーザー名の前方一致",
+    "email_domain": "メールアドレスのドメイン",
+    "content_contains": "本文に含む文字列",
+    "created_after": "作成日時の下限",
+    "q": "検索語",
+    "limit": "取得件数",
+    "cursor": "カーソル",
+    "followee_id": "フォローするユーザーID",
+    "liker_id": "いいねするユーザーID",
+    "viewer_id": "閲覧するユーザーID",
+    "in_reply_to_id": "返信先のマイクロポストID",
+    "tag": "ハッシュタグ",
+    "content_type": "ファイルの種類",
+    "size": "ファイルの大きさ",
+    "attachment_ids": "添付ファイルID",
+    "held_id": "保留中の投稿ID",
+    "publish_at": "公開日時",
+    "scheduled_id": "予約投稿ID"
+  },
+  "messages": {
+    "response.bad_request": "入力値を確認してください。",
+    "response.not_found": "結果が見つかりません。",
+    "response.server_error": "サーバエラーが発生しました。",
+    "response.conflict": "他の更新と競合しました。再度お試しください。",
+    "response.precondition_failed": "他の更新により内容が変更されています。最新の内容を取得してから再度お試しください。",
+    "response.forbidden": "この操作を行う権限がありません。",
+    "response.edit_window_expired": "このマイクロポストは編集できる期間を過ぎています。",
+    "problem.validation-error": "入力値エラー",
+    "problem.not-found": "見つかりません",
+    "problem.internal-error": "サーバエラー",
+    "problem.conflict": "競合",
+    "problem.precondition-failed": "前提条件エラー",
+    "problem.forbidden": "権限エラー",
+    "problem.edit-window-expired": "編集期間切れ",
+    "validation.unsupported": "{field}は不正な値です。",
+    "validation.required": "{field}を入力してください。",
+    "validation.len": "{field}は{len}文字で入力してください。",
+    "validation.min": "{field}は{min}文字以上で入力してください。",
+    "validation.max": "{field}は{max}文字以内で入力してください。",
+    "validation.email": "{field}の形式が不正です。",
+    "validation.uint": "{field}は0以上の数値を入力してください。",
+    "validation.unique": "すでに登録されている{field}です。",
+    "validation.body": "{field}の形式が不正です。",
+    "validation.type": "{field}の型が不正です。",
+    "validation.unknown_field": "{field}は不明な項目です。",
+    "validation.fields": "{field}に指定できない項目があります: {fields}",
+    "validation.include": "{field}に指定できないリソースがあります: {include}",
+    "validation.sort": "{field}に指定できない項目です: {sort}",
+    "validation.datetime": "{field}はRFC3339形式の日時を入力してください。",
+    "validation.limit": "{field}は1から{max}までの数値を入力してください。",
+    "validation.cursor": "{field}が不正です。前のページの結果に含まれる値を指定してください。",
+    "validation.self_follow": "自分自身はフォローできません。",
+    "validation.in_reply_to": "{field}のマイクロポストが存在しません。",
+    "validation.content_type": "{field}は次のいずれかを指定してください: {types}",
+    "validation.attachment_size": "{field}は1から{max}バイトまでにしてください。",
+    "validation.attachment_count": "{field}は{max}件までにしてください。",
+    "validation.attachment": "{field}にアップロードされていない添付ファイルがあります。",
+    "validation.moderation": "{field}に使用できない語句やリンクが含まれています。",
+    "validation.publish_at": "{field}には未来の日時を指定してください。"
+  }
+}`
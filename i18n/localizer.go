@@ -0,0 +1,110 @@
+package i18n
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"golang.org/x/text/language"
+)
+
+type Params map[string]interface{}
+
+type Localizer struct {
+	catalog *Catalog
+}
+
+// matcher はカタログを登録し終えた init で作り、以降は読むだけにする
+var matcher language.Matcher
+
+func supportedTags() []language.Tag {
+	tags := make([]language.Tag, len(langs))
+	for i, lang := range langs {
+		tags[i] = language.Make(lang)
+	}
+	return tags
+}
+
+// NewLocalizer は Accept-Language ヘッダの値から言語を選ぶ。一致しなければ DefaultLang を使う
+func NewLocalizer(acceptLanguage string) *Localizer {
+	lang := DefaultLang
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err == nil && len(tags) > 0 {
+		_, i, conf := matcher.Match(tags...)
+		if conf != language.No {
+			lang = langs[i]
+		}
+	}
+
+	return &Localizer{catalog: catalogs[lang]}
+}
+
+func (l *Localizer) Lang() string {
+	return l.catalog.Lang
+}
+
+// Field は項目の表示名を返す
+func (l *Localizer) Field(name string) string {
+	if s, ok := l.catalog.Fields[name]; ok {
+		return s
+	}
+	if s, ok := catalogs[DefaultLang].Fields[name]; ok {
+		return s
+	}
+	return name
+}
+
+// Message は key の文言を params で埋めて返す。params["count"] があれば複数形を選ぶ
+func (l *Localizer) Message(key string, params Params) string {
+	catalog := l.catalog
+	m, ok := catalog.Messages[key]
+	if !ok {
+		catalog = catalogs[DefaultLang]
+		m, ok = catalog.Messages[key]
+	}
+	if !ok {
+		return key
+	}
+
+	form := "other"
+	if n, ok := toInt(params["count"]); ok {
+		form = pluralForm(catalog.Lang, n)
+	}
+
+	text, ok := m[form]
+	if !ok {
+		text = m["other"]
+	}
+
+	return interpolate(text, params)
+}
+
+var placeholder = regexp.MustCompile(`\{(\w+)\}`)
+
+func interpolate(text string, params Params) string {
+	return placeholder.ReplaceAllStringFunc(text, func(s string) string {
+		name := s[1 : len(s)-1]
+		v, ok := params[name]
+		if !ok {
+			return s
+		}
+		return fmt.Sprint(v)
+	})
+}
+
+func toInt(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int64:
+		return n, true
+	case uint64:
+		return int64(n), true
+	case float64:
+		return int64(n), true
+	case string:
+		i, err := strconv.ParseInt(n, 10, 64)
+		return i, err == nil
+	}
+	return 0, false
+}
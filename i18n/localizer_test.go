@@ -0,0 +1,63 @@
+package i18n
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewLocalizer(t *testing.T) {
+	cases := []struct {
+		AcceptLanguage string
+		Expected       string
+	}{
+		{AcceptLanguage: "", Expected: "ja"},
+		{AcceptLanguage: "en", Expected: "en"},
+		{AcceptLanguage: "en-GB,en;q=0.8", Expected: "en"},
+		{AcceptLanguage: "fr-FR,ja;q=0.5,en;q=0.3", Expected: "ja"},
+		{AcceptLanguage: "fr-FR", Expected: "ja"},
+		{AcceptLanguage: ";;invalid", Expected: "ja"},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.Expected, NewLocalizer(c.AcceptLanguage).Lang(), c.AcceptLanguage)
+	}
+}
+
+func TestLocalizer_Message(t *testing.T) {
+	en := NewLocalizer("en")
+	ja := NewLocalizer("ja")
+
+	params := Params{"field": en.Field("content"), "max": "1", "count": "1"}
+	assert.Equal(t, "Content must be at most 1 character.", en.Message("validation.max", params))
+
+	params = Params{"field": en.Field("content"), "max": "140", "count": "140"}
+	assert.Equal(t, "Content must be at most 140 characters.", en.Message("validation.max", params))
+
+	params = Params{"field": ja.Field("content"), "max": "140", "count": "140"}
+	assert.Equal(t, "本文は140文字以内で入力してください。", ja.Message("validation.max", params))
+
+	params = Params{"field": ja.Field("content"), "len": "8", "count": "8"}
+	assert.Equal(t, "本文は8文字で入力してください。", ja.Message("validation.len", params))
+}
+
+func TestLocalizer_fallback(t *testing.T) {
+	en := NewLocalizer("en")
+
+	assert.Equal(t, "unknown_field_name", en.Field("unknown_field_name"))
+	assert.Equal(t, "unknown.key", en.Message("unknown.key", nil))
+}
+
+func TestCatalogsHaveSameKeys(t *testing.T) {
+	base := catalogs[DefaultLang]
+	for lang, c := range catalogs {
+		for key := range base.Messages {
+			_, ok := c.Messages[key]
+			assert.True(t, ok, "%s: missing message %s", lang, key)
+		}
+		for key := range base.Fields {
+			_, ok := c.Fields[key]
+			assert.True(t, ok, "%s: missing field %s", lang, key)
+		}
+	}
+}
@@ -1,13 +1,252 @@
 package logging
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
+	"os"
 	"sam-book-sample/settings"
+	"strings"
+	"sync"
+	"time"
 
-	"github.com/golang/glog"
+	"github.com/pkg/errors"
 )
 
+type Level int
+
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+var levelNames = map[Level]string{
+	DebugLevel: "debug",
+	InfoLevel:  "info",
+	WarnLevel:  "warn",
+	ErrorLevel: "error",
+}
+
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+func ParseLevel(s string) Level {
+	for l, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return l
+		}
+	}
+	return InfoLevel
+}
+
+// 値を出力しないフィールド名 (小文字で比較する)
+var redactedKeys = map[string]bool{
+	"email":         true,
+	"password":      true,
+	"token":         true,
+	"access_token":  true,
+	"refresh_token": true,
+	"id_token":      true,
+	"authorization": true,
+	"cookie":        true,
+	"x-api-key":     true,
+}
+
+const redacted = "[REDACTED]"
+
+type Fields map[string]interface{}
+
+type Logger struct {
+	mu     *sync.Mutex
+	out    io.Writer
+	level  Level
+	fields Fields
+	now    func() time.Time
+}
+
+func New(out io.Writer, level Level) *Logger {
+	return &Logger{
+		mu:     &sync.Mutex{},
+		out:    out,
+		level:  level,
+		fields: Fields{},
+		now:    time.Now,
+	}
+}
+
+var (
+	std     *Logger
+	stdOnce sync.Once
+)
+
+func Default() *Logger {
+	stdOnce.Do(func() {
+		std = New(os.Stdout, ParseLevel(settings.Env().LogLevel()))
+	})
+	return std
+}
+
+type contextKey struct{}
+
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext は context に紐付いた Logger を返す。無ければ Default を返す
+func FromContext(ctx context.Context) *Logger {
+	if l, ok := ctx.Value(contextKey{}).(*Logger); ok {
+		return l
+	}
+	return Default()
+}
+
+func (l *Logger) With(fields Fields) *Logger {
+	merged := Fields{}
+	for k, v := range l.fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+
+	child := *l
+	child.fields = merged
+	return &child
+}
+
+func (l *Logger) WithField(key string, value interface{}) *Logger {
+	return l.With(Fields{key: value})
+}
+
+// WithError はエラーメッセージと pkg/errors のスタックトレースをフィールドに追加する
+func (l *Logger) WithError(err error) *Logger {
+	if err == nil {
+		return l
+	}
+
+	fields := Fields{"error": err.Error()}
+	if stack := stackTrace(err); stack != "" {
+		fields["stack"] = stack
+	}
+
+	return l.With(fields)
+}
+
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.level
+}
+
+func (l *Logger) log(level Level, msg string) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	entry := map[string]interface{}{}
+	for k, v := range l.fields {
+		entry[k] = redact(k, v)
+	}
+	entry["level"] = level.String()
+	entry["time"] = l.now().UTC().Format(time.RFC3339Nano)
+	entry["message"] = msg
+
+	b, err := json.Marshal(entry)
+	if err != nil {
+		b, _ = json.Marshal(map[string]interface{}{
+			"level":   ErrorLevel.String(),
+			"time":    l.now().UTC().Format(time.RFC3339Nano),
+			"message": fmt.Sprintf("failed to marshal log entry: %s", err.Error()),
+		})
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.out.Write(append(b, '\n'))
+}
+
+func (l *Logger) Debug(msg string) { l.log(DebugLevel, msg) }
+func (l *Logger) Info(msg string)  { l.log(InfoLevel, msg) }
+func (l *Logger) Warn(msg string)  { l.log(WarnLevel, msg) }
+func (l *Logger) Error(msg string) { l.log(ErrorLevel, msg) }
+
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.log(DebugLevel, fmt.Sprintf(format, args...))
+}
+
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.log(InfoLevel, fmt.Sprintf(format, args...))
+}
+
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	l.log(WarnLevel, fmt.Sprintf(format, args...))
+}
+
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.log(ErrorLevel, fmt.Sprintf(format, args...))
+}
+
+func redact(key string, v interface{}) interface{} {
+	if redactedKeys[strings.ToLower(key)] {
+		return redacted
+	}
+
+	switch t := v.(type) {
+	case Fields:
+		return redactMap(t)
+	case map[string]interface{}:
+		return redactMap(t)
+	case map[string]string:
+		m := map[string]interface{}{}
+		for k, s := range t {
+			m[k] = s
+		}
+		return redactMap(m)
+	}
+
+	return v
+}
+
+func redactMap(m map[string]interface{}) map[string]interface{} {
+	ret := map[string]interface{}{}
+	for k, v := range m {
+		ret[k] = redact(k, v)
+	}
+	return ret
+}
+
+type stackTracer interface {
+	StackTrace() errors.StackTrace
+}
+
+type causer interface {
+	Cause() error
+}
+
+// stackTrace はラップされたエラーのうち、最も内側で記録されたスタックトレースを返す
+func stackTrace(err error) string {
+	var st stackTracer
+	for err != nil {
+		if s, ok := err.(stackTracer); ok {
+			st = s
+		}
+		c, ok := err.(causer)
+		if !ok {
+			break
+		}
+		err = c.Cause()
+	}
+
+	if st == nil {
+		return ""
+	}
+
+	return strings.TrimSpace(fmt.Sprintf("%+v", st.StackTrace()))
+}
+
 func Init() bool {
 	flag.Set("stderrthreshold", "INFO")
 	flag.Parse()
@@ -16,6 +255,6 @@ func Init() bool {
 
 func DumpForDebug(v interface{}) {
 	if settings.Env().IsDebug() {
-		glog.InfoDepth(1, fmt.Sprintf("%#v", v))
+		Default().Debugf("%#v", v)
 	}
 }
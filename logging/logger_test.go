@@ -0,0 +1,92 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestLogger(level Level) (*Logger, *bytes.Buffer) {
+	buf := &bytes.Buffer{}
+	l := New(buf, level)
+	l.now = func() time.Time {
+		return time.Date(2019, 4, 1, 12, 0, 0, 0, time.UTC)
+	}
+	return l, buf
+}
+
+func decodeLines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var entries []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]interface{}
+		err := json.Unmarshal([]byte(line), &entry)
+		assert.NoError(t, err)
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestLogger_Level(t *testing.T) {
+	l, buf := newTestLogger(WarnLevel)
+
+	l.Info("info")
+	l.Warn("warn")
+
+	entries := decodeLines(t, buf)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "warn", entries[0]["level"])
+	assert.Equal(t, "warn", entries[0]["message"])
+	assert.Equal(t, "2019-04-01T12:00:00Z", entries[0]["time"])
+}
+
+func TestLogger_Redact(t *testing.T) {
+	l, buf := newTestLogger(DebugLevel)
+
+	l.With(Fields{
+		"user_id": "1",
+		"email":   "test@example.com",
+		"headers": map[string]string{
+			"Authorization": "Bearer xxx",
+			"Accept":        "application/json",
+		},
+	}).Info("redact")
+
+	entries := decodeLines(t, buf)
+	assert.Equal(t, "1", entries[0]["user_id"])
+	assert.Equal(t, redacted, entries[0]["email"])
+	assert.Equal(t, map[string]interface{}{
+		"Authorization": redacted,
+		"Accept":        "application/json",
+	}, entries[0]["headers"])
+}
+
+func TestLogger_WithError(t *testing.T) {
+	l, buf := newTestLogger(DebugLevel)
+
+	err := errors.WithStack(errors.New("boom"))
+	l.WithError(err).Error("failed")
+
+	entries := decodeLines(t, buf)
+	assert.Equal(t, "boom", entries[0]["error"])
+	assert.Contains(t, entries[0]["stack"], "TestLogger_WithError")
+}
+
+func TestFromContext(t *testing.T) {
+	l, buf := newTestLogger(DebugLevel)
+
+	ctx := NewContext(context.Background(), l.WithField("request_id", "abc"))
+	FromContext(ctx).Info("hello")
+
+	entries := decodeLines(t, buf)
+	assert.Equal(t, "abc", entries[0]["request_id"])
+}
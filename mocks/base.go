@@ -2,6 +2,7 @@ package mocks
 
 import (
 	"sam-book-sample/db"
+	"sam-book-sample/storage"
 	"testing"
 
 	"github.com/k0kubun/pp"
@@ -34,3 +35,11 @@ func DumpDynamo(t *testing.T) {
 
 	pp.Print(data)
 }
+
+func SetupBucket(t *testing.T) {
+	t.Helper()
+	err := storage.SetupBucketForTest()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+}
@@ -0,0 +1,199 @@
+package models
+
+import (
+	"fmt"
+	"sam-book-sample/db"
+	"sam-book-sample/storage"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/guregu/dynamo"
+	"github.com/pkg/errors"
+)
+
+const (
+	attachmentPKPrefix = "Attachment-"
+
+	// MaxAttachmentSize は添付ファイルの大きさの上限のバイト数
+	MaxAttachmentSize = 5 * 1024 * 1024
+
+	// MaxAttachmentsPerMicropost は 1 件の Micropost に付けられる添付ファイルの数
+	MaxAttachmentsPerMicropost = 4
+
+	attachmentUploadTTL   = 15 * time.Minute
+	attachmentDownloadTTL = time.Hour
+)
+
+// AttachmentContentTypes は添付できるファイルの種類
+var AttachmentContentTypes = []string{"image/gif", "image/jpeg", "image/png", "image/webp"}
+
+// Attachment はアップロードを受け付けた添付ファイル
+type Attachment struct {
+	ID          uint64    `dynamo:"ID"`
+	OwnerID     uint64    `dynamo:"OwnerID"`
+	ContentType string    `dynamo:"ContentType"`
+	Size        int64     `dynamo:"Size"`
+	CreatedAt   time.Time `dynamo:"CreatedAt"`
+}
+
+type AttachmentDynamo struct {
+	db.MainTable
+	Attachment
+}
+
+// MicropostAttachment は Micropost に付けた添付ファイル。一覧で読むときに Attachment を引かなくて済むよう種類も持つ
+type MicropostAttachment struct {
+	ID          uint64 `dynamo:"ID"`
+	ContentType string `dynamo:"ContentType"`
+	Key         string `dynamo:"Key"`
+}
+
+func attachmentPK(id uint64) string {
+	return fmt.Sprintf("%s%011d", attachmentPKPrefix, id)
+}
+
+func attachmentSK(id uint64) string {
+	return fmt.Sprintf("%011d", id)
+}
+
+// uploadKey はアップロードを受け付ける S3 のオブジェクトのキー
+func (a *Attachment) uploadKey() string {
+	return fmt.Sprintf("uploads/%d/%d", a.OwnerID, a.ID)
+}
+
+// attachedKey は Micropost に付けるときに写す先のキー。写した版ごとに変え、後から置き換えられないようにする
+func (a *Attachment) attachedKey(etag string) string {
+	return fmt.Sprintf("attachments/%d/%d/%s", a.OwnerID, a.ID, strings.Trim(etag, `"`))
+}
+
+// IsAttachmentContentType は contentType が添付できる種類かを返す
+func IsAttachmentContentType(contentType string) bool {
+	i := sort.SearchStrings(AttachmentContentTypes, contentType)
+	return i < len(AttachmentContentTypes) && AttachmentContentTypes[i] == contentType
+}
+
+// CreateAttachment は ownerID のユーザーの添付ファイルを登録し、アップロード先の署名付き URL を返す。
+// 種類と大きさは呼び出し元で検証する
+func CreateAttachment(ownerID uint64, contentType string, size int64) (*Attachment, string, error) {
+	id, err := db.GenerateID("Attachment")
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+
+	a := &Attachment{
+		ID:          id,
+		OwnerID:     ownerID,
+		ContentType: contentType,
+		Size:        size,
+		CreatedAt:   now(),
+	}
+
+	table, err := db.Table()
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+
+	err = table.
+		Put(&AttachmentDynamo{
+			MainTable:  db.MainTable{PK: attachmentPK(id), SK: attachmentSK(id)},
+			Attachment: *a,
+		}).
+		Run()
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+
+	url, err := storage.PresignPut(a.uploadKey(), contentType, attachmentUploadTTL)
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+
+	return a, url, nil
+}
+
+// GetUploadedAttachments は ownerID のユーザーがアップロードを済ませた ids の添付ファイルを ids の順に返す。
+// 登録されていないか、他のユーザーのものか、受け付けたときと違う種類や大きさのファイルが置かれていれば
+// ErrInvalidAttachment を返す。確かめた版を別のキーに写し、返す添付ファイルはそちらを指す
+func GetUploadedAttachments(ownerID uint64, ids []uint64) ([]MicropostAttachment, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	// BatchGetItem は同じキーを重ねて指定できない
+	seen := map[uint64]bool{}
+	var unique []uint64
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	ids = unique
+
+	table, err := db.Table()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	keys := make([]dynamo.Keyed, len(ids))
+	for i, id := range ids {
+		keys[i] = dynamo.Keys{attachmentPK(id), attachmentSK(id)}
+	}
+
+	var found []Attachment
+	err = table.
+		Batch(db.PKName, db.SKName).
+		Get(keys...).
+		All(&found)
+	if err != nil && err != dynamo.ErrNotFound {
+		return nil, errors.WithStack(err)
+	}
+
+	byID := map[uint64]*Attachment{}
+	for i := range found {
+		byID[found[i].ID] = &found[i]
+	}
+
+	attachments := make([]MicropostAttachment, len(ids))
+	for i, id := range ids {
+		a, ok := byID[id]
+		if !ok || a.OwnerID != ownerID {
+			return nil, errors.WithStack(ErrInvalidAttachment)
+		}
+
+		// 署名付き URL は大きさを制限できず、期限までは置き換えられるので、確かめた版だけを写す
+		head, err := storage.HeadObject(a.uploadKey())
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if head == nil || aws.Int64Value(head.ContentLength) != a.Size || aws.StringValue(head.ContentType) != a.ContentType {
+			return nil, errors.WithStack(ErrInvalidAttachment)
+		}
+
+		etag := aws.StringValue(head.ETag)
+		key := a.attachedKey(etag)
+		copied, err := storage.CopyObject(a.uploadKey(), key, etag)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if !copied {
+			return nil, errors.WithStack(ErrInvalidAttachment)
+		}
+
+		attachments[i] = MicropostAttachment{
+			ID:          a.ID,
+			ContentType: a.ContentType,
+			Key:         key,
+		}
+	}
+
+	return attachments, nil
+}
+
+// DownloadURL は添付ファイルを読むための署名付き URL を返す
+func (a *MicropostAttachment) DownloadURL() (string, error) {
+	url, err := storage.PresignGet(a.Key, attachmentDownloadTTL)
+	return url, errors.WithStack(err)
+}
@@ -7,8 +7,22 @@ type CreatedUpdated struct {
 	UpdatedAt time.Time `dynamo:"UpdatedAt"`
 }
 
+// touch は作成日時と更新日時を設定する。created が false なら更新日時だけを変える
+func (c *CreatedUpdated) touch(t time.Time, created bool) {
+	if created {
+		c.CreatedAt = t
+	}
+	c.UpdatedAt = t
+}
+
 type BaseModel struct {
 	ID      uint64 `dynamo:"ID"`
 	Version int    `dynamo:"Version"`
 	CreatedUpdated
 }
+
+// now は保存する日時を返す。CreatedAt は GSI の範囲キーとして文字列で比較するので、
+// RFC3339 の表記が揃うよう UTC の秒単位にする
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"reflect"
 	"sam-book-sample/db"
+	"time"
 
 	"github.com/guregu/dynamo"
 	"github.com/memememomo/nomof"
@@ -20,6 +21,7 @@ type DynamoModelMapper interface {
 	SetVersion(v int)
 	GetVersion() int
 	GenerateRecord() interface{}
+	touch(t time.Time, created bool)
 }
 
 type DynamoEntityMapper interface {
@@ -62,6 +64,7 @@ func generateCreateQuery(mapper DynamoEntityMapper) (*dynamo.Put, error) {
 
 	mapper.SetID(id)
 	mapper.SetVersion(1)
+	mapper.touch(now(), true)
 
 	fb := nomof.NewBuilder()
 	fb.AttributeNotExists(db.PKName)
@@ -82,6 +85,7 @@ func generateUpdateQuery(mapper DynamoEntityMapper) (*dynamo.Put, error) {
 	oldVersion := mapper.GetVersion()
 
 	mapper.SetVersion(oldVersion + 1)
+	mapper.touch(now(), false)
 
 	fb := nomof.NewBuilder()
 	fb.Equal("Version", oldVersion)
@@ -93,6 +97,42 @@ func generateUpdateQuery(mapper DynamoEntityMapper) (*dynamo.Put, error) {
 	return query, nil
 }
 
+// generatePatchQuery は set の属性だけを UpdateItem の SET で書き換え、Version を 1 増やす。
+// mapper の Version が 0 でなければ、その Version から変更されていないことを条件にする
+func generatePatchQuery(mapper DynamoEntityMapper, set map[string]interface{}) (*dynamo.Update, error) {
+	table, err := db.Table()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	fb := nomof.NewBuilder()
+	fb.AttributeExists(db.PKName)
+	if mapper.GetVersion() > 0 {
+		fb.Equal("Version", mapper.GetVersion())
+	}
+
+	query := table.
+		Update(db.PKName, mapper.PK()).
+		Range(db.SKName, mapper.SK()).
+		Add("Version", 1).
+		Set("UpdatedAt", now()).
+		If(fb.JoinAnd(), fb.Arg...)
+
+	for name, v := range set {
+		// nil なら属性を消す。スライスは集合として書き込み、空の集合は書き込めないので SetSet が属性を消す
+		switch v.(type) {
+		case nil:
+			query.Remove(name)
+		case []string, []uint64:
+			query.SetSet(name, v)
+		default:
+			query.Set(name, v)
+		}
+	}
+
+	return query, nil
+}
+
 func generateDeleteQuery(mapper DynamoEntityMapper) (*dynamo.Delete, error) {
 	table, err := db.Table()
 	if err != nil {
@@ -113,11 +153,8 @@ func createEntityToDynamo(mapper DynamoEntityMapper) error {
 	}
 
 	err = query.Run()
-	if err != nil {
-		return errors.WithStack(err)
-	}
 
-	return nil
+	return translateError(err, ErrConflict)
 }
 
 func updateEntityToDynamo(mapper DynamoEntityMapper) error {
@@ -127,11 +164,8 @@ func updateEntityToDynamo(mapper DynamoEntityMapper) error {
 	}
 
 	err = query.Run()
-	if err != nil {
-		return errors.WithStack(err)
-	}
 
-	return nil
+	return translateError(err, ErrVersionMismatch)
 }
 
 func deleteEntity(mapper DynamoEntityMapper) error {
@@ -159,24 +193,41 @@ func putEntityToDynamo(mapper DynamoEntityMapper) error {
 	return mapper.UpdateDynamoRecord()
 }
 
-func getEntityByID(id uint64, mapper DynamoEntityMapper, ret interface{}) (interface{}, error) {
+// getEntityByID は見つからなければ ErrNotFound を返す。attrs を指定するとその属性だけを読む
+func getEntityByID(id uint64, mapper DynamoEntityMapper, ret interface{}, attrs ...string) (interface{}, error) {
 	table, err := db.Table()
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
 
 	mapper.SetID(id)
-	err = table.
+	query := table.
 		Get(db.PKName, mapper.PK()).
-		Range(db.SKName, dynamo.Equal, mapper.SK()).
-		One(ret)
+		Range(db.SKName, dynamo.Equal, mapper.SK())
+	if len(attrs) > 0 {
+		query.Project(attrs...)
+	}
+
+	err = query.One(ret)
 
 	if err != nil {
-		if err == dynamo.ErrNotFound {
-			return nil, nil
-		}
-		return nil, errors.WithStack(err)
+		return nil, translateError(err)
 	}
 
 	return ret, nil
 }
+
+// projectScan は attrs を指定したときだけ Scan の ProjectionExpression を設定する。
+// Scan.Project は名前をエスケープしないので、Name のような予約語を引用符で囲む
+func projectScan(scan *dynamo.Scan, attrs []string) *dynamo.Scan {
+	if len(attrs) == 0 {
+		return scan
+	}
+
+	quoted := make([]string, len(attrs))
+	for i, attr := range attrs {
+		quoted[i] = "'" + attr + "'"
+	}
+
+	return scan.Project(quoted...)
+}
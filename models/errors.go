@@ -0,0 +1,101 @@
+package models
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/guregu/dynamo"
+	"github.com/pkg/errors"
+)
+
+// Error は models が返すドメインエラー。errors.Cause で取り出して比較する
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+const (
+	ErrNotFound          = Error("not found")
+	ErrConflict          = Error("conflict")
+	ErrDuplicateEmail    = Error("duplicate email")
+	ErrVersionMismatch   = Error("version mismatch")
+	ErrInvalidCursor     = Error("invalid cursor")
+	ErrSelfFollow        = Error("self follow")
+	ErrAlreadyFollowing  = Error("already following")
+	ErrParentNotFound    = Error("parent not found")
+	ErrInvalidAttachment = Error("invalid attachment")
+
+	ErrModerationRejected = Error("moderation rejected")
+	ErrEditWindowExpired  = Error("edit window expired")
+)
+
+// トランザクションの項目ごとのキャンセル理由
+const (
+	reasonConditionalCheckFailed = "ConditionalCheckFailed"
+	reasonTransactionConflict    = "TransactionConflict"
+)
+
+// cancellationReasons は TransactionCanceledException のメッセージから項目ごとの理由を取り出す。
+// 利用している SDK は CancellationReasons を公開しないため
+// "Transaction cancelled, please refer cancellation reasons for specific reasons [None, ConditionalCheckFailed]"
+// の末尾を解析する
+func cancellationReasons(ae awserr.Error) []string {
+	msg := ae.Message()
+	start := strings.LastIndex(msg, "[")
+	end := strings.LastIndex(msg, "]")
+	if start < 0 || end < start {
+		return nil
+	}
+
+	reasons := strings.Split(msg[start+1:end], ",")
+	for i, r := range reasons {
+		reasons[i] = strings.TrimSpace(r)
+	}
+	return reasons
+}
+
+// translateError は AWS のエラーコードをドメインエラーに変換する。
+// onCheckFailed[i] は i 番目の書き込みの条件が満たされなかったときに返すエラーで、
+// 指定がなければ ErrConflict を返す
+func translateError(err error, onCheckFailed ...error) error {
+	if err == nil {
+		return nil
+	}
+
+	cause := errors.Cause(err)
+	if cause == dynamo.ErrNotFound {
+		return errors.WithStack(ErrNotFound)
+	}
+
+	ae, ok := cause.(awserr.Error)
+	if !ok {
+		return errors.WithStack(err)
+	}
+
+	checkFailed := func(i int) error {
+		if i < len(onCheckFailed) {
+			return errors.WithStack(onCheckFailed[i])
+		}
+		return errors.WithStack(ErrConflict)
+	}
+
+	switch ae.Code() {
+	case dynamodb.ErrCodeConditionalCheckFailedException:
+		return checkFailed(0)
+	case dynamodb.ErrCodeTransactionConflictException:
+		return errors.WithStack(ErrConflict)
+	case dynamodb.ErrCodeTransactionCanceledException:
+		for i, reason := range cancellationReasons(ae) {
+			switch reason {
+			case reasonConditionalCheckFailed:
+				return checkFailed(i)
+			case reasonTransactionConflict:
+				return errors.WithStack(ErrConflict)
+			}
+		}
+	}
+
+	return errors.WithStack(err)
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/guregu/dynamo"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTranslateError(t *testing.T) {
+	canceled := func(reasons string) error {
+		return awserr.New(
+			dynamodb.ErrCodeTransactionCanceledException,
+			"Transaction cancelled, please refer cancellation reasons for specific reasons "+reasons,
+			nil,
+		)
+	}
+	other := errors.New("other")
+
+	cases := []struct {
+		Name          string
+		Err           error
+		OnCheckFailed []error
+		Expected      error
+	}{
+		{Name: "nil", Err: nil, Expected: nil},
+		{Name: "not found", Err: dynamo.ErrNotFound, Expected: ErrNotFound},
+		{
+			Name:          "conditional check",
+			Err:           awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed", nil),
+			OnCheckFailed: []error{ErrVersionMismatch},
+			Expected:      ErrVersionMismatch,
+		},
+		{
+			Name:     "conditional check without mapping",
+			Err:      awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed", nil),
+			Expected: ErrConflict,
+		},
+		{
+			Name:          "second item",
+			Err:           canceled("[None, ConditionalCheckFailed]"),
+			OnCheckFailed: []error{ErrVersionMismatch, ErrDuplicateEmail},
+			Expected:      ErrDuplicateEmail,
+		},
+		{
+			Name:          "first item wins",
+			Err:           errors.WithStack(canceled("[ConditionalCheckFailed, ConditionalCheckFailed]")),
+			OnCheckFailed: []error{ErrVersionMismatch, ErrDuplicateEmail},
+			Expected:      ErrVersionMismatch,
+		},
+		{
+			Name:          "transaction conflict",
+			Err:           canceled("[None, TransactionConflict]"),
+			OnCheckFailed: []error{ErrConflict, ErrDuplicateEmail},
+			Expected:      ErrConflict,
+		},
+		{Name: "other", Err: other, Expected: other},
+	}
+
+	for _, c := range cases {
+		err := translateError(c.Err, c.OnCheckFailed...)
+		assert.Equal(t, c.Expected, errors.Cause(err), c.Name)
+	}
+}
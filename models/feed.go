@@ -0,0 +1,415 @@
+package models
+
+import (
+	"fmt"
+	"sam-book-sample/db"
+	"sam-book-sample/logging"
+	"sam-book-sample/settings"
+	"sort"
+	"time"
+
+	"github.com/guregu/dynamo"
+	"github.com/memememomo/nomof"
+	"github.com/pkg/errors"
+)
+
+const (
+	feedPKPrefix = "Feed-"
+
+	// celebrityPK はフォロワーの多いユーザーの印を集めたパーティション。SK はユーザーの PK
+	celebrityPK = "Celebrity"
+
+	// feedTrimBatch は 1 回の trimFeed で消す項目の数
+	feedTrimBatch = 25
+)
+
+// FeedItem はホームタイムラインの項目。読むユーザーのパーティションに SK=Micropost の PK で置くので、
+// SK の降順に読むと新しい順になる
+type FeedItem struct {
+	OwnerPK     string    `dynamo:"PK"`
+	MicropostPK string    `dynamo:"SK"`
+	MicropostID uint64    `dynamo:"MicropostID"`
+	AuthorID    uint64    `dynamo:"AuthorID"`
+	CreatedAt   time.Time `dynamo:"CreatedAt"`
+
+	// ExpiresAt は DynamoDB の TTL で消す時刻の UNIX 秒
+	ExpiresAt int64 `dynamo:"ExpiresAt"`
+}
+
+type celebrity struct {
+	PK     string `dynamo:"PK"`
+	SK     string `dynamo:"SK"`
+	UserID uint64 `dynamo:"UserID"`
+}
+
+type feedCursor struct {
+	BeforeID  uint64    `json:"before_id"`
+	CreatedAt time.Time `json:"created_at"`
+	Served    int       `json:"served"`
+}
+
+func feedPK(userID uint64) string {
+	return fmt.Sprintf("%s%011d", feedPKPrefix, userID)
+}
+
+func micropostPK(id uint64) string {
+	return (&Micropost{BaseModel: BaseModel{ID: id}}).PK()
+}
+
+// fanOutOnCreate は作成した m をすぐに読めるよう、フォロワーが FeedSyncFanOutLimit 以下ならリクエストの中でフィードに配る。
+// フォロワーの多いユーザーの投稿は読むときに集めるので配らない。
+// ここで配れなかったものは、Micropost の作成を受け取った StreamConsumer が FanOutCreatedMicropost で配るので、失敗はログに残すだけにする
+func fanOutOnCreate(m *Micropost) {
+	err := func() error {
+		celebrity, err := isCelebrity(m.UserID)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if celebrity {
+			return nil
+		}
+
+		counts, err := GetFollowCounts(m.UserID)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if counts.FollowerCount <= 0 || counts.FollowerCount > int64(settings.Env().FeedSyncFanOutLimit()) {
+			return nil
+		}
+
+		return FanOutMicropost(m)
+	}()
+	if err != nil {
+		logging.Default().WithError(err).WithField("micropost_id", m.ID).Warn("failed to fan out micropost")
+	}
+}
+
+// FanOutCreatedMicropost は StreamConsumer から呼び、作成された m をフォロワーのフィードに配る。
+// 書き込みは冪等なので、リクエストの中で配ったものを配り直してもよい。エラーを返せば StreamConsumer が再試行する
+func FanOutCreatedMicropost(m *Micropost) error {
+	celebrity, err := isCelebrity(m.UserID)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if celebrity {
+		return nil
+	}
+
+	return FanOutMicropost(m)
+}
+
+// FanOutMicropost は m を投稿したユーザーのフォロワー全員のフィードに書き込む
+func FanOutMicropost(m *Micropost) error {
+	table, err := db.Table()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	var relationships []Relationship
+	err = table.
+		Get(db.SKName, relationshipSK(m.UserID)).
+		Index(db.InvertedIndex).
+		All(&relationships)
+	if err != nil && err != dynamo.ErrNotFound {
+		return errors.WithStack(err)
+	}
+	if len(relationships) == 0 {
+		return nil
+	}
+
+	expiresAt := now().Add(settings.Env().FeedTTL()).Unix()
+	items := make([]interface{}, len(relationships))
+	for i, r := range relationships {
+		items[i] = &FeedItem{
+			OwnerPK:     feedPK(r.FollowerID),
+			MicropostPK: m.PK(),
+			MicropostID: m.ID,
+			AuthorID:    m.UserID,
+			CreatedAt:   m.CreatedAt,
+			ExpiresAt:   expiresAt,
+		}
+	}
+
+	// BatchWriteItem の 25 件ごとの分割は dynamo が行う
+	_, err = table.
+		Batch(db.PKName, db.SKName).
+		Write().
+		Put(items...).
+		Run()
+
+	return errors.WithStack(err)
+}
+
+// markCelebrity は userID のユーザーの投稿をフィードに配らず、読むときに集めるようにする
+func markCelebrity(userID uint64) error {
+	table, err := db.Table()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = table.
+		Put(&celebrity{PK: celebrityPK, SK: userPK(userID), UserID: userID}).
+		Run()
+
+	return errors.WithStack(err)
+}
+
+func isCelebrity(userID uint64) (bool, error) {
+	table, err := db.Table()
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	var c celebrity
+	err = table.
+		Get(db.PKName, celebrityPK).
+		Range(db.SKName, dynamo.Equal, userPK(userID)).
+		One(&c)
+	if err == dynamo.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	return true, nil
+}
+
+// followedCelebrities は userID のユーザーがフォローしているユーザーのうち、フィードに配られないユーザーの ID を返す
+func followedCelebrities(table *dynamo.Table, userID uint64) ([]uint64, error) {
+	var celebrities []celebrity
+	err := table.
+		Get(db.PKName, celebrityPK).
+		All(&celebrities)
+	if err != nil && err != dynamo.ErrNotFound {
+		return nil, errors.WithStack(err)
+	}
+	if len(celebrities) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]dynamo.Keyed, len(celebrities))
+	for i, c := range celebrities {
+		keys[i] = dynamo.Keys{userPK(userID), relationshipSK(c.UserID)}
+	}
+
+	var relationships []Relationship
+	err = table.
+		Batch(db.PKName, db.SKName).
+		Get(keys...).
+		All(&relationships)
+	if err != nil && err != dynamo.ErrNotFound {
+		return nil, errors.WithStack(err)
+	}
+
+	ids := make([]uint64, len(relationships))
+	for i, r := range relationships {
+		ids[i] = r.FolloweeID
+	}
+
+	return ids, nil
+}
+
+// GetFeed は userID のユーザーがフォローしているユーザーの Micropost を新しい順に返す。
+// フィードに配られた分と、フォロワーの多いユーザーの投稿を読むときに集めた分を合わせる。
+// 先頭から FeedMaxItems 件までしか読めない。続きがあれば次のページのカーソルも返す
+func GetFeed(userID uint64, page *Page) ([]*Micropost, string, error) {
+	cursor := feedCursor{}
+	if page.Cursor != "" {
+		err := decodeCursor(page.Cursor, &cursor)
+		if err != nil {
+			return nil, "", errors.WithStack(err)
+		}
+		if cursor.BeforeID == 0 || cursor.Served < 0 {
+			return nil, "", errors.WithStack(ErrInvalidCursor)
+		}
+	}
+
+	maxItems := settings.Env().FeedMaxItems()
+	limit := page.Limit
+	if rest := maxItems - cursor.Served; rest < limit {
+		limit = rest
+	}
+	if limit <= 0 {
+		return []*Micropost{}, "", nil
+	}
+
+	table, err := db.Table()
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+
+	// 続きがあるかを知るために 1 件多く読む
+	query := table.
+		Get(db.PKName, feedPK(userID)).
+		Order(dynamo.Descending).
+		Limit(int64(limit + 1))
+	if cursor.BeforeID > 0 {
+		query.Range(db.SKName, dynamo.Less, micropostPK(cursor.BeforeID))
+	}
+
+	var items []FeedItem
+	err = query.All(&items)
+	if err != nil && err != dynamo.ErrNotFound {
+		return nil, "", errors.WithStack(err)
+	}
+
+	found := map[uint64]time.Time{}
+	for _, item := range items {
+		found[item.MicropostID] = item.CreatedAt
+	}
+
+	celebrityIDs, err := followedCelebrities(table, userID)
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+
+	for _, id := range celebrityIDs {
+		query := table.
+			Get("UserID", id).
+			Index(db.UserIDCreatedAtIndex).
+			Order(dynamo.Descending).
+			Project("ID", "CreatedAt").
+			Limit(int64(limit + 1))
+		if cursor.BeforeID > 0 {
+			// 同じ秒に作られた Micropost があるので、CreatedAt は等しいものも読んで ID で絞り込む
+			fb := nomof.NewBuilder()
+			fb.LessThan("ID", cursor.BeforeID)
+			query.
+				Range("CreatedAt", dynamo.LessOrEqual, cursor.CreatedAt).
+				Filter(fb.JoinAnd(), fb.Arg...)
+		}
+
+		var microposts []Micropost
+		err = query.All(&microposts)
+		if err != nil && err != dynamo.ErrNotFound {
+			return nil, "", errors.WithStack(err)
+		}
+		for _, m := range microposts {
+			found[m.ID] = m.CreatedAt
+		}
+	}
+
+	ids := make([]uint64, 0, len(found))
+	for id := range found {
+		ids = append(ids, id)
+	}
+
+	// ID は採番順なので大きいほど新しい
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] > ids[j]
+	})
+
+	more := len(ids) > limit
+	if more {
+		ids = ids[:limit]
+	}
+
+	// 末尾のページまで読んだら、それより古い項目はもう読めないので消す
+	if more && cursor.Served+limit >= maxItems {
+		trimFeed(table, userID, ids[len(ids)-1])
+	}
+
+	var next string
+	if more && cursor.Served+limit < maxItems {
+		last := ids[len(ids)-1]
+		next, err = encodeCursor(&feedCursor{
+			BeforeID:  last,
+			CreatedAt: found[last],
+			Served:    cursor.Served + limit,
+		})
+		if err != nil {
+			return nil, "", errors.WithStack(err)
+		}
+	}
+
+	loaded, err := GetMicropostsByIDs(ids)
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+
+	microposts := []*Micropost{}
+	for _, id := range ids {
+		// フィードに配ってから削除されたものは除く
+		if m, ok := loaded[id]; ok {
+			microposts = append(microposts, m)
+		}
+	}
+
+	return microposts, next, nil
+}
+
+// purgeFeed は followerID のユーザーのフィードから authorID のユーザーの投稿を消す。
+// フィードは trimFeed と TTL で大きくならないので、パーティションを絞り込んで読む
+func purgeFeed(followerID, authorID uint64) error {
+	table, err := db.Table()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	fb := nomof.NewBuilder()
+	fb.Equal("AuthorID", authorID)
+
+	var items []FeedItem
+	err = table.
+		Get(db.PKName, feedPK(followerID)).
+		Filter(fb.JoinAnd(), fb.Arg...).
+		Project(db.PKName, db.SKName).
+		All(&items)
+	if err != nil && err != dynamo.ErrNotFound {
+		return errors.WithStack(err)
+	}
+	if len(items) == 0 {
+		return nil
+	}
+
+	keys := make([]dynamo.Keyed, len(items))
+	for i, item := range items {
+		keys[i] = dynamo.Keys{item.OwnerPK, item.MicropostPK}
+	}
+
+	_, err = table.
+		Batch(db.PKName, db.SKName).
+		Write().
+		Delete(keys...).
+		Run()
+
+	return errors.WithStack(err)
+}
+
+// trimFeed は userID のユーザーのフィードから lastID より古い項目を feedTrimBatch 件まで消す。
+// フィードを丸ごと読まないよう、FeedMaxItems 件目を返したときだけ呼ぶ。残りは次に呼んだときか TTL で消える。
+// 失敗してもフィードは返せるので、ログに残すだけにする
+func trimFeed(table *dynamo.Table, userID, lastID uint64) {
+	err := func() error {
+		var items []FeedItem
+		err := table.
+			Get(db.PKName, feedPK(userID)).
+			Range(db.SKName, dynamo.Less, micropostPK(lastID)).
+			Order(dynamo.Descending).
+			Project(db.PKName, db.SKName).
+			Limit(feedTrimBatch).
+			All(&items)
+		if err != nil && err != dynamo.ErrNotFound {
+			return errors.WithStack(err)
+		}
+		if len(items) == 0 {
+			return nil
+		}
+
+		keys := make([]dynamo.Keyed, len(items))
+		for i, item := range items {
+			keys[i] = dynamo.Keys{item.OwnerPK, item.MicropostPK}
+		}
+
+		_, err = table.
+			Batch(db.PKName, db.SKName).
+			Write().
+			Delete(keys...).
+			Run()
+		return errors.WithStack(err)
+	}()
+	if err != nil {
+		logging.Default().WithError(err).WithField("user_id", userID).Warn("failed to trim feed")
+	}
+}
@@ -0,0 +1,166 @@
+package models
+
+import (
+	"sam-book-sample/db"
+	"strings"
+	"unicode"
+
+	"github.com/guregu/dynamo"
+	"github.com/pkg/errors"
+	"golang.org/x/text/width"
+)
+
+const (
+	hashtagPrefix = "Hashtag-"
+	mentionPrefix = "Mention-"
+
+	// maxHashtags と maxMentions は 1 件の Micropost から索引に入れる数
+	maxHashtags = 5
+	maxMentions = 5
+)
+
+// extractTerms は text から marker に続く語を出現順に重複なく返す。
+// marker の前が文字か数字なら語の途中とみなして区切りにしない。全角の記号は半角にしてから探す
+func extractTerms(text string, marker rune, max int) []string {
+	runes := []rune(strings.ToLower(width.Fold.String(text)))
+
+	var terms []string
+	seen := map[string]bool{}
+	for i := 0; i < len(runes) && len(terms) < max; i++ {
+		if runes[i] != marker || (i > 0 && isTermRune(runes[i-1])) {
+			continue
+		}
+
+		j := i + 1
+		for j < len(runes) && isTermRune(runes[j]) {
+			j++
+		}
+
+		term := string(runes[i+1 : j])
+		if term != "" && !seen[term] {
+			seen[term] = true
+			terms = append(terms, term)
+		}
+		i = j - 1
+	}
+
+	return terms
+}
+
+func isTermRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r)
+}
+
+// extractHashtags は本文の #ハッシュタグ を小文字にして返す
+func extractHashtags(content string) []string {
+	return extractTerms(content, '#', maxHashtags)
+}
+
+// extractMentions は本文の @ユーザー名 を小文字にして返す
+func extractMentions(content string) []string {
+	return extractTerms(content, '@', maxMentions)
+}
+
+// normalizeUserName はユーザー名を本文から取り出したメンションと同じ形にする
+func normalizeUserName(name string) string {
+	return strings.ToLower(width.Fold.String(name))
+}
+
+// resolveMentions はメンションしたユーザー名をその時点で同じ名前のユーザーの ID にして返す。
+// 名前は一意でないので、同じ名前のユーザーがいればすべて含める。見つからない名前は無視する
+func resolveMentions(names []string) ([]uint64, error) {
+	var ids []uint64
+	for _, name := range names {
+		if len(ids) >= maxMentions {
+			break
+		}
+
+		found, err := getUserIDsByName(name, int64(maxMentions-len(ids)))
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		ids = append(ids, found...)
+	}
+
+	return ids, nil
+}
+
+// NormalizeHashtag は検索に使うハッシュタグを本文から取り出したときと同じ形にする。先頭の # はあってもなくてもよい
+func NormalizeHashtag(tag string) string {
+	tag = strings.ToLower(width.Fold.String(tag))
+	return strings.TrimPrefix(tag, "#")
+}
+
+func termSet(terms []string) map[string]int {
+	set := map[string]int{}
+	for _, t := range terms {
+		set[t] = 1
+	}
+	return set
+}
+
+func hashtagCounts(src indexSource) map[string]int {
+	return termSet(extractHashtags(src.Content))
+}
+
+// mentionCounts はメンションしたユーザーの ID ごとの索引を作る。名前は変えられるので、書き込んだときに決めた ID で引く
+func mentionCounts(src indexSource) map[string]int {
+	set := map[string]int{}
+	for _, id := range src.MentionIDs {
+		set[userPK(id)] = 1
+	}
+	return set
+}
+
+// ListMicropostsByHashtag は tag を含む Micropost を新しい順に返す。続きがあれば次のページのカーソルも返す
+func ListMicropostsByHashtag(tag string, page *Page) ([]*Micropost, string, error) {
+	return listIndexedMicroposts(hashtagPrefix+NormalizeHashtag(tag), page)
+}
+
+// ListMentions は userID のユーザーを @ メンションした Micropost を新しい順に返す。
+// ユーザーが存在しなければ ErrNotFound を返す
+func ListMentions(userID uint64, page *Page) ([]*Micropost, string, error) {
+	_, err := GetUserByID(userID, "ID")
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+
+	return listIndexedMicroposts(mentionPrefix+userPK(userID), page)
+}
+
+// listIndexedMicroposts は索引のパーティション pk に並ぶ Micropost を新しい順に読む
+func listIndexedMicroposts(pk string, page *Page) ([]*Micropost, string, error) {
+	table, err := db.Table()
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+
+	query := table.
+		Get(db.PKName, pk).
+		Order(dynamo.Descending)
+
+	var items []MicropostToken
+	next, err := queryPage(query, pageRange{Hash: db.PKName, HashValue: pk, Range: db.SKName}, page, &items)
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+
+	ids := make([]uint64, len(items))
+	for i, item := range items {
+		ids[i] = item.MicropostID
+	}
+
+	found, err := GetMicropostsByIDs(ids)
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+
+	microposts := []*Micropost{}
+	for _, id := range ids {
+		if m, ok := found[id]; ok {
+			microposts = append(microposts, m)
+		}
+	}
+
+	return microposts, next, nil
+}
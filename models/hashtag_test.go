@@ -0,0 +1,35 @@
+package models
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractHashtags(t *testing.T) {
+	cases := []struct {
+		Content  string
+		Expected []string
+	}{
+		{Content: "", Expected: nil},
+		{Content: "#Go と #go と #golang", Expected: []string{"go", "golang"}},
+		{Content: "＃東京タワー、#ｶﾌｪ巡り", Expected: []string{"東京タワー", "カフェ巡り"}},
+		{Content: "C#やa#bは含まない #", Expected: nil},
+		{Content: "#snake_case!#next", Expected: []string{"snake_case", "next"}},
+		{Content: "#a #b #c #d #e #f", Expected: []string{"a", "b", "c", "d", "e"}},
+	}
+
+	for i, c := range cases {
+		assert.Equal(t, c.Expected, extractHashtags(c.Content), fmt.Sprintf("Case:%d", i+1))
+	}
+}
+
+func TestExtractMentions(t *testing.T) {
+	assert.Equal(t, []string{"name_1", "名前"}, extractMentions("@Name_1 さん、＠名前 さん。mail@example.com"))
+}
+
+func TestNormalizeHashtag(t *testing.T) {
+	assert.Equal(t, "go", NormalizeHashtag("＃ＧＯ"))
+	assert.Equal(t, "東京", NormalizeHashtag("東京"))
+}
@@ -0,0 +1,172 @@
+package models
+
+import (
+	"fmt"
+	"sam-book-sample/db"
+	"time"
+
+	"github.com/guregu/dynamo"
+	"github.com/memememomo/nomof"
+	"github.com/pkg/errors"
+)
+
+const (
+	// heldMicropostsPK は保留した投稿をまとめて置くパーティション。管理者が古い順に読む
+	heldMicropostsPK          = "PendingReview"
+	heldMicropostSKPrefix     = "HeldMicropost-"
+	heldMicropostIDEntityName = "HeldMicropost"
+)
+
+// HeldMicropost は審査で保留した投稿。承認されるまで Micropost として保存しないので、一覧やフィードや検索には出ない
+type HeldMicropost struct {
+	ID          uint64                `dynamo:"ID"`
+	AuthorID    uint64                `dynamo:"AuthorID"`
+	Content     string                `dynamo:"Content"`
+	InReplyToID uint64                `dynamo:"InReplyToID,omitempty"`
+	Attachments []MicropostAttachment `dynamo:"Attachments,omitempty"`
+	Reason      string                `dynamo:"Reason"`
+	CreatedAt   time.Time             `dynamo:"CreatedAt"`
+}
+
+type HeldMicropostDynamo struct {
+	db.MainTable
+	HeldMicropost
+}
+
+func heldMicropostSK(id uint64) string {
+	return fmt.Sprintf("%s%011d", heldMicropostSKPrefix, id)
+}
+
+// heldMicropostDeleteQuery は保留した投稿を消す。すでに承認か却下されていれば条件を満たさない
+func heldMicropostDeleteQuery(table *dynamo.Table, id uint64) *dynamo.Delete {
+	fb := nomof.NewBuilder()
+	fb.AttributeExists(db.PKName)
+
+	return table.
+		Delete(db.PKName, heldMicropostsPK).
+		Range(db.SKName, heldMicropostSK(id)).
+		If(fb.JoinAnd(), fb.Arg...)
+}
+
+// SubmitMicropost は m を審査してから保存する。保留になれば m は保存せず、保留した投稿を返す。
+// 受け付けられなければ ErrModerationRejected を返す
+func SubmitMicropost(m *Micropost) (*HeldMicropost, error) {
+	result, err := currentModerator().Moderate(m)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	switch result.Action {
+	case ModerationReject:
+		return nil, errors.WithStack(ErrModerationRejected)
+	case ModerationHold:
+		held, err := holdMicropost(m, result.Reason)
+		return held, errors.WithStack(err)
+	}
+
+	return nil, errors.WithStack(m.Create())
+}
+
+func holdMicropost(m *Micropost, reason string) (*HeldMicropost, error) {
+	id, err := db.GenerateID(heldMicropostIDEntityName)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	held := &HeldMicropost{
+		ID:          id,
+		AuthorID:    m.UserID,
+		Content:     m.Content,
+		InReplyToID: m.InReplyToID,
+		Attachments: m.Attachments,
+		Reason:      reason,
+		CreatedAt:   now(),
+	}
+
+	table, err := db.Table()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	err = table.
+		Put(&HeldMicropostDynamo{
+			MainTable:     db.MainTable{PK: heldMicropostsPK, SK: heldMicropostSK(id)},
+			HeldMicropost: *held,
+		}).
+		Run()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return held, nil
+}
+
+// ListHeldMicroposts は保留した投稿を古い順に返す。続きがあれば次のページのカーソルも返す
+func ListHeldMicroposts(page *Page) ([]*HeldMicropost, string, error) {
+	table, err := db.Table()
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+
+	query := table.
+		Get(db.PKName, heldMicropostsPK).
+		Range(db.SKName, dynamo.BeginsWith, heldMicropostSKPrefix)
+
+	var items []HeldMicropost
+	next, err := queryPage(query, pageRange{Hash: db.PKName, HashValue: heldMicropostsPK, Range: db.SKName, RangePrefix: heldMicropostSKPrefix}, page, &items)
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+
+	held := make([]*HeldMicropost, len(items))
+	for i := range items {
+		held[i] = &items[i]
+	}
+
+	return held, next, nil
+}
+
+// ApproveHeldMicropost は保留した投稿を Micropost として保存し、保留を解く。
+// 保存と保留の削除は同じトランザクションで行う。保留した投稿がなければ ErrNotFound を返す
+func ApproveHeldMicropost(id uint64) (*Micropost, error) {
+	table, err := db.Table()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var held HeldMicropost
+	err = table.
+		Get(db.PKName, heldMicropostsPK).
+		Range(db.SKName, dynamo.Equal, heldMicropostSK(id)).
+		One(&held)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	m := &Micropost{
+		UserID:      held.AuthorID,
+		Content:     held.Content,
+		InReplyToID: held.InReplyToID,
+		Attachments: held.Attachments,
+		source:      heldMicropostDeleteQuery(table, held.ID),
+	}
+
+	err = m.Create()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return m, nil
+}
+
+// RejectHeldMicropost は保留した投稿を保存せずに消す。保留した投稿がなければ ErrNotFound を返す
+func RejectHeldMicropost(id uint64) error {
+	table, err := db.Table()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = heldMicropostDeleteQuery(table, id).Run()
+
+	return translateError(err, ErrNotFound)
+}
@@ -0,0 +1,183 @@
+package models
+
+import (
+	"fmt"
+	"sam-book-sample/db"
+	"time"
+
+	"github.com/guregu/dynamo"
+	"github.com/memememomo/nomof"
+	"github.com/pkg/errors"
+)
+
+const likeSKPrefix = "Like-"
+
+// Like は Micropost へのいいね。Micropost のパーティションに SK=Like-<いいねしたユーザーの ID> で置く
+type Like struct {
+	MicropostID uint64    `dynamo:"MicropostID"`
+	LikerID     uint64    `dynamo:"LikerID"`
+	CreatedAt   time.Time `dynamo:"CreatedAt"`
+}
+
+type LikeDynamo struct {
+	db.MainTable
+	Like
+}
+
+func likeSK(likerID uint64) string {
+	return fmt.Sprintf("%s%011d", likeSKPrefix, likerID)
+}
+
+// errAlreadyLiked と errNotLiked は同じ操作を繰り返したときのエラーで、呼び出し元には返さない
+const (
+	errAlreadyLiked = Error("already liked")
+	errNotLiked     = Error("not liked")
+)
+
+// likeCountQuery は userID のユーザーの Micropost の LikeCount を n だけ増やす。
+// 編集は LikeCount を書き換えないので Version は上げず、いいねと同時の編集を競合にしない
+func likeCountQuery(table *dynamo.Table, userID, micropostID uint64, n int) *dynamo.Update {
+	fb := nomof.NewBuilder()
+	fb.AttributeExists(db.PKName)
+	fb.Equal("UserID", userID)
+
+	return table.
+		Update(db.PKName, micropostPK(micropostID)).
+		Range(db.SKName, (&Micropost{BaseModel: BaseModel{ID: micropostID}}).SK()).
+		Add("LikeCount", n).
+		If(fb.JoinAnd(), fb.Arg...)
+}
+
+// LikeMicropost は likerID のユーザーが userID のユーザーの Micropost にいいねする。
+// いいねの項目と LikeCount を同じトランザクションで書き込む。すでにいいねしていれば何もしない。
+// Micropost が存在しないか他のユーザーのもの、またはいいねしたユーザーが存在しなければ ErrNotFound を返す
+func LikeMicropost(userID, micropostID, likerID uint64) error {
+	conn, err := db.ConnectDB()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	table, err := db.Table()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	fb := nomof.NewBuilder()
+	fb.AttributeNotExists(db.PKName)
+
+	put := table.
+		Put(&LikeDynamo{
+			MainTable: db.MainTable{
+				PK: micropostPK(micropostID),
+				SK: likeSK(likerID),
+			},
+			Like: Like{
+				MicropostID: micropostID,
+				LikerID:     likerID,
+				CreatedAt:   now(),
+			},
+		}).
+		If(fb.JoinAnd(), fb.Arg...)
+
+	liker := &User{BaseModel: BaseModel{ID: likerID}}
+
+	tx := conn.WriteTx().
+		Update(likeCountQuery(table, userID, micropostID, 1)).
+		Check(table.Check(db.PKName, liker.PK()).Range(db.SKName, liker.SK()).IfExists()).
+		Put(put)
+
+	err = runWriteTx(tx, ErrNotFound, ErrNotFound, errAlreadyLiked)
+	if errors.Cause(err) == errAlreadyLiked {
+		return nil
+	}
+
+	return errors.WithStack(err)
+}
+
+// UnlikeMicropost は LikeMicropost の逆。いいねしていなければ何もしない
+func UnlikeMicropost(userID, micropostID, likerID uint64) error {
+	conn, err := db.ConnectDB()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	table, err := db.Table()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	fb := nomof.NewBuilder()
+	fb.AttributeExists(db.PKName)
+
+	del := table.
+		Delete(db.PKName, micropostPK(micropostID)).
+		Range(db.SKName, likeSK(likerID)).
+		If(fb.JoinAnd(), fb.Arg...)
+
+	tx := conn.WriteTx().
+		Update(likeCountQuery(table, userID, micropostID, -1)).
+		Delete(del)
+
+	err = runWriteTx(tx, ErrNotFound, errNotLiked)
+	if errors.Cause(err) == errNotLiked {
+		return nil
+	}
+
+	return errors.WithStack(err)
+}
+
+// GetLikerIDs は micropostID の Micropost にいいねしたユーザーの ID を limit 件まで返す
+func GetLikerIDs(micropostID uint64, limit int) ([]uint64, error) {
+	table, err := db.Table()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var likes []Like
+	err = table.
+		Get(db.PKName, micropostPK(micropostID)).
+		Range(db.SKName, dynamo.BeginsWith, likeSKPrefix).
+		Limit(int64(limit)).
+		All(&likes)
+	if err != nil && err != dynamo.ErrNotFound {
+		return nil, errors.WithStack(err)
+	}
+
+	ids := make([]uint64, len(likes))
+	for i, l := range likes {
+		ids[i] = l.LikerID
+	}
+
+	return ids, nil
+}
+
+// GetLikedMicropostIDs は micropostIDs のうち likerID のユーザーがいいねしているものを返す
+func GetLikedMicropostIDs(likerID uint64, micropostIDs []uint64) (map[uint64]bool, error) {
+	liked := map[uint64]bool{}
+	if len(micropostIDs) == 0 {
+		return liked, nil
+	}
+
+	table, err := db.Table()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	keys := make([]dynamo.Keyed, len(micropostIDs))
+	for i, id := range micropostIDs {
+		keys[i] = dynamo.Keys{micropostPK(id), likeSK(likerID)}
+	}
+
+	var likes []Like
+	err = table.
+		Batch(db.PKName, db.SKName).
+		Get(keys...).
+		All(&likes)
+	if err != nil && err != dynamo.ErrNotFound {
+		return nil, errors.WithStack(err)
+	}
+
+	for _, l := range likes {
+		liked[l.MicropostID] = true
+	}
+
+	return liked, nil
+}
@@ -0,0 +1,134 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/guregu/dynamo"
+	"github.com/memememomo/nomof"
+)
+
+// FilterOp は一覧の絞り込みの比較方法
+type FilterOp int
+
+const (
+	FilterBeginsWith FilterOp = iota
+	FilterContains
+	FilterAfter
+)
+
+// Filter は一覧の絞り込みの条件。Name はクライアントが指定したパラメータ名
+type Filter struct {
+	Name  string
+	Attr  string
+	Op    FilterOp
+	Value interface{}
+}
+
+// value は比較に使う値を返す。日時は保存するときと同じ表記にしないと文字列として比べられない
+func (f *Filter) value() interface{} {
+	if t, ok := f.Value.(time.Time); ok {
+		return t.UTC().Truncate(time.Second)
+	}
+	return f.Value
+}
+
+// ListOptions は一覧の並び順と絞り込み。SortAttr が空なら読んだ順のまま返す
+type ListOptions struct {
+	SortAttr string
+	Desc     bool
+	Filters  []*Filter
+}
+
+// ListMeta は一覧をどう読んだか。ScanFilters はテーブル全体を Scan して評価した絞り込み
+type ListMeta struct {
+	Scan          bool     `json:"scan"`
+	Index         string   `json:"index,omitempty"`
+	KeyConditions []string `json:"key_conditions"`
+	Filters       []string `json:"filters"`
+	ScanFilters   []string `json:"scan_filters"`
+}
+
+func newListMeta() *ListMeta {
+	return &ListMeta{
+		KeyConditions: []string{},
+		Filters:       []string{},
+		ScanFilters:   []string{},
+	}
+}
+
+// addFilters は filters を FilterExpression の条件にして meta に記録する
+func (m *ListMeta) addFilters(fb *nomof.Builder, filters []*Filter) {
+	for _, f := range filters {
+		switch f.Op {
+		case FilterBeginsWith:
+			fb.BeginsWith(f.Attr, f.Value)
+		case FilterContains:
+			fb.Contains(f.Attr, f.Value)
+		case FilterAfter:
+			fb.GreaterThan(f.Attr, f.value())
+		}
+
+		m.Filters = append(m.Filters, f.Name)
+		if m.Scan {
+			m.ScanFilters = append(m.ScanFilters, f.Name)
+		}
+	}
+}
+
+// lessBy は a と b を比べ、同じ値なら ID で比べる
+func lessBy(a, b interface{}, idA, idB uint64, desc bool) bool {
+	c := 0
+	switch av := a.(type) {
+	case string:
+		c = strings.Compare(av, b.(string))
+	case time.Time:
+		bv := b.(time.Time)
+		if av.Before(bv) {
+			c = -1
+		} else if av.After(bv) {
+			c = 1
+		}
+	case uint64:
+		bv := b.(uint64)
+		if av < bv {
+			c = -1
+		} else if av > bv {
+			c = 1
+		}
+	}
+	if c == 0 {
+		if idA < idB {
+			c = -1
+		} else if idA > idB {
+			c = 1
+		}
+	}
+
+	if desc {
+		return c > 0
+	}
+	return c < 0
+}
+
+// projectQuery は projectScan の Query 版
+func projectQuery(query *dynamo.Query, attrs []string) *dynamo.Query {
+	if len(attrs) == 0 {
+		return query
+	}
+
+	quoted := make([]string, len(attrs))
+	for i, attr := range attrs {
+		quoted[i] = "'" + attr + "'"
+	}
+
+	return query.Project(quoted...)
+}
+
+// queryOrder は並び順を Query の順序にする
+func queryOrder(desc bool) dynamo.Order {
+	if desc {
+		return dynamo.Descending
+	}
+	return dynamo.Ascending
+}
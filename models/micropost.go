@@ -2,6 +2,8 @@ package models
 
 import (
 	"sam-book-sample/db"
+	"sort"
+	"time"
 
 	"github.com/guregu/dynamo"
 
@@ -13,6 +15,41 @@ type Micropost struct {
 	BaseModel
 	Content string `dynamo:"Content"`
 	UserID  uint64 `dynamo:"UserID"`
+
+	// InReplyToID は返信先の Micropost の ID。返信でなければ 0。
+	// 返信先が削除されても返信は残し、InReplyToID もそのままにする
+	InReplyToID uint64 `dynamo:"InReplyToID,omitempty"`
+
+	// Hashtags と Mentions は本文から取り出した小文字のハッシュタグとユーザー名。本文を書き換えるときに取り出し直す
+	Hashtags []string `dynamo:"Hashtags,set,omitempty"`
+	Mentions []string `dynamo:"Mentions,set,omitempty"`
+
+	// MentionIDs はメンションを書き込んだときに解決したユーザーの ID。メンションの索引はこの ID で作る
+	MentionIDs []uint64 `dynamo:"MentionIDs,set,omitempty"`
+
+	// Attachments はアップロードを確かめた添付ファイル
+	Attachments []MicropostAttachment `dynamo:"Attachments,omitempty"`
+
+	// LikeCount はいいねの数。いいねの項目と同じトランザクションで増減する
+	LikeCount int64 `dynamo:"LikeCount"`
+
+	// ReplyCount は返信の数。返信の作成と削除と同じトランザクションで増減する
+	ReplyCount int64 `dynamo:"ReplyCount"`
+
+	// EditedAt は最後に本文を書き換えた日時、RevisionCount は残している編集前の本文の数。編集していなければ 0
+	EditedAt      time.Time `dynamo:"EditedAt,omitempty"`
+	RevisionCount int64     `dynamo:"RevisionCount"`
+
+	// 保存済みの本文とメンションしたユーザー。変更されたときに索引を付け替えるために使う
+	storedContent    string
+	storedMentionIDs []uint64
+
+	// source は承認した保留中の投稿や公開する予約投稿の項目を消す書き込み。作成と同じトランザクションで消し、
+	// 同じ投稿を二重に公開しないようにする
+	source *dynamo.Delete
+
+	// sourceRefs は source と一緒に消す、条件のない書き込み
+	sourceRefs []*dynamo.Delete
 }
 
 type MicropostDynamo struct {
@@ -20,6 +57,71 @@ type MicropostDynamo struct {
 	Micropost
 }
 
+func (d *MicropostDynamo) toMicropost() *Micropost {
+	m := d.Micropost
+	m.storedContent = m.Content
+	m.storedMentionIDs = m.MentionIDs
+	// 集合で保存するので順序が決まらない。読んだときは名前順にそろえる
+	sort.Strings(m.Hashtags)
+	sort.Strings(m.Mentions)
+	return &m
+}
+
+// MicropostPatch は Micropost の部分更新。nil の項目は変更しない
+type MicropostPatch struct {
+	Content *string
+}
+
+func (p *MicropostPatch) attributes() map[string]interface{} {
+	set := map[string]interface{}{}
+	if p.Content != nil {
+		set["Content"] = *p.Content
+		set["Hashtags"] = extractHashtags(*p.Content)
+		set["Mentions"] = extractMentions(*p.Content)
+	}
+	return set
+}
+
+// parseTerms は本文からハッシュタグとメンションを取り出し直す。
+// メンションしたユーザーは本文が変わったときだけ解決し直し、後から名前を変えたユーザーに付け替わらないようにする
+func (m *Micropost) parseTerms() error {
+	m.Hashtags = extractHashtags(m.Content)
+	m.Mentions = extractMentions(m.Content)
+	if m.Content == m.storedContent {
+		return nil
+	}
+
+	ids, err := resolveMentions(m.Mentions)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	m.MentionIDs = ids
+
+	return nil
+}
+
+func (m *Micropost) indexSource() indexSource {
+	return indexSource{Content: m.Content, MentionIDs: m.MentionIDs}
+}
+
+func (m *Micropost) storedIndexSource() indexSource {
+	return indexSource{Content: m.storedContent, MentionIDs: m.storedMentionIDs}
+}
+
+// markStored は書き込んだ本文とメンションしたユーザーを保存済みにする
+func (m *Micropost) markStored() {
+	m.storedContent = m.Content
+	m.storedMentionIDs = m.MentionIDs
+}
+
+// sortValue は一覧の並べ替えに使う attr の値を返す
+func (m *Micropost) sortValue(attr string) interface{} {
+	if attr == "CreatedAt" {
+		return m.CreatedAt
+	}
+	return m.ID
+}
+
 // implements DynamoModelMapper
 
 func (m *Micropost) EntityName() string {
@@ -67,16 +169,171 @@ func (m *Micropost) GenerateRecord() interface{} {
 	}
 }
 
+// CreateDynamoRecord は Micropost と全文検索の索引を書き込み、書き込めたらフォロワーのフィードに配る。
+// 返信なら返信先の数と索引も同じトランザクションで書き込み、返信先が存在しなければ ErrParentNotFound を返す
 func (m *Micropost) CreateDynamoRecord() error {
-	return createEntityToDynamo(m)
+	conn, err := db.ConnectDB()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = m.parseTerms()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	tx := conn.WriteTx()
+
+	r, err := generateCreateQuery(m)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	tx.Put(r)
+
+	// 条件のある書き込みを先に並べ、translateError で何番目が満たされなかったかを見分ける
+	onCheckFailed := []error{ErrConflict}
+	if m.source != nil {
+		tx.Delete(m.source)
+		onCheckFailed = append(onCheckFailed, ErrNotFound)
+	}
+	if m.InReplyToID != 0 {
+		err = addReplyQueries(tx, m)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		onCheckFailed = append(onCheckFailed, ErrParentNotFound)
+	}
+
+	for _, d := range m.sourceRefs {
+		tx.Delete(d)
+	}
+
+	err = addTokenQueries(tx, m, indexSource{}, m.indexSource())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = runWriteTx(tx, onCheckFailed...)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	m.markStored()
+
+	fanOutOnCreate(m)
+
+	return nil
 }
 
 func (m *Micropost) UpdateDynamoRecord() error {
-	return updateEntityToDynamo(m)
+	conn, err := db.ConnectDB()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = m.checkEditWindow()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	table, err := db.Table()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	tx := conn.WriteTx()
+
+	// 本文が変わったときだけ、編集前の本文を履歴に残す。書き込めるまで m の EditedAt と RevisionCount は変えない
+	editedAt, revisionCount := m.EditedAt, m.RevisionCount
+	var revision *dynamo.Put
+	if m.Content != m.storedContent {
+		editedAt = now()
+		revision = revisionPut(table, m, editedAt)
+		revisionCount++
+	}
+
+	err = m.parseTerms()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	// LikeCount や ReplyCount は別のトランザクションで増減するので、Put で丸ごと書き換えずに編集する項目だけを書き込む
+	query, err := generatePatchQuery(m, m.editableAttributes(editedAt, revisionCount))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	tx.Update(query)
+	if revision != nil {
+		tx.Put(revision)
+	}
+
+	err = addTokenQueries(tx, m, m.storedIndexSource(), m.indexSource())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = runWriteTx(tx, ErrVersionMismatch)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	m.EditedAt = editedAt
+	m.RevisionCount = revisionCount
+	m.Version++
+	m.touch(now(), false)
+	m.markStored()
+
+	return nil
+}
+
+// editableAttributes は UpdateDynamoRecord で書き換える属性を返す。EditedAt と RevisionCount は書き込む値を受け取る
+func (m *Micropost) editableAttributes(editedAt time.Time, revisionCount int64) map[string]interface{} {
+	set := map[string]interface{}{
+		"UserID":        m.UserID,
+		"Content":       m.Content,
+		"Hashtags":      m.Hashtags,
+		"Mentions":      m.Mentions,
+		"MentionIDs":    m.MentionIDs,
+		"RevisionCount": revisionCount,
+		"Attachments":   nil,
+	}
+	if len(m.Attachments) > 0 {
+		set["Attachments"] = m.Attachments
+	}
+	if !editedAt.IsZero() {
+		set["EditedAt"] = editedAt
+	}
+	return set
 }
 
 func (m *Micropost) DeleteDynamoRecord() error {
-	return deleteEntity(m)
+	conn, err := db.ConnectDB()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	tx := conn.WriteTx()
+
+	r, err := generateDeleteQuery(m)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	tx.Delete(r)
+
+	if m.InReplyToID != 0 {
+		err = addReplyDeleteQueries(tx, m)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	err = addTokenQueries(tx, m, m.storedIndexSource(), indexSource{})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return runWriteTx(tx)
 }
 
 func (m *Micropost) Update() error {
@@ -87,59 +344,319 @@ func (m *Micropost) Create() error {
 	return m.PutToDynamo()
 }
 
-func GetMicropostByID(id uint64) (*Micropost, error) {
+// GetMicropostByID は見つからなければ ErrNotFound を返す。attrs を指定するとその属性だけを読む
+func GetMicropostByID(id uint64, attrs ...string) (*Micropost, error) {
 	var micropost MicropostDynamo
-	ret, err := getEntityByID(id, &Micropost{}, &micropost)
+	_, err := getEntityByID(id, &Micropost{}, &micropost, attrs...)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
-	if ret == nil {
-		return nil, nil
-	}
-	return &micropost.Micropost, nil
+	return micropost.toMicropost(), nil
+}
+
+// GetMicropostsByUserID は userID のユーザーの Micropost を返す。attrs を指定するとその属性だけを読む
+func GetMicropostsByUserID(userID uint64, attrs ...string) ([]*Micropost, error) {
+	microposts, _, err := ListMicropostsByUserID(userID, &ListOptions{}, attrs...)
+	return microposts, errors.WithStack(err)
 }
 
-func GetMicropostsByUserID(userID uint64) ([]*Micropost, error) {
+// ListMicropostsByUserID は userID のユーザーの Micropost を opts の条件で返す。
+// 作成日時で並べるか絞り込むときは UserID-CreatedAt のインデックスを Query し、それ以外は Scan で読む。
+// CreatedAt のない古い項目はインデックスに入らないので、必要なときだけインデックスを使う
+func ListMicropostsByUserID(userID uint64, opts *ListOptions, attrs ...string) ([]*Micropost, *ListMeta, error) {
 	table, err := db.Table()
 	if err != nil {
-		return nil, errors.WithStack(err)
+		return nil, nil, errors.WithStack(err)
 	}
 
+	meta := newListMeta()
 	fb := nomof.NewBuilder()
-	fb.Equal("UserID", userID)
-	fb.BeginsWith(db.PKName, (&Micropost{}).EntityName())
 
 	var micropostDynamo []MicropostDynamo
-	err = table.
-		Scan().
-		Filter(fb.JoinAnd(), fb.Arg...).
-		All(&micropostDynamo)
+	after := createdAfterFilter(opts.Filters)
+	if opts.SortAttr == "CreatedAt" || after != nil {
+		meta.Index = db.UserIDCreatedAtIndex
+		meta.KeyConditions = append(meta.KeyConditions, "user_id")
+
+		query := table.
+			Get("UserID", userID).
+			Index(db.UserIDCreatedAtIndex).
+			Order(queryOrder(opts.Desc))
+
+		var rest []*Filter
+		for _, f := range opts.Filters {
+			if f == after {
+				query.Range("CreatedAt", dynamo.Greater, f.value())
+				meta.KeyConditions = append(meta.KeyConditions, f.Name)
+				continue
+			}
+			rest = append(rest, f)
+		}
 
-	if err != nil {
-		if err == dynamo.ErrNotFound {
-			return []*Micropost{}, nil
+		meta.addFilters(fb, rest)
+		query = projectQuery(query, attrs)
+		if len(rest) > 0 {
+			query.Filter(fb.JoinAnd(), fb.Arg...)
 		}
-		return nil, errors.WithStack(err)
+		err = query.All(&micropostDynamo)
+	} else {
+		meta.Scan = true
+
+		fb.Equal("UserID", userID)
+		fb.BeginsWith(db.PKName, (&Micropost{}).EntityName())
+		meta.addFilters(fb, opts.Filters)
+
+		err = projectScan(table.Scan(), attrs).
+			Filter(fb.JoinAnd(), fb.Arg...).
+			All(&micropostDynamo)
+	}
+
+	if err != nil && err != dynamo.ErrNotFound {
+		return nil, nil, errors.WithStack(err)
 	}
 
 	var microposts = make([]*Micropost, len(micropostDynamo))
 	for i := range micropostDynamo {
-		microposts[i] = &micropostDynamo[i].Micropost
+		microposts[i] = micropostDynamo[i].toMicropost()
 	}
 
-	return microposts, nil
+	if opts.SortAttr != "" {
+		sort.Slice(microposts, func(i, j int) bool {
+			return lessBy(microposts[i].sortValue(opts.SortAttr), microposts[j].sortValue(opts.SortAttr), microposts[i].ID, microposts[j].ID, opts.Desc)
+		})
+	}
+
+	return microposts, meta, nil
+}
+
+// createdAfterFilter は CreatedAt の範囲キーで評価できる絞り込みを返す
+func createdAfterFilter(filters []*Filter) *Filter {
+	for _, f := range filters {
+		if f.Attr == "CreatedAt" && f.Op == FilterAfter {
+			return f
+		}
+	}
+	return nil
 }
 
 func DeleteMicropost(id uint64) error {
 	micropost, err := GetMicropostByID(id)
+	if errors.Cause(err) == ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = micropost.DeleteDynamoRecord()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	// 返信そのものは残し、返信先を失ったものとして扱う
+	for _, prefix := range []string{likeSKPrefix, replySKPrefix, revisionSKPrefix} {
+		err = deleteChildItems(micropost.PK(), prefix)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+// deleteChildItems は削除した項目のパーティションに残った SK が prefix で始まる項目を消す
+func deleteChildItems(pk, prefix string) error {
+	table, err := db.Table()
 	if err != nil {
 		return errors.WithStack(err)
 	}
-	if micropost == nil {
+
+	var items []db.MainTable
+	err = table.
+		Get(db.PKName, pk).
+		Range(db.SKName, dynamo.BeginsWith, prefix).
+		Project(db.PKName, db.SKName).
+		All(&items)
+	if err != nil && err != dynamo.ErrNotFound {
+		return errors.WithStack(err)
+	}
+	if len(items) == 0 {
 		return nil
 	}
 
-	err = deleteEntity(micropost)
+	keys := make([]dynamo.Keyed, len(items))
+	for i, item := range items {
+		keys[i] = dynamo.Keys{item.PK, item.SK}
+	}
+
+	_, err = table.
+		Batch(db.PKName, db.SKName).
+		Write().
+		Delete(keys...).
+		Run()
 
 	return errors.WithStack(err)
 }
+
+// PatchMicropost は userID のユーザーの Micropost のうち patch の項目だけを UpdateItem で書き換える。
+// 本文が変わったら、同じトランザクションで全文検索の索引を付け替える。
+// 存在しないか他のユーザーのものなら ErrNotFound を返す
+func PatchMicropost(userID, id uint64, patch *MicropostPatch) error {
+	micropost, err := GetMicropostByID(id)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if micropost.UserID != userID {
+		return errors.WithStack(ErrNotFound)
+	}
+
+	set := patch.attributes()
+	if len(set) == 0 {
+		return nil
+	}
+
+	after := micropost.storedIndexSource()
+	if *patch.Content != micropost.storedContent {
+		ids, err := resolveMentions(extractMentions(*patch.Content))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		after = indexSource{Content: *patch.Content, MentionIDs: ids}
+		set["MentionIDs"] = ids
+	}
+
+	err = micropost.checkEditWindow()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	table, err := db.Table()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	// 本文が変わったときだけ、編集前の本文を履歴に残す。Version の条件があるので RevisionCount はそのまま進めてよい
+	var revision *dynamo.Put
+	if *patch.Content != micropost.storedContent {
+		editedAt := now()
+		revision = revisionPut(table, micropost, editedAt)
+		set["EditedAt"] = editedAt
+		set["RevisionCount"] = micropost.RevisionCount + 1
+	}
+
+	query, err := generatePatchQuery(micropost, set)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	conn, err := db.ConnectDB()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	tx := conn.WriteTx().Update(query)
+	if revision != nil {
+		tx.Put(revision)
+	}
+
+	err = addTokenQueries(tx, micropost, micropost.storedIndexSource(), after)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return runWriteTx(tx, ErrVersionMismatch)
+}
+
+// GetMicropostsByIDs は ids の Micropost を BatchGetItem でまとめて読む。見つからない ID は結果に含まれない
+func GetMicropostsByIDs(ids []uint64) (map[uint64]*Micropost, error) {
+	microposts := map[uint64]*Micropost{}
+	if len(ids) == 0 {
+		return microposts, nil
+	}
+
+	table, err := db.Table()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	keys := make([]dynamo.Keyed, len(ids))
+	for i, id := range ids {
+		m := &Micropost{BaseModel: BaseModel{ID: id}}
+		keys[i] = dynamo.Keys{m.PK(), m.SK()}
+	}
+
+	var micropostDynamo []MicropostDynamo
+	err = table.
+		Batch(db.PKName, db.SKName).
+		Get(keys...).
+		All(&micropostDynamo)
+	if err != nil && err != dynamo.ErrNotFound {
+		return nil, errors.WithStack(err)
+	}
+
+	for i := range micropostDynamo {
+		m := micropostDynamo[i].toMicropost()
+		microposts[m.ID] = m
+	}
+
+	return microposts, nil
+}
+
+// maxFilterUserIDs を超える数のユーザーは FilterExpression の長さの上限に収まらないので、
+// Micropost をすべて読んでから絞り込む
+const maxFilterUserIDs = 50
+
+// GetLatestMicropostsByUserIDs はユーザーごとに新しい順で limit 件までの Micropost を返す。
+// UserID のインデックスがないため、ユーザーごとに読むと N+1 になるので 1 回の Scan で読む
+func GetLatestMicropostsByUserIDs(userIDs []uint64, limit int) (map[uint64][]*Micropost, error) {
+	microposts := map[uint64][]*Micropost{}
+	if len(userIDs) == 0 {
+		return microposts, nil
+	}
+
+	table, err := db.Table()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	fb := nomof.NewBuilder()
+	fb.BeginsWith(db.PKName, (&Micropost{}).EntityName())
+
+	scan := table.
+		Scan().
+		Filter(fb.JoinAnd(), fb.Arg...)
+
+	wanted := map[uint64]bool{}
+	for _, id := range userIDs {
+		wanted[id] = true
+	}
+
+	if len(userIDs) <= maxFilterUserIDs {
+		ub := nomof.NewBuilder()
+		for _, id := range userIDs {
+			ub.Equal("UserID", id)
+		}
+		scan.Filter(ub.JoinOr(), ub.Arg...)
+	}
+
+	var micropostDynamo []MicropostDynamo
+	err = scan.All(&micropostDynamo)
+	if err != nil && err != dynamo.ErrNotFound {
+		return nil, errors.WithStack(err)
+	}
+
+	// ID は採番順なので大きいほど新しい
+	sort.Slice(micropostDynamo, func(i, j int) bool {
+		return micropostDynamo[i].ID > micropostDynamo[j].ID
+	})
+
+	for i := range micropostDynamo {
+		m := micropostDynamo[i].toMicropost()
+		if !wanted[m.UserID] || len(microposts[m.UserID]) >= limit {
+			continue
+		}
+		microposts[m.UserID] = append(microposts[m.UserID], m)
+	}
+
+	return microposts, nil
+}
@@ -0,0 +1,176 @@
+package models
+
+import (
+	"net"
+	"regexp"
+	"sam-book-sample/settings"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"golang.org/x/text/width"
+)
+
+// ModerationAction は審査の判定。値が大きいほど厳しい
+type ModerationAction int
+
+const (
+	ModerationAllow ModerationAction = iota
+	ModerationHold
+	ModerationReject
+)
+
+// ModerationResult の Reason は判定した規則の名前で、保留した投稿と一緒に保存して管理者が確かめるのに使う
+type ModerationResult struct {
+	Action ModerationAction
+	Reason string
+}
+
+var moderationAllowed = &ModerationResult{Action: ModerationAllow}
+
+// Moderator は保存する前の Micropost を審査する。外部のサービスに問い合わせる実装にも差し替えられる
+type Moderator interface {
+	Moderate(m *Micropost) (*ModerationResult, error)
+}
+
+// moderator が nil なら設定から組み立てた RuleModerator で審査する
+var moderator Moderator
+
+// SetModerator は審査の実装を差し替え、元の実装を返す。nil を渡すと設定の規則に戻す
+func SetModerator(m Moderator) Moderator {
+	prev := moderator
+	moderator = m
+	return prev
+}
+
+func currentModerator() Moderator {
+	if moderator != nil {
+		return moderator
+	}
+	return NewRuleModeratorFromSettings()
+}
+
+// ModerationRule は本文が規則に当たれば判定を返し、当たらなければ nil を返す
+type ModerationRule func(content string) *ModerationResult
+
+// RuleModerator は Rules のうち最も厳しい判定を返す
+type RuleModerator struct {
+	Rules []ModerationRule
+}
+
+func (r *RuleModerator) Moderate(m *Micropost) (*ModerationResult, error) {
+	result := moderationAllowed
+	for _, rule := range r.Rules {
+		if res := rule(m.Content); res != nil && res.Action > result.Action {
+			result = res
+		}
+	}
+	return result, nil
+}
+
+// NewRuleModeratorFromSettings は環境変数の一覧から規則を組み立てる
+func NewRuleModeratorFromSettings() *RuleModerator {
+	envs := settings.Env()
+
+	rules := []ModerationRule{
+		BannedWordsRule(envs.ModerationBannedWords(), ModerationReject, "banned_word"),
+		BlockedURLRule(envs.ModerationBlockedHosts(), ModerationReject),
+		BannedWordsRule(envs.ModerationReviewWords(), ModerationHold, "review_word"),
+	}
+	if n := envs.ModerationMaxRepeatedChars(); n > 0 {
+		rules = append(rules, RepeatedCharactersRule(n, ModerationHold))
+	}
+
+	return &RuleModerator{Rules: rules}
+}
+
+// normalizeForModeration は全角を半角に、大文字を小文字にそろえ、表記の揺れで規則を逃れられないようにする
+func normalizeForModeration(s string) string {
+	return strings.ToLower(width.Fold.String(s))
+}
+
+// BannedWordsRule は words のいずれかを含む本文を action と判定する
+func BannedWordsRule(words []string, action ModerationAction, reason string) ModerationRule {
+	var normalized []string
+	for _, w := range words {
+		if w = normalizeForModeration(w); w != "" {
+			normalized = append(normalized, w)
+		}
+	}
+
+	return func(content string) *ModerationResult {
+		content = normalizeForModeration(content)
+		for _, w := range normalized {
+			if strings.Contains(content, w) {
+				return &ModerationResult{Action: action, Reason: reason}
+			}
+		}
+		return nil
+	}
+}
+
+var urlHostPattern = regexp.MustCompile(`https?://([^\s/?#]+)`)
+
+// BlockedURLRule は hosts のいずれかかそのサブドメインへの URL を含む本文を action と判定する
+func BlockedURLRule(hosts []string, action ModerationAction) ModerationRule {
+	var normalized []string
+	for _, h := range hosts {
+		if h = strings.Trim(normalizeForModeration(h), "."); h != "" {
+			normalized = append(normalized, h)
+		}
+	}
+
+	return func(content string) *ModerationResult {
+		for _, match := range urlHostPattern.FindAllStringSubmatch(normalizeForModeration(content), -1) {
+			host := urlHost(match[1])
+			for _, h := range normalized {
+				if host == h || strings.HasSuffix(host, "."+h) {
+					return &ModerationResult{Action: action, Reason: "blocked_url"}
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// urlHost は URL の authority から認証情報とポートを除いたホスト名を返す
+func urlHost(authority string) string {
+	if i := strings.LastIndex(authority, "@"); i >= 0 {
+		authority = authority[i+1:]
+	}
+	if host, _, err := net.SplitHostPort(authority); err == nil {
+		authority = host
+	}
+	return strings.TrimSuffix(authority, ".")
+}
+
+// RepeatedCharactersRule は空白以外の同じ文字が max を超えて続く本文を action と判定する
+func RepeatedCharactersRule(max int, action ModerationAction) ModerationRule {
+	return func(content string) *ModerationResult {
+		var prev rune
+		run := 0
+		for _, r := range content {
+			if r == prev {
+				run++
+			} else {
+				prev, run = r, 1
+			}
+			if run > max && !unicode.IsSpace(r) {
+				return &ModerationResult{Action: action, Reason: "repeated_characters"}
+			}
+		}
+		return nil
+	}
+}
+
+// CheckMicropostContent は編集した本文を審査する。編集は保留できないので、許可されなければ ErrModerationRejected を返す
+func CheckMicropostContent(m *Micropost) error {
+	result, err := currentModerator().Moderate(m)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if result.Action != ModerationAllow {
+		return errors.WithStack(ErrModerationRejected)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuleModerator(t *testing.T) {
+	moderator := &RuleModerator{Rules: []ModerationRule{
+		BannedWordsRule([]string{"Spam", ""}, ModerationReject, "banned_word"),
+		BlockedURLRule([]string{"evil.example.com", "bad.test."}, ModerationReject),
+		BannedWordsRule([]string{"セール"}, ModerationHold, "review_word"),
+		RepeatedCharactersRule(5, ModerationHold),
+	}}
+
+	cases := []struct {
+		Content  string
+		Expected *ModerationResult
+	}{
+		{Content: "hello", Expected: moderationAllowed},
+		{Content: "ＳＰＡＭです", Expected: &ModerationResult{Action: ModerationReject, Reason: "banned_word"}},
+		{Content: "see https://www.evil.example.com/path", Expected: &ModerationResult{Action: ModerationReject, Reason: "blocked_url"}},
+		{Content: "see http://user@BAD.test:8080?q=1", Expected: &ModerationResult{Action: ModerationReject, Reason: "blocked_url"}},
+		{Content: "see https://notevil.example.com.jp/", Expected: moderationAllowed},
+		{Content: "ｾｰﾙ中", Expected: &ModerationResult{Action: ModerationHold, Reason: "review_word"}},
+		{Content: "wwwww", Expected: moderationAllowed},
+		{Content: "wwwwww", Expected: &ModerationResult{Action: ModerationHold, Reason: "repeated_characters"}},
+		{Content: "a      b", Expected: moderationAllowed},
+		{Content: "セール spam", Expected: &ModerationResult{Action: ModerationReject, Reason: "banned_word"}},
+	}
+
+	for i, c := range cases {
+		res, err := moderator.Moderate(&Micropost{Content: c.Content})
+		assert.NoError(t, err)
+		assert.Equal(t, c.Expected, res, fmt.Sprintf("Case:%d", i+1))
+	}
+}
+
+func TestNewRuleModeratorFromSettings(t *testing.T) {
+	os.Setenv("MODERATION_BANNED_WORDS", "foo, bar")
+	os.Setenv("MODERATION_MAX_REPEATED_CHARS", "0")
+	defer os.Unsetenv("MODERATION_BANNED_WORDS")
+	defer os.Unsetenv("MODERATION_MAX_REPEATED_CHARS")
+
+	assert.Equal(t, ErrModerationRejected, errors.Cause(CheckMicropostContent(&Micropost{Content: "a BAR b"})))
+	assert.NoError(t, CheckMicropostContent(&Micropost{Content: "aaaaaaaaaaaaaaaaaaaa"}))
+}
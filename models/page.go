@@ -0,0 +1,93 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"sam-book-sample/db"
+	"strings"
+
+	"github.com/guregu/dynamo"
+	"github.com/pkg/errors"
+)
+
+// Page は一覧の 1 ページ分の読み方。Cursor は前のページが返した続きの位置で、空なら先頭から読む
+type Page struct {
+	Limit  int
+	Cursor string
+}
+
+// encodeCursor は続きの位置をクライアントにそのまま渡せる文字列にする
+func encodeCursor(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// decodeCursor は encodeCursor の逆。読めなければ ErrInvalidCursor を返す
+func decodeCursor(cursor string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return errors.WithStack(ErrInvalidCursor)
+	}
+
+	err = json.Unmarshal(b, v)
+	if err != nil {
+		return errors.WithStack(ErrInvalidCursor)
+	}
+
+	return nil
+}
+
+// pageRange は queryPage が読む範囲。Hash と Range は query のパーティションキーと範囲キーの属性名
+type pageRange struct {
+	Hash        string
+	HashValue   string
+	Range       string
+	RangePrefix string
+}
+
+// contains は LastEvaluatedKey が r の中を指しているかを返す。
+// 別の一覧のカーソルを StartFrom に渡すと DynamoDB が ValidationException で拒むので、先に確かめる
+func (r pageRange) contains(key dynamo.PagingKey) bool {
+	if key[db.PKName] == nil || key[db.SKName] == nil {
+		return false
+	}
+
+	hash, rng := key[r.Hash], key[r.Range]
+	if hash == nil || rng == nil || hash.S == nil || rng.S == nil {
+		return false
+	}
+
+	return *hash.S == r.HashValue && strings.HasPrefix(*rng.S, r.RangePrefix)
+}
+
+// queryPage は r の範囲を読む query を page.Limit 件まで読んで out に入れる。続きがあれば LastEvaluatedKey をカーソルにして返す。
+// カーソルが r の外を指していれば ErrInvalidCursor を返す
+func queryPage(query *dynamo.Query, r pageRange, page *Page, out interface{}) (string, error) {
+	if page.Cursor != "" {
+		var key dynamo.PagingKey
+		err := decodeCursor(page.Cursor, &key)
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+		if !r.contains(key) {
+			return "", errors.WithStack(ErrInvalidCursor)
+		}
+		query.StartFrom(key)
+	}
+
+	last, err := query.
+		Limit(int64(page.Limit)).
+		AllWithLastEvaluatedKey(out)
+	if err != nil && err != dynamo.ErrNotFound {
+		return "", errors.WithStack(err)
+	}
+
+	if last == nil {
+		return "", nil
+	}
+
+	return encodeCursor(last)
+}
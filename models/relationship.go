@@ -0,0 +1,314 @@
+package models
+
+import (
+	"fmt"
+	"sam-book-sample/db"
+	"sam-book-sample/logging"
+	"sam-book-sample/settings"
+	"time"
+
+	"github.com/guregu/dynamo"
+	"github.com/memememomo/nomof"
+	"github.com/pkg/errors"
+)
+
+const (
+	relationshipSKPrefix = "Follows-"
+	followCountsSK       = "FollowCounts"
+)
+
+// Relationship はフォローの関係。フォローする側のユーザーのパーティションに
+// SK=Follows-<フォローされる側の ID> で置き、フォロワーの一覧は InvertedIndex から読む
+type Relationship struct {
+	FollowerID uint64    `dynamo:"FollowerID"`
+	FolloweeID uint64    `dynamo:"FolloweeID"`
+	CreatedAt  time.Time `dynamo:"CreatedAt"`
+}
+
+type RelationshipDynamo struct {
+	db.MainTable
+	Relationship
+}
+
+// FollowCounts はフォロー数とフォロワー数。User の項目は Put で丸ごと書き換えるので、
+// 数え直しが消えないよう同じパーティションの別の項目に置く
+type FollowCounts struct {
+	FollowerCount  int64 `dynamo:"FollowerCount"`
+	FollowingCount int64 `dynamo:"FollowingCount"`
+}
+
+func userPK(id uint64) string {
+	return (&User{BaseModel: BaseModel{ID: id}}).PK()
+}
+
+func relationshipSK(followeeID uint64) string {
+	return fmt.Sprintf("%s%011d", relationshipSKPrefix, followeeID)
+}
+
+// Follow は followerID のユーザーが followeeID のユーザーをフォローする。
+// 関係の項目と双方の数を同じトランザクションで書き込むので、失敗してもそのまま再試行できる。
+// 自分自身なら ErrSelfFollow、すでにフォローしていれば ErrAlreadyFollowing を返す
+func Follow(followerID, followeeID uint64) error {
+	if followerID == followeeID {
+		return errors.WithStack(ErrSelfFollow)
+	}
+
+	users, err := GetUsersByIDs([]uint64{followerID, followeeID})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if len(users) < 2 {
+		return errors.WithStack(ErrNotFound)
+	}
+
+	conn, err := db.ConnectDB()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	table, err := db.Table()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	r := &RelationshipDynamo{
+		MainTable: db.MainTable{
+			PK: userPK(followerID),
+			SK: relationshipSK(followeeID),
+		},
+		Relationship: Relationship{
+			FollowerID: followerID,
+			FolloweeID: followeeID,
+			CreatedAt:  now(),
+		},
+	}
+
+	fb := nomof.NewBuilder()
+	fb.AttributeNotExists(db.PKName)
+
+	tx := conn.WriteTx().Put(table.Put(r).If(fb.JoinAnd(), fb.Arg...))
+	addFollowCounts(tx, table, followerID, followeeID, 1)
+
+	err = runWriteTx(tx, ErrAlreadyFollowing)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	checkCelebrity(followeeID)
+
+	return nil
+}
+
+// Unfollow はフォローをやめる。関係の項目と双方の数を同じトランザクションで書き込み、フォロワーのフィードから相手の投稿を消す
+func Unfollow(followerID, followeeID uint64) error {
+	if followerID == followeeID {
+		return nil
+	}
+
+	conn, err := db.ConnectDB()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	table, err := db.Table()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	fb := nomof.NewBuilder()
+	fb.AttributeExists(db.PKName)
+
+	del := table.
+		Delete(db.PKName, userPK(followerID)).
+		Range(db.SKName, relationshipSK(followeeID)).
+		If(fb.JoinAnd(), fb.Arg...)
+
+	tx := conn.WriteTx().Delete(del)
+	addFollowCounts(tx, table, followerID, followeeID, -1)
+
+	// 解除済みでもフィードは消し直し、途中で失敗したときは再試行で片付くようにする
+	err = runWriteTx(tx, ErrNotFound)
+	if err != nil && errors.Cause(err) != ErrNotFound {
+		return errors.WithStack(err)
+	}
+
+	return purgeFeed(followerID, followeeID)
+}
+
+// addFollowCounts はそれぞれの数を n だけ増やす書き込みを tx に加える
+func addFollowCounts(tx *dynamo.WriteTx, table *dynamo.Table, followerID, followeeID uint64, n int) {
+	tx.Update(table.
+		Update(db.PKName, userPK(followerID)).
+		Range(db.SKName, followCountsSK).
+		Add("FollowingCount", n))
+	tx.Update(table.
+		Update(db.PKName, userPK(followeeID)).
+		Range(db.SKName, followCountsSK).
+		Add("FollowerCount", n))
+}
+
+// checkCelebrity はフォロワーが基準を超えていれば、以降の投稿をフィードに書き込まずに読むときに集めるよう印を付ける。
+// 一度付けた印は数が減っても外さない。フォローは済んでいるので、失敗してもログに残して次のフォローで付け直す
+func checkCelebrity(userID uint64) {
+	err := func() error {
+		counts, err := GetFollowCounts(userID)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if counts.FollowerCount <= int64(settings.Env().FeedCelebrityThreshold()) {
+			return nil
+		}
+
+		marked, err := isCelebrity(userID)
+		if err != nil || marked {
+			return errors.WithStack(err)
+		}
+
+		return markCelebrity(userID)
+	}()
+	if err != nil {
+		logging.Default().WithError(err).WithField("user_id", userID).Warn("failed to mark celebrity")
+	}
+}
+
+// deleteRelationships は userID のユーザーのフォローとフォロワーの関係をすべて解除し、相手の数を減らす。
+// 最後にそのユーザーの数と印を消す。途中で失敗しても、残った関係から再試行できる
+func deleteRelationships(userID uint64) error {
+	table, err := db.Table()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	var following []Relationship
+	err = table.
+		Get(db.PKName, userPK(userID)).
+		Range(db.SKName, dynamo.BeginsWith, relationshipSKPrefix).
+		All(&following)
+	if err != nil && err != dynamo.ErrNotFound {
+		return errors.WithStack(err)
+	}
+
+	var followers []Relationship
+	err = table.
+		Get(db.SKName, relationshipSK(userID)).
+		Index(db.InvertedIndex).
+		All(&followers)
+	if err != nil && err != dynamo.ErrNotFound {
+		return errors.WithStack(err)
+	}
+
+	for _, r := range append(following, followers...) {
+		err = Unfollow(r.FollowerID, r.FolloweeID)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	_, err = table.
+		Batch(db.PKName, db.SKName).
+		Write().
+		Delete(
+			dynamo.Keys{userPK(userID), followCountsSK},
+			dynamo.Keys{celebrityPK, userPK(userID)},
+		).
+		Run()
+
+	return errors.WithStack(err)
+}
+
+// GetFollowCounts は userID のユーザーのフォロー数とフォロワー数を返す
+func GetFollowCounts(userID uint64) (*FollowCounts, error) {
+	table, err := db.Table()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var counts FollowCounts
+	err = table.
+		Get(db.PKName, userPK(userID)).
+		Range(db.SKName, dynamo.Equal, followCountsSK).
+		One(&counts)
+	if err == dynamo.ErrNotFound {
+		return &FollowCounts{}, nil
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &counts, nil
+}
+
+// ListFollowing は userID のユーザーがフォローしているユーザーをフォローした順に返す。
+// 続きがあれば次のページのカーソルも返す
+func ListFollowing(userID uint64, page *Page) ([]*User, string, error) {
+	table, err := db.Table()
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+
+	query := table.
+		Get(db.PKName, userPK(userID)).
+		Range(db.SKName, dynamo.BeginsWith, relationshipSKPrefix)
+
+	var relationships []Relationship
+	r := pageRange{Hash: db.PKName, HashValue: userPK(userID), Range: db.SKName, RangePrefix: relationshipSKPrefix}
+	next, err := queryPage(query, r, page, &relationships)
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+
+	ids := make([]uint64, len(relationships))
+	for i, r := range relationships {
+		ids[i] = r.FolloweeID
+	}
+
+	users, err := getUsersInOrder(ids)
+
+	return users, next, errors.WithStack(err)
+}
+
+// ListFollowers は userID のユーザーをフォローしているユーザーを返す。
+// InvertedIndex の範囲キーは PK なので、フォロワーの ID の順になる
+func ListFollowers(userID uint64, page *Page) ([]*User, string, error) {
+	table, err := db.Table()
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+
+	query := table.
+		Get(db.SKName, relationshipSK(userID)).
+		Index(db.InvertedIndex)
+
+	var relationships []Relationship
+	r := pageRange{Hash: db.SKName, HashValue: relationshipSK(userID), Range: db.PKName}
+	next, err := queryPage(query, r, page, &relationships)
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+
+	ids := make([]uint64, len(relationships))
+	for i, r := range relationships {
+		ids[i] = r.FollowerID
+	}
+
+	users, err := getUsersInOrder(ids)
+
+	return users, next, errors.WithStack(err)
+}
+
+// getUsersInOrder は ids の順にユーザーを返す。削除されたユーザーは除く
+func getUsersInOrder(ids []uint64) ([]*User, error) {
+	found, err := GetUsersByIDs(ids)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	users := []*User{}
+	for _, id := range ids {
+		if u, ok := found[id]; ok {
+			users = append(users, u)
+		}
+	}
+
+	return users, nil
+}
@@ -0,0 +1,137 @@
+package models
+
+import (
+	"fmt"
+	"sam-book-sample/db"
+	"time"
+
+	"github.com/guregu/dynamo"
+	"github.com/memememomo/nomof"
+	"github.com/pkg/errors"
+)
+
+const replySKPrefix = "Reply-"
+
+// Reply は返信の索引。返信先の Micropost のパーティションに SK=Reply-<返信の ID> で置くので、
+// スレッドは Scan せずに返信の ID の順で読める
+type Reply struct {
+	ReplyID   uint64    `dynamo:"ReplyID"`
+	AuthorID  uint64    `dynamo:"AuthorID"`
+	CreatedAt time.Time `dynamo:"CreatedAt"`
+}
+
+type ReplyDynamo struct {
+	db.MainTable
+	Reply
+}
+
+func replySK(replyID uint64) string {
+	return fmt.Sprintf("%s%011d", replySKPrefix, replyID)
+}
+
+// replyCountQuery は返信先の Micropost の ReplyCount を n だけ増やす。LikeCount と同じく Version は上げない
+func replyCountQuery(table *dynamo.Table, parentID uint64, n int) *dynamo.Update {
+	fb := nomof.NewBuilder()
+	fb.AttributeExists(db.PKName)
+
+	return table.
+		Update(db.PKName, micropostPK(parentID)).
+		Range(db.SKName, (&Micropost{BaseModel: BaseModel{ID: parentID}}).SK()).
+		Add("ReplyCount", n).
+		If(fb.JoinAnd(), fb.Arg...)
+}
+
+// addReplyQueries は返信の m を作成するときの返信先の数の更新と索引の書き込みを tx に加える。
+// 返信先が存在しなければ返信先の更新の条件が満たされない
+func addReplyQueries(tx *dynamo.WriteTx, m *Micropost) error {
+	table, err := db.Table()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	tx.Update(replyCountQuery(table, m.InReplyToID, 1))
+	tx.Put(table.Put(&ReplyDynamo{
+		MainTable: db.MainTable{
+			PK: micropostPK(m.InReplyToID),
+			SK: replySK(m.ID),
+		},
+		Reply: Reply{
+			ReplyID:   m.ID,
+			AuthorID:  m.UserID,
+			CreatedAt: m.CreatedAt,
+		},
+	}))
+
+	return nil
+}
+
+// addReplyDeleteQueries は返信の m を削除するときの索引の削除と返信先の数の更新を tx に加える。
+// 返信先がすでに削除されていれば数は更新しない
+func addReplyDeleteQueries(tx *dynamo.WriteTx, m *Micropost) error {
+	table, err := db.Table()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	tx.Delete(table.
+		Delete(db.PKName, micropostPK(m.InReplyToID)).
+		Range(db.SKName, replySK(m.ID)))
+
+	_, err = GetMicropostByID(m.InReplyToID, "ID")
+	if errors.Cause(err) == ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	tx.Update(replyCountQuery(table, m.InReplyToID, -1))
+
+	return nil
+}
+
+// ListReplies は userID のユーザーの Micropost への返信を古い順に返す。
+// 返信先が存在しないか他のユーザーのものなら ErrNotFound を返す。続きがあれば次のページのカーソルも返す
+func ListReplies(userID, micropostID uint64, page *Page) ([]*Micropost, string, error) {
+	parent, err := GetMicropostByID(micropostID, "ID", "UserID")
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+	if parent.UserID != userID {
+		return nil, "", errors.WithStack(ErrNotFound)
+	}
+
+	table, err := db.Table()
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+
+	query := table.
+		Get(db.PKName, micropostPK(micropostID)).
+		Range(db.SKName, dynamo.BeginsWith, replySKPrefix)
+
+	var replies []Reply
+	next, err := queryPage(query, pageRange{Hash: db.PKName, HashValue: micropostPK(micropostID), Range: db.SKName, RangePrefix: replySKPrefix}, page, &replies)
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+
+	ids := make([]uint64, len(replies))
+	for i, r := range replies {
+		ids[i] = r.ReplyID
+	}
+
+	found, err := GetMicropostsByIDs(ids)
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+
+	microposts := []*Micropost{}
+	for _, id := range ids {
+		if m, ok := found[id]; ok {
+			microposts = append(microposts, m)
+		}
+	}
+
+	return microposts, next, nil
+}
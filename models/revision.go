@@ -0,0 +1,103 @@
+package models
+
+import (
+	"fmt"
+	"sam-book-sample/db"
+	"sam-book-sample/settings"
+	"time"
+
+	"github.com/guregu/dynamo"
+	"github.com/pkg/errors"
+)
+
+const revisionSKPrefix = "Revision-"
+
+// Revision は編集される前の本文。Micropost のパーティションに SK=Revision-<版> で置く
+type Revision struct {
+	MicropostID uint64 `dynamo:"MicropostID"`
+	Revision    int64  `dynamo:"Revision"`
+	Content     string `dynamo:"Content"`
+
+	// WrittenAt はこの本文を書いた日時、ReplacedAt は次の本文に書き換えた日時
+	WrittenAt  time.Time `dynamo:"WrittenAt"`
+	ReplacedAt time.Time `dynamo:"ReplacedAt"`
+}
+
+type RevisionDynamo struct {
+	db.MainTable
+	Revision
+}
+
+func revisionSK(revision int64) string {
+	return fmt.Sprintf("%s%011d", revisionSKPrefix, revision)
+}
+
+// checkEditWindow は作成から MicropostEditWindow を過ぎていれば ErrEditWindowExpired を返す。
+// 作成日時のない古い Micropost はいつ作られたか分からないので、期限を設けずに編集できるままにする
+func (m *Micropost) checkEditWindow() error {
+	window := settings.Env().MicropostEditWindow()
+	if window <= 0 || m.CreatedAt.IsZero() {
+		return nil
+	}
+	if now().After(m.CreatedAt.Add(window)) {
+		return errors.WithStack(ErrEditWindowExpired)
+	}
+	return nil
+}
+
+// revisionPut は保存済みの本文を次の版の履歴として書き込む。書き込みは Version を上げる書き込みと同じトランザクションに入れるので、
+// 同じ版を二重に書くことはない
+func revisionPut(table *dynamo.Table, m *Micropost, editedAt time.Time) *dynamo.Put {
+	writtenAt := m.EditedAt
+	if writtenAt.IsZero() {
+		writtenAt = m.CreatedAt
+	}
+
+	return table.Put(&RevisionDynamo{
+		MainTable: db.MainTable{
+			PK: m.PK(),
+			SK: revisionSK(m.RevisionCount + 1),
+		},
+		Revision: Revision{
+			MicropostID: m.ID,
+			Revision:    m.RevisionCount + 1,
+			Content:     m.storedContent,
+			WrittenAt:   writtenAt,
+			ReplacedAt:  editedAt,
+		},
+	})
+}
+
+// ListRevisions は userID のユーザーの Micropost の編集前の本文を古い順に返す。続きがあれば次のページのカーソルも返す。
+// Micropost が存在しないか他のユーザーのものなら ErrNotFound を返す
+func ListRevisions(userID, micropostID uint64, page *Page) ([]*Revision, string, error) {
+	m, err := GetMicropostByID(micropostID, "ID", "UserID")
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+	if m.UserID != userID {
+		return nil, "", errors.WithStack(ErrNotFound)
+	}
+
+	table, err := db.Table()
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+
+	query := table.
+		Get(db.PKName, micropostPK(micropostID)).
+		Range(db.SKName, dynamo.BeginsWith, revisionSKPrefix)
+
+	var items []Revision
+	next, err := queryPage(query, pageRange{Hash: db.PKName, HashValue: micropostPK(micropostID), Range: db.SKName, RangePrefix: revisionSKPrefix}, page, &items)
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+
+	revisions := make([]*Revision, len(items))
+	for i := range items {
+		revisions[i] = &items[i]
+	}
+
+	return revisions, next, nil
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckEditWindow(t *testing.T) {
+	recent := &Micropost{}
+	recent.CreatedAt = now().Add(-time.Minute)
+	old := &Micropost{}
+	old.CreatedAt = now().Add(-2 * time.Hour)
+	// 作成日時を持たない古い項目
+	legacy := &Micropost{}
+
+	// 設定がなければ期限を設けない
+	os.Unsetenv("MICROPOST_EDIT_WINDOW_MINUTES")
+	assert.NoError(t, old.checkEditWindow())
+	assert.NoError(t, legacy.checkEditWindow())
+
+	os.Setenv("MICROPOST_EDIT_WINDOW_MINUTES", "60")
+	defer os.Unsetenv("MICROPOST_EDIT_WINDOW_MINUTES")
+
+	assert.NoError(t, recent.checkEditWindow())
+	assert.Equal(t, ErrEditWindowExpired, errors.Cause(old.checkEditWindow()))
+	assert.NoError(t, legacy.checkEditWindow())
+}
+
+func TestEditableAttributes(t *testing.T) {
+	m := &Micropost{Content: "edited", RevisionCount: 1}
+
+	// 書き込む前の m の値でなく、渡した値を書き込む
+	editedAt := now()
+	set := m.editableAttributes(editedAt, 2)
+	assert.Equal(t, int64(2), set["RevisionCount"])
+	assert.Equal(t, editedAt, set["EditedAt"])
+	assert.Nil(t, set["Attachments"])
+	assert.True(t, m.EditedAt.IsZero())
+	assert.Equal(t, int64(1), m.RevisionCount)
+
+	set = m.editableAttributes(time.Time{}, 1)
+	_, ok := set["EditedAt"]
+	assert.False(t, ok)
+}
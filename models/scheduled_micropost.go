@@ -0,0 +1,393 @@
+package models
+
+import (
+	"fmt"
+	"sam-book-sample/db"
+	"sam-book-sample/logging"
+	"sam-book-sample/settings"
+	"time"
+
+	"github.com/guregu/dynamo"
+	"github.com/memememomo/nomof"
+	"github.com/pkg/errors"
+)
+
+const (
+	schedulePKPrefix               = "Schedule-"
+	scheduledMicropostSKPrefix     = "ScheduledMicropost-"
+	scheduledMicropostIDEntityName = "ScheduledMicropost"
+	scheduleBucketSize             = time.Hour
+	scheduleBucketFormat           = "2006010215"
+
+	// schedulePublisherPK は公開する処理がどのパーティションまで読み終えたかを持つ項目
+	schedulePublisherPK = "SchedulePublisher"
+
+	// maxScheduleSweepBuckets は 1 回の Run で Lookback より前に遡って読むパーティションの数
+	maxScheduleSweepBuckets = 24 * 7
+)
+
+// errPublishedAhead は他の Run が読み終えたパーティションの記録を先に進めていたときのエラーで、呼び出し元には返さない
+const errPublishedAhead = Error("published until is already ahead")
+
+// ScheduledMicropost は publish_at を指定して予約した投稿。公開するまで Micropost として保存しないので、一覧やフィードや検索には出ない。
+// ID で引くための PK=ScheduledMicropost-<ID> の項目と、公開する日時の 1 時間ごとのパーティション Schedule-<YYYYMMDDHH> の項目を
+// 同じトランザクションで書き、公開する処理は期限の来たパーティションだけを読む
+type ScheduledMicropost struct {
+	ID          uint64                `dynamo:"ID"`
+	AuthorID    uint64                `dynamo:"AuthorID"`
+	Content     string                `dynamo:"Content"`
+	InReplyToID uint64                `dynamo:"InReplyToID,omitempty"`
+	Attachments []MicropostAttachment `dynamo:"Attachments,omitempty"`
+	PublishAt   time.Time             `dynamo:"PublishAt"`
+	CreatedAt   time.Time             `dynamo:"CreatedAt"`
+}
+
+type ScheduledMicropostDynamo struct {
+	db.MainTable
+	ScheduledMicropost
+}
+
+type schedulePublisherState struct {
+	PK string `dynamo:"PK"`
+	SK string `dynamo:"SK"`
+
+	// PublishedUntil より前のパーティションの予約はすべて公開した
+	PublishedUntil time.Time `dynamo:"PublishedUntil"`
+}
+
+func schedulePK(t time.Time) string {
+	return schedulePKPrefix + t.UTC().Format(scheduleBucketFormat)
+}
+
+func scheduledMicropostSK(id uint64) string {
+	return fmt.Sprintf("%s%011d", scheduledMicropostSKPrefix, id)
+}
+
+// scheduledMicropostPK は ID で引くための項目の PK。パーティションの項目の SK と同じ形にする
+func scheduledMicropostPK(id uint64) string {
+	return scheduledMicropostSK(id)
+}
+
+func scheduledMicropostIDSK(id uint64) string {
+	return fmt.Sprintf("%011d", id)
+}
+
+// record は公開する日時のパーティションに置く項目を返す
+func (s *ScheduledMicropost) record() *ScheduledMicropostDynamo {
+	return &ScheduledMicropostDynamo{
+		MainTable:          db.MainTable{PK: schedulePK(s.PublishAt), SK: scheduledMicropostSK(s.ID)},
+		ScheduledMicropost: *s,
+	}
+}
+
+// idRecord は ID で引くための項目を返す
+func (s *ScheduledMicropost) idRecord() *ScheduledMicropostDynamo {
+	return &ScheduledMicropostDynamo{
+		MainTable:          db.MainTable{PK: scheduledMicropostPK(s.ID), SK: scheduledMicropostIDSK(s.ID)},
+		ScheduledMicropost: *s,
+	}
+}
+
+// scheduledMicropostDeleteQuery は予約を消す。すでに公開か取り消しか予約の変更がされていれば条件を満たさない
+func scheduledMicropostDeleteQuery(table *dynamo.Table, s *ScheduledMicropost) *dynamo.Delete {
+	fb := nomof.NewBuilder()
+	fb.AttributeExists(db.PKName)
+	fb.Equal("PublishAt", s.PublishAt)
+
+	return table.
+		Delete(db.PKName, schedulePK(s.PublishAt)).
+		Range(db.SKName, scheduledMicropostSK(s.ID)).
+		If(fb.JoinAnd(), fb.Arg...)
+}
+
+func scheduledMicropostIDDeleteQuery(table *dynamo.Table, id uint64) *dynamo.Delete {
+	return table.
+		Delete(db.PKName, scheduledMicropostPK(id)).
+		Range(db.SKName, scheduledMicropostIDSK(id))
+}
+
+// ScheduleMicropost は m を publishAt に公開するよう予約する。予約した投稿は保留できないので、
+// 審査で許可されなければ ErrModerationRejected を返す
+func ScheduleMicropost(m *Micropost, publishAt time.Time) (*ScheduledMicropost, error) {
+	err := CheckMicropostContent(m)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	id, err := db.GenerateID(scheduledMicropostIDEntityName)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	s := &ScheduledMicropost{
+		ID:          id,
+		AuthorID:    m.UserID,
+		Content:     m.Content,
+		InReplyToID: m.InReplyToID,
+		Attachments: m.Attachments,
+		PublishAt:   publishAt.UTC().Truncate(time.Second),
+		CreatedAt:   now(),
+	}
+
+	conn, err := db.ConnectDB()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	table, err := db.Table()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	tx := conn.WriteTx().
+		Put(table.Put(s.record())).
+		Put(table.Put(s.idRecord()))
+	err = runWriteTx(tx)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return s, nil
+}
+
+// GetScheduledMicropost は userID のユーザーの予約を返す。予約がないか他のユーザーのものなら ErrNotFound を返す
+func GetScheduledMicropost(userID, id uint64) (*ScheduledMicropost, error) {
+	table, err := db.Table()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var s ScheduledMicropost
+	err = table.
+		Get(db.PKName, scheduledMicropostPK(id)).
+		Range(db.SKName, dynamo.Equal, scheduledMicropostIDSK(id)).
+		Consistent(true).
+		One(&s)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	if s.AuthorID != userID {
+		return nil, errors.WithStack(ErrNotFound)
+	}
+
+	return &s, nil
+}
+
+// CancelScheduledMicropost は userID のユーザーの予約を取り消す。予約がなければ ErrNotFound を返す
+func CancelScheduledMicropost(userID, id uint64) error {
+	s, err := GetScheduledMicropost(userID, id)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	table, err := db.Table()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return cancelScheduledMicropost(table, s)
+}
+
+// cancelScheduledMicropost はパーティションの項目と ID で引く項目を同じトランザクションで消す。
+// すでに公開か取り消しか予約の変更がされていれば ErrNotFound を返す
+func cancelScheduledMicropost(table *dynamo.Table, s *ScheduledMicropost) error {
+	conn, err := db.ConnectDB()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	tx := conn.WriteTx().
+		Delete(scheduledMicropostDeleteQuery(table, s)).
+		Delete(scheduledMicropostIDDeleteQuery(table, s.ID))
+
+	return runWriteTx(tx, ErrNotFound)
+}
+
+// RescheduleMicropost は userID のユーザーの予約を publishAt に変える。パーティションが変われば古い項目の削除と
+// 新しい項目の書き込みを、ID で引く項目の書き換えと同じトランザクションで行う。予約がないか、その間に公開されていれば
+// ErrNotFound を返す
+func RescheduleMicropost(userID, id uint64, publishAt time.Time) (*ScheduledMicropost, error) {
+	s, err := GetScheduledMicropost(userID, id)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	conn, err := db.ConnectDB()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	table, err := db.Table()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	rescheduled := *s
+	rescheduled.PublishAt = publishAt.UTC().Truncate(time.Second)
+
+	tx := conn.WriteTx()
+	if schedulePK(s.PublishAt) == schedulePK(rescheduled.PublishAt) {
+		fb := nomof.NewBuilder()
+		fb.AttributeExists(db.PKName)
+		fb.Equal("PublishAt", s.PublishAt)
+
+		tx.Put(table.
+			Put(rescheduled.record()).
+			If(fb.JoinAnd(), fb.Arg...))
+	} else {
+		tx.Delete(scheduledMicropostDeleteQuery(table, s)).
+			Put(table.Put(rescheduled.record()))
+	}
+	tx.Put(table.Put(rescheduled.idRecord()))
+
+	err = runWriteTx(tx, ErrNotFound)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &rescheduled, nil
+}
+
+// ScheduledPublisher は期限の来た予約を公開する。Now を差し替えると任意の時刻で動かせる
+type ScheduledPublisher struct {
+	Now func() time.Time
+
+	// Lookback は毎回読み直す期間。これより前のパーティションは、読み終えていなければ続きから少しずつ読む
+	Lookback time.Duration
+}
+
+func NewScheduledPublisher(now func() time.Time) *ScheduledPublisher {
+	return &ScheduledPublisher{
+		Now:      now,
+		Lookback: settings.Env().ScheduleLookback(),
+	}
+}
+
+// Run は Now の時点で期限の来た予約を公開し、公開した数を返す。1 件の失敗で止めず、最後に失敗したエラーを返す。
+// 処理が Lookback より長く止まっていても取りこぼさないよう、失敗のなかったパーティションまでを記録しておき、
+// 記録より後で Lookback より前のパーティションも読む
+func (p *ScheduledPublisher) Run() (int, error) {
+	t := p.Now().UTC()
+	current := t.Truncate(scheduleBucketSize)
+	lookback := t.Add(-p.Lookback).Truncate(scheduleBucketSize)
+
+	table, err := db.Table()
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	var state schedulePublisherState
+	err = table.
+		Get(db.PKName, schedulePublisherPK).
+		Range(db.SKName, dynamo.Equal, schedulePublisherPK).
+		Consistent(true).
+		One(&state)
+	if err != nil && err != dynamo.ErrNotFound {
+		return 0, errors.WithStack(err)
+	}
+
+	var buckets []time.Time
+	until := lookback
+	if !state.PublishedUntil.IsZero() {
+		until = state.PublishedUntil
+		if until.Before(lookback) {
+			logging.Default().WithField("published_until", until).Warn("reading scheduled microposts older than lookback")
+		}
+		for bucket := until; bucket.Before(lookback) && len(buckets) < maxScheduleSweepBuckets; bucket = bucket.Add(scheduleBucketSize) {
+			buckets = append(buckets, bucket)
+		}
+	}
+	for bucket := lookback; !bucket.After(current); bucket = bucket.Add(scheduleBucketSize) {
+		buckets = append(buckets, bucket)
+	}
+
+	published := 0
+	var lastErr error
+	for _, bucket := range buckets {
+		var items []ScheduledMicropost
+		failed := false
+		err = table.
+			Get(db.PKName, schedulePK(bucket)).
+			Range(db.SKName, dynamo.BeginsWith, scheduledMicropostSKPrefix).
+			All(&items)
+		if err != nil && err != dynamo.ErrNotFound {
+			return published, errors.WithStack(err)
+		}
+
+		for i := range items {
+			s := &items[i]
+			if s.PublishAt.After(t) {
+				continue
+			}
+
+			err = publishScheduledMicropost(table, s)
+			if err != nil {
+				logging.Default().WithError(err).WithField("scheduled_id", s.ID).Warn("failed to publish scheduled micropost")
+				lastErr = err
+				failed = true
+				continue
+			}
+			published++
+		}
+
+		// 今のパーティションには期限の来ていない予約が残るので、記録は前のパーティションまでしか進めない
+		if !failed && bucket.Equal(until) && bucket.Before(current) {
+			until = bucket.Add(scheduleBucketSize)
+		}
+	}
+
+	if until.After(state.PublishedUntil) {
+		err = savePublishedUntil(table, until)
+		if err != nil {
+			return published, errors.WithStack(err)
+		}
+	}
+
+	return published, lastErr
+}
+
+// savePublishedUntil は読み終えたパーティションの記録を until に進める。他の Run が先に進めていれば何もしない
+func savePublishedUntil(table *dynamo.Table, until time.Time) error {
+	fb := nomof.NewBuilder()
+	fb.AttributeNotExists(db.PKName)
+	fb.LessThan("PublishedUntil", until)
+
+	err := table.
+		Put(&schedulePublisherState{PK: schedulePublisherPK, SK: schedulePublisherPK, PublishedUntil: until}).
+		If(fb.JoinOr(), fb.Arg...).
+		Run()
+	err = translateError(err, errPublishedAhead)
+	if errors.Cause(err) == errPublishedAhead {
+		return nil
+	}
+
+	return errors.WithStack(err)
+}
+
+// publishScheduledMicropost は予約を Micropost として保存し、同じトランザクションで予約を消す。
+// その間に取り消されていれば何もしない。返信先が削除されていれば公開できないので予約を消す
+func publishScheduledMicropost(table *dynamo.Table, s *ScheduledMicropost) error {
+	m := &Micropost{
+		UserID:      s.AuthorID,
+		Content:     s.Content,
+		InReplyToID: s.InReplyToID,
+		Attachments: s.Attachments,
+		source:      scheduledMicropostDeleteQuery(table, s),
+		sourceRefs:  []*dynamo.Delete{scheduledMicropostIDDeleteQuery(table, s.ID)},
+	}
+
+	err := m.Create()
+	switch errors.Cause(err) {
+	case nil:
+		return nil
+	case ErrNotFound:
+		return nil
+	case ErrParentNotFound:
+		logging.Default().WithField("scheduled_id", s.ID).Warn("dropped scheduled reply to deleted micropost")
+		err = cancelScheduledMicropost(table, s)
+		if errors.Cause(err) == ErrNotFound {
+			return nil
+		}
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(err)
+}
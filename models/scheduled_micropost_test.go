@@ -0,0 +1,15 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchedulePK(t *testing.T) {
+	jst := time.FixedZone("JST", 9*60*60)
+
+	assert.Equal(t, "Schedule-2026101903", schedulePK(time.Date(2026, 10, 19, 12, 59, 59, 0, jst)))
+	assert.Equal(t, "Schedule-2026101904", schedulePK(time.Date(2026, 10, 19, 4, 0, 0, 0, time.UTC)))
+}
@@ -0,0 +1,297 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"sam-book-sample/db"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/guregu/dynamo"
+	"github.com/pkg/errors"
+	"golang.org/x/text/width"
+)
+
+const (
+	// Micropost の Scan は PK の前方一致で絞り込むので、"Micropost" で始まらない名前にする
+	micropostTokenPrefix = "SearchToken-"
+
+	// maxMicropostTokens は 1 件の Micropost から索引に入れるトークンの種類の数。
+	// 索引は Micropost と同じトランザクションで書くので、本文を丸ごと書き換えても maxIndexTxItems に収まるようにする
+	maxMicropostTokens = 30
+
+	// maxIndexTxItems は 1 つのトランザクションで索引の書き換えに使える項目の数。残りは Micropost 自身や返信の数に空けておく
+	maxIndexTxItems = maxTxItems - 20
+
+	// maxQueryTokens は検索語から使うトークンの数。トークンごとに Query するので上限を設ける
+	maxQueryTokens = 10
+
+	// maxTokenPostings は検索でトークンごとに読む索引の項目の数。よく使われるトークンでも読む量が増えないよう、新しいものから読む
+	maxTokenPostings = 1000
+)
+
+// MicropostToken は本文から作る索引の項目。トークンやハッシュタグごとのパーティションに Micropost を並べる
+type MicropostToken struct {
+	Token       string `dynamo:"PK"`
+	MicropostPK string `dynamo:"SK"`
+	MicropostID uint64 `dynamo:"MicropostID"`
+	Count       int    `dynamo:"Count"`
+}
+
+// SearchResult は検索結果の Micropost と関連度のスコア
+type SearchResult struct {
+	Micropost *Micropost
+	Score     float64
+}
+
+// searchCursor の Query は検索語のハッシュ。別の検索語のカーソルを使い回せないようにする
+type searchCursor struct {
+	Query  string `json:"query"`
+	Offset int    `json:"offset"`
+}
+
+func hashQuery(q string) string {
+	sum := sha256.Sum256([]byte(q))
+	return hex.EncodeToString(sum[:8])
+}
+
+// tokenize は text を全文検索のトークンに分ける。英数字は単語ごと、日本語は連続する部分を
+// 2 文字ずつずらした n-gram にする。1 文字だけの日本語はそのまま 1 つのトークンにする
+func tokenize(text string) []string {
+	text = strings.ToLower(width.Fold.String(text))
+
+	var tokens []string
+	var run []rune
+	cjk := false
+
+	flush := func() {
+		switch {
+		case len(run) == 0:
+		case !cjk || len(run) == 1:
+			tokens = append(tokens, string(run))
+		default:
+			for i := 0; i+1 < len(run); i++ {
+				tokens = append(tokens, string(run[i:i+2]))
+			}
+		}
+		run = run[:0]
+	}
+
+	for _, r := range text {
+		switch {
+		case isCJK(r):
+			if !cjk {
+				flush()
+				cjk = true
+			}
+			run = append(run, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if cjk {
+				flush()
+				cjk = false
+			}
+			run = append(run, r)
+		default:
+			flush()
+		}
+	}
+	flush()
+
+	return tokens
+}
+
+func isCJK(r rune) bool {
+	// 長音符は Katakana に含まれないので個別に扱う
+	return r == 'ー' || unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana)
+}
+
+// countTokens はトークンごとの出現回数を返す。種類が max を超えたら、先に出てきたものだけを数える
+func countTokens(tokens []string, max int) map[string]int {
+	counts := map[string]int{}
+	for _, t := range tokens {
+		if _, ok := counts[t]; !ok && len(counts) >= max {
+			continue
+		}
+		counts[t]++
+	}
+	return counts
+}
+
+func micropostTokenCounts(src indexSource) map[string]int {
+	return countTokens(tokenize(src.Content), maxMicropostTokens)
+}
+
+// indexSource は Micropost の索引を作る元になる値
+type indexSource struct {
+	Content    string
+	MentionIDs []uint64
+}
+
+// micropostIndexes は Micropost から作る索引の接頭辞と、索引に入れる語と出現回数を取り出す関数
+var micropostIndexes = []struct {
+	prefix string
+	counts func(src indexSource) map[string]int
+}{
+	{micropostTokenPrefix, micropostTokenCounts},
+	{hashtagPrefix, hashtagCounts},
+	{mentionPrefix, mentionCounts},
+}
+
+// tokenChanges は m の索引の元が before から after に変わったときに書き込む索引の項目と、消す索引のキーを返す。
+// 出現回数が変わらない語は書き込まない
+func tokenChanges(m *Micropost, before, after indexSource) ([]interface{}, []dynamo.Keyed) {
+	var puts []interface{}
+	var deletes []dynamo.Keyed
+	for _, index := range micropostIndexes {
+		oldCounts := index.counts(before)
+		newCounts := index.counts(after)
+
+		for token, count := range newCounts {
+			if oldCounts[token] == count {
+				continue
+			}
+			puts = append(puts, &MicropostToken{
+				Token:       index.prefix + token,
+				MicropostPK: m.PK(),
+				MicropostID: m.ID,
+				Count:       count,
+			})
+		}
+
+		for token := range oldCounts {
+			if _, ok := newCounts[token]; ok {
+				continue
+			}
+			deletes = append(deletes, dynamo.Keys{index.prefix + token, m.PK()})
+		}
+	}
+
+	return puts, deletes
+}
+
+// addTokenQueries は m の索引を before から after に書き換える書き込みを tx に加える。
+// Micropost と同じトランザクションで書き込み、索引が本文とずれないようにする
+func addTokenQueries(tx *dynamo.WriteTx, m *Micropost, before, after indexSource) error {
+	table, err := db.Table()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	puts, deletes := tokenChanges(m, before, after)
+	for _, p := range puts {
+		tx.Put(table.Put(p))
+	}
+	for _, key := range deletes {
+		tx.Delete(table.Delete(db.PKName, key.HashKey()).Range(db.SKName, key.RangeKey()))
+	}
+
+	return nil
+}
+
+// SearchMicroposts は q のトークンをすべて含む Micropost を関連度の高い順に返す。
+// 関連度はトークンごとの出現回数に、そのトークンを含む Micropost が少ないほど大きくなる重みを掛けた合計。
+// トークンごとに新しいほうから maxTokenPostings 件までしか読まないので、それより古い Micropost は見つからないことがある。
+// 続きがあれば次のページのカーソルも返す
+func SearchMicroposts(q string, page *Page) ([]*SearchResult, string, error) {
+	cursor := searchCursor{Query: hashQuery(q)}
+	if page.Cursor != "" {
+		err := decodeCursor(page.Cursor, &cursor)
+		if err != nil {
+			return nil, "", errors.WithStack(err)
+		}
+		if cursor.Offset < 0 || cursor.Query != hashQuery(q) {
+			return nil, "", errors.WithStack(ErrInvalidCursor)
+		}
+	}
+
+	queryTokens := countTokens(tokenize(q), maxQueryTokens)
+	if len(queryTokens) == 0 {
+		return []*SearchResult{}, "", nil
+	}
+
+	table, err := db.Table()
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+
+	postings := map[string][]MicropostToken{}
+	docs := map[uint64]bool{}
+	for token := range queryTokens {
+		var items []MicropostToken
+		err = table.
+			Get(db.PKName, micropostTokenPrefix+token).
+			Order(dynamo.Descending).
+			Limit(maxTokenPostings).
+			All(&items)
+		if err != nil && err != dynamo.ErrNotFound {
+			return nil, "", errors.WithStack(err)
+		}
+		if len(items) == 0 {
+			return []*SearchResult{}, "", nil
+		}
+
+		postings[token] = items
+		for _, item := range items {
+			docs[item.MicropostID] = true
+		}
+	}
+
+	// 件数の全体を数えるには Scan が必要なので、検索語のどれかを含む Micropost の数で重みを決める
+	scores := map[uint64]float64{}
+	matched := map[uint64]int{}
+	for _, items := range postings {
+		idf := math.Log(1 + float64(len(docs))/float64(len(items)))
+		for _, item := range items {
+			scores[item.MicropostID] += float64(item.Count) * idf
+			matched[item.MicropostID]++
+		}
+	}
+
+	var ids []uint64
+	for id, n := range matched {
+		if n == len(postings) {
+			ids = append(ids, id)
+		}
+	}
+
+	// 関連度が同じなら新しい順
+	sort.Slice(ids, func(i, j int) bool {
+		if scores[ids[i]] != scores[ids[j]] {
+			return scores[ids[i]] > scores[ids[j]]
+		}
+		return ids[i] > ids[j]
+	})
+
+	if cursor.Offset >= len(ids) {
+		return []*SearchResult{}, "", nil
+	}
+	end := cursor.Offset + page.Limit
+	if end > len(ids) {
+		end = len(ids)
+	}
+
+	var next string
+	if end < len(ids) {
+		next, err = encodeCursor(&searchCursor{Query: cursor.Query, Offset: end})
+		if err != nil {
+			return nil, "", errors.WithStack(err)
+		}
+	}
+
+	microposts, err := GetMicropostsByIDs(ids[cursor.Offset:end])
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+
+	results := []*SearchResult{}
+	for _, id := range ids[cursor.Offset:end] {
+		// 索引を読んでから削除されたものは除く
+		if m, ok := microposts[id]; ok {
+			results = append(results, &SearchResult{Micropost: m, Score: scores[id]})
+		}
+	}
+
+	return results, next, nil
+}
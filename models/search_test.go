@@ -0,0 +1,85 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/guregu/dynamo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenize(t *testing.T) {
+	cases := []struct {
+		Text     string
+		Expected []string
+	}{
+		{Text: "", Expected: nil},
+		{Text: "Hello, World!", Expected: []string{"hello", "world"}},
+		{Text: "ＧＯ言語", Expected: []string{"go", "言語"}},
+		{Text: "東京タワーに行った", Expected: []string{"東京", "京タ", "タワ", "ワー", "ーに", "に行", "行っ", "った"}},
+		{Text: "猫 と dog", Expected: []string{"猫", "と", "dog"}},
+		{Text: "ｶﾀｶﾅ", Expected: []string{"カタ", "タカ", "カナ"}},
+	}
+
+	for i, c := range cases {
+		assert.Equal(t, c.Expected, tokenize(c.Text), fmt.Sprintf("Case:%d", i+1))
+	}
+}
+
+func TestCountTokens(t *testing.T) {
+	counts := countTokens([]string{"a", "b", "a", "c", "b"}, 2)
+	assert.Equal(t, map[string]int{"a": 2, "b": 2}, counts)
+}
+
+func TestTokenChanges(t *testing.T) {
+	m := &Micropost{BaseModel: BaseModel{ID: 1}}
+
+	puts, deletes := tokenChanges(m,
+		indexSource{Content: "go go #go", MentionIDs: []uint64{2}},
+		indexSource{Content: "go rust #rust", MentionIDs: []uint64{3}})
+
+	var tokens []string
+	for _, p := range puts {
+		tokens = append(tokens, p.(*MicropostToken).Token)
+	}
+	assert.ElementsMatch(t, []string{"SearchToken-go", "SearchToken-rust", "Hashtag-rust", "Mention-User-00000000003"}, tokens)
+	assert.ElementsMatch(t, []dynamo.Keyed{
+		dynamo.Keys{"Hashtag-go", "Micropost-00000000001"},
+		dynamo.Keys{"Mention-User-00000000002", "Micropost-00000000001"},
+	}, deletes)
+}
+
+// maxIndexSource は索引に入れる項目が上限まである indexSource を作る。offset を変えると重ならない語になる
+func maxIndexSource(offset int) indexSource {
+	var words, tags []string
+	var mentionIDs []uint64
+	for i := offset; i < offset+100; i++ {
+		words = append(words, fmt.Sprintf("w%d", i))
+		tags = append(tags, fmt.Sprintf("#t%d", i))
+	}
+	// resolveMentions は maxMentions 人までしか返さない
+	for i := offset; i < offset+maxMentions; i++ {
+		mentionIDs = append(mentionIDs, uint64(i+2))
+	}
+	return indexSource{Content: strings.Join(append(words, tags...), " "), MentionIDs: mentionIDs}
+}
+
+func TestTokenChanges_max(t *testing.T) {
+	m := &Micropost{BaseModel: BaseModel{ID: 1}}
+	src := maxIndexSource(0)
+
+	puts, deletes := tokenChanges(m, indexSource{}, src)
+	assert.Len(t, puts, maxMicropostTokens+maxHashtags+maxMentions)
+	assert.Empty(t, deletes)
+
+	puts, deletes = tokenChanges(m, src, indexSource{})
+	assert.Empty(t, puts)
+	assert.Len(t, deletes, maxMicropostTokens+maxHashtags+maxMentions)
+
+	// 本文を丸ごと書き換えても、索引の書き込みはトランザクションの上限に収まる
+	puts, deletes = tokenChanges(m, src, maxIndexSource(1000))
+	assert.Len(t, puts, maxMicropostTokens+maxHashtags+maxMentions)
+	assert.Len(t, deletes, maxMicropostTokens+maxHashtags+maxMentions)
+	assert.True(t, len(puts)+len(deletes) <= maxIndexTxItems)
+}
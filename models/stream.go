@@ -0,0 +1,27 @@
+package models
+
+import (
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/guregu/dynamo"
+	"github.com/pkg/errors"
+)
+
+// UnmarshalUser は DynamoDB Streams の変更前後の項目などから User を読む
+func UnmarshalUser(item map[string]*dynamodb.AttributeValue) (*User, error) {
+	var d UserDynamo
+	err := dynamo.UnmarshalItem(item, &d)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return d.toUser(), nil
+}
+
+// UnmarshalMicropost は DynamoDB Streams の変更前後の項目などから Micropost を読む
+func UnmarshalMicropost(item map[string]*dynamodb.AttributeValue) (*Micropost, error) {
+	var d MicropostDynamo
+	err := dynamo.UnmarshalItem(item, &d)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return d.toMicropost(), nil
+}
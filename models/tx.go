@@ -0,0 +1,59 @@
+package models
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/guregu/dynamo"
+	"github.com/pkg/errors"
+)
+
+const (
+	// txRetryMax は他のトランザクションとの競合で取り消されたときに再実行する回数
+	txRetryMax      = 5
+	txRetryInterval = 20 * time.Millisecond
+
+	// maxTxItems は 1 つのトランザクションに入れられる項目の数
+	maxTxItems = 100
+)
+
+// runWriteTx はトランザクションを実行し、エラーを translateError で変換する。
+// 同じ項目を扱う他のトランザクションと競合して取り消された場合は待ってから再実行する。
+// 再実行では条件が評価し直されるので、同時に同じメールアドレスで登録されても
+// 後のほうは ErrDuplicateEmail になる
+func runWriteTx(tx *dynamo.WriteTx, onCheckFailed ...error) error {
+	var err error
+	for i := 0; i < txRetryMax; i++ {
+		err = tx.Run()
+		if !isTransactionConflict(err) {
+			break
+		}
+
+		interval := txRetryInterval << uint(i)
+		time.Sleep(interval/2 + time.Duration(rand.Int63n(int64(interval))))
+	}
+
+	return translateError(err, onCheckFailed...)
+}
+
+func isTransactionConflict(err error) bool {
+	ae, ok := errors.Cause(err).(awserr.Error)
+	if !ok {
+		return false
+	}
+
+	switch ae.Code() {
+	case dynamodb.ErrCodeTransactionConflictException:
+		return true
+	case dynamodb.ErrCodeTransactionCanceledException:
+		for _, reason := range cancellationReasons(ae) {
+			if reason == reasonTransactionConflict {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsTransactionConflict(t *testing.T) {
+	assert.True(t, isTransactionConflict(awserr.New(
+		dynamodb.ErrCodeTransactionCanceledException,
+		"Transaction cancelled, please refer cancellation reasons for specific reasons [None, TransactionConflict]",
+		nil,
+	)))
+	assert.False(t, isTransactionConflict(awserr.New(
+		dynamodb.ErrCodeTransactionCanceledException,
+		"Transaction cancelled, please refer cancellation reasons for specific reasons [None, ConditionalCheckFailed]",
+		nil,
+	)))
+	assert.False(t, isTransactionConflict(errors.New("other")))
+	assert.False(t, isTransactionConflict(nil))
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"sam-book-sample/db"
+	"sort"
 
 	"github.com/guregu/dynamo"
 
@@ -13,6 +14,10 @@ type User struct {
 	BaseModel
 	Name  string `dynamo:"Name"`
 	Email string `dynamo:"Email"`
+
+	// 保存済みのメールアドレスと名前。変更されたときに一意制約のレコードと名前から引く項目を付け替えるために使う
+	storedEmail string
+	storedName  string
 }
 
 type UserDynamo struct {
@@ -20,6 +25,41 @@ type UserDynamo struct {
 	User
 }
 
+func (d *UserDynamo) toUser() *User {
+	u := &d.User
+	u.storedEmail = u.Email
+	u.storedName = u.Name
+	return u
+}
+
+// UserPatch は User の部分更新。nil の項目は変更しない
+type UserPatch struct {
+	Name  *string
+	Email *string
+}
+
+func (p *UserPatch) attributes() map[string]interface{} {
+	set := map[string]interface{}{}
+	if p.Name != nil {
+		set["Name"] = *p.Name
+	}
+	if p.Email != nil {
+		set["Email"] = *p.Email
+	}
+	return set
+}
+
+// sortValue は一覧の並べ替えに使う attr の値を返す
+func (u *User) sortValue(attr string) interface{} {
+	switch attr {
+	case "Name":
+		return u.Name
+	case "CreatedAt":
+		return u.CreatedAt
+	}
+	return u.ID
+}
+
 // implements DynamoModelMapper
 
 func (u *User) EntityName() string {
@@ -56,9 +96,22 @@ func (u *User) CreateDynamoRecord() error {
 		return errors.WithStack(err)
 	}
 
-	err = tx.Put(r).Put(uniq).Run()
+	tx.Put(r).Put(uniq)
+
+	err = addUserNameQueries(tx, u.ID, "", u.Name)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = runWriteTx(tx, ErrConflict, ErrDuplicateEmail)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	u.storedEmail = u.Email
+	u.storedName = u.Name
 
-	return errors.WithStack(err)
+	return nil
 }
 
 func (u *User) UpdateDynamoRecord() error {
@@ -79,9 +132,30 @@ func (u *User) UpdateDynamoRecord() error {
 		return errors.WithStack(err)
 	}
 
-	err = tx.Put(r).Put(uniq).Run()
+	tx.Put(r).Put(uniq)
+
+	if u.storedEmail != "" && u.storedEmail != u.Email {
+		old, err := generateDeleteQueryByEmail(u.storedEmail, u)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		tx.Delete(old)
+	}
+
+	err = addUserNameQueries(tx, u.ID, u.storedName, u.Name)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = runWriteTx(tx, ErrVersionMismatch, ErrDuplicateEmail, ErrConflict)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	u.storedEmail = u.Email
+	u.storedName = u.Name
 
-	return errors.WithStack(err)
+	return nil
 }
 
 func (u *User) DeleteDynamoRecord() error {
@@ -102,9 +176,14 @@ func (u *User) DeleteDynamoRecord() error {
 		return errors.WithStack(err)
 	}
 
-	err = tx.Delete(r).Delete(uniq).Run()
+	tx.Delete(r).Delete(uniq)
+
+	err = addUserNameQueries(tx, u.ID, u.storedName, "")
+	if err != nil {
+		return errors.WithStack(err)
+	}
 
-	return errors.WithStack(err)
+	return runWriteTx(tx)
 }
 
 func (u *User) SetID(id uint64) {
@@ -144,6 +223,7 @@ func (u *User) Create() error {
 	return u.PutToDynamo()
 }
 
+// GetUserByEmail は見つからなければ ErrNotFound を返す
 func GetUserByEmail(email string) (*User, error) {
 	table, err := db.Table()
 	if err != nil {
@@ -161,71 +241,188 @@ func GetUserByEmail(email string) (*User, error) {
 		All(&usersDynamo)
 
 	if err != nil {
-		if err == dynamo.ErrNotFound {
-			return nil, nil
-		}
-		return nil, errors.WithStack(err)
+		return nil, translateError(err)
 	}
 
 	if len(usersDynamo) == 0 {
-		return nil, nil
+		return nil, errors.WithStack(ErrNotFound)
 	}
 
-	return &usersDynamo[0].User, nil
+	return usersDynamo[0].toUser(), nil
 }
 
-func GetUserByID(id uint64) (*User, error) {
+// GetUserByID は見つからなければ ErrNotFound を返す。attrs を指定するとその属性だけを読む
+func GetUserByID(id uint64, attrs ...string) (*User, error) {
 	var user UserDynamo
-	ret, err := getEntityByID(id, &User{}, &user)
+	_, err := getEntityByID(id, &User{}, &user, attrs...)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
-	if ret == nil {
-		return nil, nil
-	}
-	return &user.User, nil
+	return user.toUser(), nil
 }
 
-func GetUsers() ([]*User, error) {
+// GetUsers は全ユーザーを返す。attrs を指定するとその属性だけを読む
+func GetUsers(attrs ...string) ([]*User, error) {
+	users, _, err := ListUsers(&ListOptions{}, attrs...)
+	return users, errors.WithStack(err)
+}
+
+// ListUsers は opts の条件でユーザーを返す。ユーザーにはインデックスがないので常に Scan で読む
+func ListUsers(opts *ListOptions, attrs ...string) ([]*User, *ListMeta, error) {
 	table, err := db.Table()
 	if err != nil {
-		return nil, errors.WithStack(err)
+		return nil, nil, errors.WithStack(err)
 	}
 
+	meta := newListMeta()
+	meta.Scan = true
+
+	// 同じパーティションにあるフォローの項目を除く
 	fb := nomof.NewBuilder()
 	fb.BeginsWith(db.PKName, (&User{}).EntityName())
+	fb.AttributeExists("Email")
+	meta.addFilters(fb, opts.Filters)
 
 	var userDynamo []UserDynamo
-	err = table.
-		Scan().
+	err = projectScan(table.Scan(), attrs).
 		Filter(fb.JoinAnd(), fb.Arg...).
 		All(&userDynamo)
 
-	if err != nil {
-		if err == dynamo.ErrNotFound {
-			return []*User{}, nil
-		}
-		return nil, errors.WithStack(err)
+	if err != nil && err != dynamo.ErrNotFound {
+		return nil, nil, errors.WithStack(err)
 	}
 
 	var users = make([]*User, len(userDynamo))
 	for i := 0; i < len(userDynamo); i++ {
-		users[i] = &userDynamo[i].User
+		users[i] = userDynamo[i].toUser()
 	}
 
-	return users, nil
+	if opts.SortAttr != "" {
+		sort.Slice(users, func(i, j int) bool {
+			return lessBy(users[i].sortValue(opts.SortAttr), users[j].sortValue(opts.SortAttr), users[i].ID, users[j].ID, opts.Desc)
+		})
+	}
+
+	return users, meta, nil
 }
 
+// DeleteUser はユーザーを削除する。フォローの関係を先に解除するので、途中で失敗しても再試行で片付く
 func DeleteUser(id uint64) error {
 	user, err := GetUserByID(id)
+	if errors.Cause(err) == ErrNotFound {
+		return nil
+	}
 	if err != nil {
 		return errors.WithStack(err)
 	}
-	if user == nil {
+
+	err = deleteRelationships(id)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	conn, err := db.ConnectDB()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	r, err := generateDeleteQuery(user)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	tx := conn.WriteTx().Delete(r)
+
+	err = addUserNameQueries(tx, id, user.storedName, "")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return runWriteTx(tx)
+}
+
+// PatchUser は patch の項目だけを UpdateItem で書き換える。メールアドレスや名前が変わるときは
+// 一意制約のレコードや名前から引く項目の付け替えと同じトランザクションで書き込む
+func PatchUser(id uint64, patch *UserPatch) error {
+	set := patch.attributes()
+
+	user, err := GetUserByID(id)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if len(set) == 0 {
 		return nil
 	}
 
-	err = deleteEntity(user)
+	query, err := generatePatchQuery(user, set)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	conn, err := db.ConnectDB()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	tx := conn.WriteTx().Update(query)
+	onCheckFailed := []error{ErrVersionMismatch}
 
-	return errors.WithStack(err)
+	if patch.Email != nil && *patch.Email != user.storedEmail {
+		uniq, err := generateCreateQueryByUser(&User{BaseModel: BaseModel{ID: id}, Email: *patch.Email})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		old, err := generateDeleteQueryByEmail(user.storedEmail, user)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		tx.Put(uniq).Delete(old)
+		onCheckFailed = append(onCheckFailed, ErrDuplicateEmail, ErrConflict)
+	}
+
+	if patch.Name != nil {
+		err = addUserNameQueries(tx, id, user.storedName, *patch.Name)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return runWriteTx(tx, onCheckFailed...)
+}
+
+// GetUsersByIDs は ids のユーザーを BatchGetItem でまとめて読む。見つからない ID は結果に含まれない
+func GetUsersByIDs(ids []uint64) (map[uint64]*User, error) {
+	users := map[uint64]*User{}
+	if len(ids) == 0 {
+		return users, nil
+	}
+
+	table, err := db.Table()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	keys := make([]dynamo.Keyed, len(ids))
+	for i, id := range ids {
+		u := &User{BaseModel: BaseModel{ID: id}}
+		keys[i] = dynamo.Keys{u.PK(), u.SK()}
+	}
+
+	var usersDynamo []UserDynamo
+	err = table.
+		Batch(db.PKName, db.SKName).
+		Get(keys...).
+		All(&usersDynamo)
+	if err != nil && err != dynamo.ErrNotFound {
+		return nil, errors.WithStack(err)
+	}
+
+	for i := range usersDynamo {
+		u := usersDynamo[i].toUser()
+		users[u.ID] = u
+	}
+
+	return users, nil
 }
@@ -58,3 +58,22 @@ func generateDeleteQueryByUser(user *User) (*dynamo.Delete, error) {
 
 	return query, nil
 }
+
+// generateDeleteQueryByEmail は user が持っていた email の一意制約のレコードを消す。
+// 他のユーザーが取得したレコードは消さない
+func generateDeleteQueryByEmail(email string, user *User) (*dynamo.Delete, error) {
+	table, err := db.Table()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	fb := nomof.NewBuilder()
+	fb.Equal("UserID", user.ID)
+
+	query := table.
+		Delete(db.PKName, email).
+		Range(db.SKName, getEntityNameFromStruct(*user)).
+		If(fb.JoinAnd(), fb.Arg...)
+
+	return query, nil
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"sam-book-sample/db"
+
+	"github.com/guregu/dynamo"
+	"github.com/pkg/errors"
+)
+
+// userNamePrefix はユーザー名からユーザーを引く項目のパーティション。名前は一意でないので、SK にユーザーの PK を並べる
+const userNamePrefix = "UserName-"
+
+type UserName struct {
+	Name   string `dynamo:"PK"`
+	UserPK string `dynamo:"SK"`
+	UserID uint64 `dynamo:"UserID"`
+}
+
+func userNamePK(name string) string {
+	return userNamePrefix + normalizeUserName(name)
+}
+
+func userNamePut(table *dynamo.Table, name string, userID uint64) *dynamo.Put {
+	return table.Put(&UserName{
+		Name:   userNamePK(name),
+		UserPK: userPK(userID),
+		UserID: userID,
+	})
+}
+
+func userNameDelete(table *dynamo.Table, name string, userID uint64) *dynamo.Delete {
+	return table.
+		Delete(db.PKName, userNamePK(name)).
+		Range(db.SKName, userPK(userID))
+}
+
+// addUserNameQueries はユーザー名が oldName から newName に変わったときの書き込みを tx に加える。
+// oldName が空なら新しく作ったユーザー、newName が空なら削除したユーザーとして扱う。
+// 項目のない古いユーザーも書き込むたびに引けるようになるよう、newName の項目は変わらなくても書き直す
+func addUserNameQueries(tx *dynamo.WriteTx, userID uint64, oldName, newName string) error {
+	table, err := db.Table()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if oldName != "" && normalizeUserName(oldName) != normalizeUserName(newName) {
+		tx.Delete(userNameDelete(table, oldName, userID))
+	}
+	if newName != "" {
+		tx.Put(userNamePut(table, newName, userID))
+	}
+
+	return nil
+}
+
+// getUserIDsByName は名前が name のユーザーの ID を max 件まで返す
+func getUserIDsByName(name string, max int64) ([]uint64, error) {
+	table, err := db.Table()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var items []UserName
+	err = table.
+		Get(db.PKName, userNamePK(name)).
+		Limit(max).
+		All(&items)
+	if err != nil && err != dynamo.ErrNotFound {
+		return nil, errors.WithStack(err)
+	}
+
+	ids := make([]uint64, len(items))
+	for i, item := range items {
+		ids[i] = item.UserID
+	}
+
+	return ids, nil
+}
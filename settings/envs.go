@@ -3,6 +3,9 @@ package settings
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/golang/glog"
 
@@ -59,6 +62,27 @@ func (c *Envs) env(key string) string {
 	return os.Getenv(key)
 }
 
+// intEnv は key を整数として読む。設定されていないか読めなければ def を返す
+func (c *Envs) intEnv(key string, def int) int {
+	n, err := strconv.Atoi(c.env(key))
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+// listEnv は key をカンマ区切りの一覧として読む。空の要素は除く
+func (c *Envs) listEnv(key string) []string {
+	var list []string
+	for _, v := range strings.Split(c.env(key), ",") {
+		v = strings.TrimSpace(v)
+		if v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
 func (c *Envs) ProjectName() string {
 	return c.env("PROJECT_NAME")
 }
@@ -67,6 +91,17 @@ func (c *Envs) IsDebug() bool {
 	return c.env("DEBUG") != ""
 }
 
+// LogLevel は debug, info, warn, error のいずれか
+func (c *Envs) LogLevel() string {
+	if c.env("LOG_LEVEL") != "" {
+		return c.env("LOG_LEVEL")
+	}
+	if c.IsDebug() {
+		return "debug"
+	}
+	return "info"
+}
+
 func (c *Envs) DynamoEndpoint() string {
 	return c.env("DYNAMO_ENDPOINT")
 }
@@ -81,3 +116,73 @@ func (c *Envs) DynamoTableName() string {
 func (c *Envs) IsDynamoLocal() bool {
 	return c.DynamoEndpoint() != ""
 }
+
+func (c *Envs) S3Endpoint() string {
+	return c.env("S3_ENDPOINT")
+}
+
+func (c *Envs) IsS3Local() bool {
+	return c.S3Endpoint() != ""
+}
+
+// AttachmentBucketName は添付ファイルを置く S3 のバケット
+func (c *Envs) AttachmentBucketName() string {
+	return c.env("ATTACHMENT_BUCKET_NAME")
+}
+
+// FeedMaxItems はユーザーごとのフィードに残す件数
+func (c *Envs) FeedMaxItems() int {
+	return c.intEnv("FEED_MAX_ITEMS", 500)
+}
+
+// FeedTTL はフィードの項目を DynamoDB の TTL で消すまでの期間
+func (c *Envs) FeedTTL() time.Duration {
+	return time.Duration(c.intEnv("FEED_TTL_DAYS", 30)) * 24 * time.Hour
+}
+
+// FeedSyncFanOutLimit はフィードへの書き込みを投稿のリクエストの中でも済ませるフォロワー数の上限。
+// 超えたら StreamConsumer が配るまで待つ
+func (c *Envs) FeedSyncFanOutLimit() int {
+	return c.intEnv("FEED_SYNC_FAN_OUT_LIMIT", 100)
+}
+
+// FeedCelebrityThreshold を超えるフォロワーがいるユーザーの投稿はフィードに書き込まず、読むときに集める
+func (c *Envs) FeedCelebrityThreshold() int {
+	return c.intEnv("FEED_CELEBRITY_THRESHOLD", 10000)
+}
+
+// MicropostEditWindow は Micropost を作成してから編集できる期間。0 なら期限を設けない
+func (c *Envs) MicropostEditWindow() time.Duration {
+	return time.Duration(c.intEnv("MICROPOST_EDIT_WINDOW_MINUTES", 0)) * time.Minute
+}
+
+// ScheduleLookback は予約投稿を公開する処理が毎回読み直す期間。これより前の予約は読み終えた記録の続きから読む
+func (c *Envs) ScheduleLookback() time.Duration {
+	return time.Duration(c.intEnv("SCHEDULE_LOOKBACK_HOURS", 24)) * time.Hour
+}
+
+// AdminToken は管理用の API に Authorization: Bearer で渡すトークン。設定されていなければ管理用の API は使えない
+// テンプレートは NoEcho のパラメータをそのまま渡すので、KMS で復号せずに読む
+func (c *Envs) AdminToken() string {
+	return c.env("ADMIN_TOKEN")
+}
+
+// ModerationBannedWords を含む投稿は受け付けない
+func (c *Envs) ModerationBannedWords() []string {
+	return c.listEnv("MODERATION_BANNED_WORDS")
+}
+
+// ModerationReviewWords を含む投稿は管理者が承認するまで公開しない
+func (c *Envs) ModerationReviewWords() []string {
+	return c.listEnv("MODERATION_REVIEW_WORDS")
+}
+
+// ModerationBlockedHosts のホストかそのサブドメインへの URL を含む投稿は受け付けない
+func (c *Envs) ModerationBlockedHosts() []string {
+	return c.listEnv("MODERATION_BLOCKED_HOSTS")
+}
+
+// ModerationMaxRepeatedChars を超えて同じ文字が続く投稿は管理者が承認するまで公開しない。0 なら調べない
+func (c *Envs) ModerationMaxRepeatedChars() int {
+	return c.intEnv("MODERATION_MAX_REPEATED_CHARS", 10)
+}
@@ -0,0 +1,180 @@
+package storage
+
+import (
+	"os"
+	"sam-book-sample/settings"
+	"sam-book-sample/utils"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pkg/errors"
+)
+
+// ローカルの S3 互換サーバーの認証情報。docker-compose の s3-local と合わせる
+const (
+	localAccessKey = "dummy"
+	localSecretKey = "dummydummy"
+)
+
+func Config() *aws.Config {
+	config := &aws.Config{
+		Region: aws.String("ap-northeast-1"),
+	}
+
+	envs := settings.Env()
+
+	if envs.IsS3Local() {
+		config.Credentials = credentials.NewStaticCredentials(localAccessKey, localSecretKey, "")
+		config.Endpoint = aws.String(envs.S3Endpoint())
+		// ローカルのサーバーはバケット名をホスト名に含める形式に対応しないので、パスに含める
+		config.S3ForcePathStyle = aws.Bool(true)
+	}
+
+	return config
+}
+
+func Client() (*s3.S3, error) {
+	s3Session, err := session.NewSession(Config())
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return s3.New(s3Session), nil
+}
+
+// PresignPut は key に contentType のオブジェクトを置くための URL を返す。
+// Content-Length は署名に含まれず、URL は期限までなら何度でも使えるので、置かれたものは CopyObject で
+// 確かめた版を別のキーに写してから使う
+func PresignPut(key, contentType string, ttl time.Duration) (string, error) {
+	client, err := Client()
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	req, _ := client.PutObjectRequest(&s3.PutObjectInput{
+		Bucket:      aws.String(settings.Env().AttachmentBucketName()),
+		Key:         aws.String(key),
+		ContentType: aws.String(contentType),
+	})
+
+	url, err := req.Presign(ttl)
+
+	return url, errors.WithStack(err)
+}
+
+// PresignGet は key のオブジェクトを読むための URL を返す
+func PresignGet(key string, ttl time.Duration) (string, error) {
+	client, err := Client()
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	req, _ := client.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(settings.Env().AttachmentBucketName()),
+		Key:    aws.String(key),
+	})
+
+	url, err := req.Presign(ttl)
+
+	return url, errors.WithStack(err)
+}
+
+// HeadObject は key のオブジェクトの属性を返す。置かれていなければ nil を返す
+func HeadObject(key string) (*s3.HeadObjectOutput, error) {
+	client, err := Client()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	output, err := client.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(settings.Env().AttachmentBucketName()),
+		Key:    aws.String(key),
+	})
+	if ae, ok := err.(awserr.RequestFailure); ok && ae.StatusCode() == 404 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return output, nil
+}
+
+// CopyObject は ETag が etag の src のオブジェクトを dst に写す。src がないか置き換えられていれば false を返す
+func CopyObject(src, dst, etag string) (bool, error) {
+	client, err := Client()
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	bucket := settings.Env().AttachmentBucketName()
+
+	_, err = client.CopyObject(&s3.CopyObjectInput{
+		Bucket:            aws.String(bucket),
+		Key:               aws.String(dst),
+		CopySource:        aws.String(bucket + "/" + src),
+		CopySourceIfMatch: aws.String(etag),
+	})
+	if ae, ok := err.(awserr.RequestFailure); ok && (ae.StatusCode() == 404 || ae.StatusCode() == 412) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	return true, nil
+}
+
+func SetupBucketForTest() error {
+	// テスト毎に新しいバケットを作成するため、ランダムな値を設定する
+	randomStr, err := utils.GenerateToken(16)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	os.Setenv("ATTACHMENT_BUCKET_NAME", "test-"+randomStr)
+
+	client, err := Client()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	_, err = client.CreateBucket(&s3.CreateBucketInput{
+		Bucket: aws.String(settings.Env().AttachmentBucketName()),
+	})
+
+	return errors.WithStack(err)
+}
+
+// DropBucket はバケットのオブジェクトをすべて消してからバケットを消す
+func DropBucket() error {
+	client, err := Client()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	bucket := aws.String(settings.Env().AttachmentBucketName())
+
+	var deleteErr error
+	err = client.ListObjectsPages(&s3.ListObjectsInput{Bucket: bucket}, func(page *s3.ListObjectsOutput, last bool) bool {
+		for _, o := range page.Contents {
+			_, deleteErr = client.DeleteObject(&s3.DeleteObjectInput{Bucket: bucket, Key: o.Key})
+			if deleteErr != nil {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if deleteErr != nil {
+		return errors.WithStack(deleteErr)
+	}
+
+	_, err = client.DeleteBucket(&s3.DeleteBucketInput{Bucket: bucket})
+
+	return errors.WithStack(err)
+}
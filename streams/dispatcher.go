@@ -0,0 +1,97 @@
+package streams
+
+import (
+	"context"
+	"sam-book-sample/logging"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/pkg/errors"
+)
+
+// Subscriber は Event を受け取る。エラーを返すとその記録から後を失敗として報告し、Lambda が再試行する。
+// 同じ記録を何度も受け取ることがあるので、冪等にする
+type Subscriber interface {
+	Handle(ctx context.Context, event *Event) error
+}
+
+// SubscriberFunc は関数を Subscriber にする
+type SubscriberFunc func(ctx context.Context, event *Event) error
+
+func (f SubscriberFunc) Handle(ctx context.Context, event *Event) error {
+	return f(ctx, event)
+}
+
+type subscription struct {
+	entity     string
+	subscriber Subscriber
+}
+
+// Dispatcher は DynamoDB Streams の記録を Event にして、登録した Subscriber に登録した順に渡す
+type Dispatcher struct {
+	subscriptions []subscription
+}
+
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{}
+}
+
+// Subscribe は entity の Event を s に渡すよう登録する。entity が空ならすべての Event を渡す
+func (d *Dispatcher) Subscribe(entity string, s Subscriber) {
+	d.subscriptions = append(d.subscriptions, subscription{entity: entity, subscriber: s})
+}
+
+// BatchItemFailure と BatchResponse は ReportBatchItemFailures を有効にしたときの Lambda の戻り値。
+// ItemIdentifier には失敗した記録の SequenceNumber を入れる
+type BatchItemFailure struct {
+	ItemIdentifier string `json:"itemIdentifier"`
+}
+
+type BatchResponse struct {
+	BatchItemFailures []BatchItemFailure `json:"batchItemFailures"`
+}
+
+// Handle は event の記録を順に処理する。シャードの中の順序を守るため、失敗した記録で止め、
+// その記録を BatchItemFailures で報告する。Lambda はその記録から後だけを再試行する
+func (d *Dispatcher) Handle(ctx context.Context, event events.DynamoDBEvent) (*BatchResponse, error) {
+	res := &BatchResponse{BatchItemFailures: []BatchItemFailure{}}
+
+	for _, record := range event.Records {
+		err := d.dispatch(ctx, record)
+		if err != nil {
+			logging.FromContext(ctx).
+				WithError(err).
+				WithField("event_id", record.EventID).
+				WithField("sequence_number", record.Change.SequenceNumber).
+				Error("failed to handle stream record")
+
+			res.BatchItemFailures = append(res.BatchItemFailures, BatchItemFailure{
+				ItemIdentifier: record.Change.SequenceNumber,
+			})
+			break
+		}
+	}
+
+	return res, nil
+}
+
+func (d *Dispatcher) dispatch(ctx context.Context, record events.DynamoDBEventRecord) error {
+	event, err := decodeRecord(record)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if event == nil {
+		return nil
+	}
+
+	for _, s := range d.subscriptions {
+		if s.entity != "" && s.entity != event.Entity {
+			continue
+		}
+		err = s.subscriber.Handle(ctx, event)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package streams
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"sam-book-sample/models"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func loadFixture(t *testing.T, name string) events.DynamoDBEvent {
+	b, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	var event events.DynamoDBEvent
+	if !assert.NoError(t, json.Unmarshal(b, &event)) {
+		t.FailNow()
+	}
+	return event
+}
+
+func recorder(received *[]*Event) Subscriber {
+	return SubscriberFunc(func(ctx context.Context, event *Event) error {
+		*received = append(*received, event)
+		return nil
+	})
+}
+
+func TestDispatcher_User(t *testing.T) {
+	var all, users, microposts []*Event
+	d := NewDispatcher()
+	d.Subscribe("", recorder(&all))
+	d.Subscribe("User", recorder(&users))
+	d.Subscribe("Micropost", recorder(&microposts))
+
+	res, err := d.Handle(context.Background(), loadFixture(t, "insert_user.json"))
+	assert.NoError(t, err)
+	assert.Empty(t, res.BatchItemFailures)
+
+	assert.Len(t, all, 1)
+	assert.Len(t, microposts, 0)
+	if !assert.Len(t, users, 1) {
+		return
+	}
+
+	event := users[0]
+	assert.Equal(t, Created, event.Type)
+	assert.Equal(t, "User-00000000001", event.Keys.PK)
+	assert.Equal(t, "100", event.SequenceNumber)
+	assert.Nil(t, event.OldImage)
+
+	user := event.NewImage.(*models.User)
+	assert.Equal(t, uint64(1), user.ID)
+	assert.Equal(t, "taro", user.Name)
+	assert.Equal(t, "taro@example.com", user.Email)
+}
+
+func TestDispatcher_Micropost(t *testing.T) {
+	var received []*Event
+	d := NewDispatcher()
+	d.Subscribe("Micropost", recorder(&received))
+
+	res, err := d.Handle(context.Background(), loadFixture(t, "micropost_changes.json"))
+	assert.NoError(t, err)
+	assert.Empty(t, res.BatchItemFailures)
+
+	// いいねの項目は Micropost の変更として渡さない
+	if !assert.Len(t, received, 2) {
+		return
+	}
+
+	updated := received[0]
+	assert.Equal(t, Updated, updated.Type)
+	assert.Equal(t, "hello", updated.OldImage.(*models.Micropost).Content)
+	newImage := updated.NewImage.(*models.Micropost)
+	assert.Equal(t, "hello #go", newImage.Content)
+	assert.Equal(t, []string{"go"}, newImage.Hashtags)
+	assert.Equal(t, int64(1), newImage.LikeCount)
+
+	deleted := received[1]
+	assert.Equal(t, Deleted, deleted.Type)
+	assert.Equal(t, uint64(3), deleted.OldImage.(*models.Micropost).ID)
+	assert.Nil(t, deleted.NewImage)
+}
+
+func TestDispatcher_Failure(t *testing.T) {
+	var calls []string
+	d := NewDispatcher()
+	d.Subscribe("", SubscriberFunc(func(ctx context.Context, event *Event) error {
+		calls = append(calls, event.SequenceNumber)
+		if event.Type == Updated {
+			return errors.New("failed")
+		}
+		return nil
+	}))
+
+	res, err := d.Handle(context.Background(), loadFixture(t, "micropost_changes.json"))
+	assert.NoError(t, err)
+
+	// 失敗した記録を報告し、後の記録は処理しない
+	assert.Equal(t, []BatchItemFailure{{ItemIdentifier: "200"}}, res.BatchItemFailures)
+	assert.Equal(t, []string{"200"}, calls)
+}
+
+func TestDecodeRecord_UnknownEntity(t *testing.T) {
+	event := loadFixture(t, "insert_user.json")
+	record := event.Records[0]
+	record.Change.Keys["PK"] = events.NewStringAttribute("Counter-00000000001")
+
+	decoded, err := decodeRecord(record)
+	assert.NoError(t, err)
+	assert.Nil(t, decoded)
+}
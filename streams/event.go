@@ -0,0 +1,115 @@
+package streams
+
+import (
+	"encoding/json"
+	"sam-book-sample/db"
+	"sam-book-sample/models"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/pkg/errors"
+)
+
+// EventType は項目の変更の種類
+type EventType string
+
+const (
+	Created EventType = "Created"
+	Updated EventType = "Updated"
+	Deleted EventType = "Deleted"
+)
+
+var eventTypes = map[string]EventType{
+	"INSERT": Created,
+	"MODIFY": Updated,
+	"REMOVE": Deleted,
+}
+
+// Event は User か Micropost の 1 件の変更。OldImage と NewImage は Entity に応じて *models.User か *models.Micropost で、
+// 作成なら OldImage が、削除なら NewImage が nil になる
+type Event struct {
+	Type           EventType
+	Entity         string
+	Keys           db.MainTable
+	OldImage       interface{}
+	NewImage       interface{}
+	SequenceNumber string
+}
+
+type unmarshaler func(item map[string]*dynamodb.AttributeValue) (interface{}, error)
+
+// entities は PK の接頭辞で見分けるエンティティと、その項目を読む関数
+var entities = map[string]unmarshaler{
+	(&models.User{}).EntityName(): func(item map[string]*dynamodb.AttributeValue) (interface{}, error) {
+		return models.UnmarshalUser(item)
+	},
+	(&models.Micropost{}).EntityName(): func(item map[string]*dynamodb.AttributeValue) (interface{}, error) {
+		return models.UnmarshalMicropost(item)
+	},
+}
+
+// decodeRecord は DynamoDB Streams の記録を Event にする。User と Micropost の本体でない項目なら nil を返す。
+// いいねや履歴などの子の項目は同じパーティションにあるが、SK が ID だけでないので本体と見分けられる
+func decodeRecord(record events.DynamoDBEventRecord) (*Event, error) {
+	keys := db.MainTable{
+		PK: record.Change.Keys[db.PKName].String(),
+		SK: record.Change.Keys[db.SKName].String(),
+	}
+
+	i := strings.Index(keys.PK, "-")
+	if i < 0 || keys.PK[i+1:] != keys.SK {
+		return nil, nil
+	}
+	entity := keys.PK[:i]
+	unmarshal, ok := entities[entity]
+	if !ok {
+		return nil, nil
+	}
+
+	eventType, ok := eventTypes[record.EventName]
+	if !ok {
+		return nil, errors.Errorf("unknown event name: %s", record.EventName)
+	}
+
+	event := &Event{
+		Type:           eventType,
+		Entity:         entity,
+		Keys:           keys,
+		SequenceNumber: record.Change.SequenceNumber,
+	}
+
+	var err error
+	if len(record.Change.OldImage) > 0 {
+		event.OldImage, err = decodeImage(record.Change.OldImage, unmarshal)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	if len(record.Change.NewImage) > 0 {
+		event.NewImage, err = decodeImage(record.Change.NewImage, unmarshal)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	return event, nil
+}
+
+// decodeImage は Lambda のイベントの属性値を SDK の属性値に変えてから読む。
+// どちらも {"S": "..."} の形の JSON になるので、JSON を経由して変える
+func decodeImage(image map[string]events.DynamoDBAttributeValue, unmarshal unmarshaler) (interface{}, error) {
+	b, err := json.Marshal(image)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var item map[string]*dynamodb.AttributeValue
+	err = json.Unmarshal(b, &item)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	v, err := unmarshal(item)
+	return v, errors.WithStack(err)
+}
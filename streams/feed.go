@@ -0,0 +1,22 @@
+package streams
+
+import (
+	"context"
+	"sam-book-sample/models"
+
+	"github.com/pkg/errors"
+)
+
+// FanOutFeed は作成された Micropost をフォロワーのフィードに配る。投稿のリクエストの中で配れなかったものもここで配る
+func FanOutFeed(ctx context.Context, event *Event) error {
+	if event.Type != Created {
+		return nil
+	}
+
+	m, ok := event.NewImage.(*models.Micropost)
+	if !ok {
+		return errors.Errorf("unexpected image: %T", event.NewImage)
+	}
+
+	return errors.WithStack(models.FanOutCreatedMicropost(m))
+}